@@ -39,6 +39,7 @@
 package cmdline
 
 import (
+	"context"
 	"errors"
 	"flag"
 	"fmt"
@@ -53,7 +54,7 @@ import (
 
 	"v.io/x/lib/cmd/flagvar"
 	"v.io/x/lib/envvar"
-	_ "v.io/x/lib/metadata" // for the -metadata flag
+	"v.io/x/lib/metadata"
 	"v.io/x/lib/timing"
 )
 
@@ -68,6 +69,47 @@ type Command struct {
 	ArgsName string // Name of the args, shown in usage line.
 	ArgsLong string // Long description of the args, shown in help.
 
+	// Aliases are optional alternative names for the command, e.g. the old name
+	// of a renamed command.  Any alias may be used in place of Name to invoke the
+	// command, and help lists the aliases in parentheses after Name.  Aliases
+	// must be unique among the names and aliases of the command's siblings.
+	Aliases []string
+
+	// PositionalArgs optionally describes each of the distinct positional args
+	// taken by the Runner, in order, e.g. "src" and "dst" for a copy command.
+	// It is an alternative to ArgsName and ArgsLong, which are then generated
+	// from it; e.g. the usage line is "copy <src> <dst>".  Unlike ArgsName, the
+	// number of args is enforced by Parse.  At most one of PositionalArgs and
+	// ArgsName / ArgsLong may be specified.
+	PositionalArgs []ArgSpec
+
+	// ParseArgs, if non-nil, is called by Parse with the args remaining after
+	// flag parsing, to validate and transform them before they're passed to the
+	// Runner, e.g. for commands that take key=value pairs.  It's called after
+	// PositionalArgs are checked, even if there are no args.  As usual, args are
+	// only accepted if ArgsName or PositionalArgs is set.  An error it returns
+	// is reported as a usage error, unless it's already an ErrExitCode.
+	ParseArgs func(args []string) ([]string, error)
+
+	// LongFunc, if non-nil, returns the long description of the command, and is
+	// used in place of Long when Long is empty.  It is only called when help is
+	// shown, and may be used to load large descriptions from an embed.FS, or to
+	// generate them dynamically.
+	LongFunc func() string
+
+	// Group is an optional heading under which this command is listed in the
+	// help of its parent, e.g. "Management Commands".  Children without a Group
+	// are listed under the default heading.  Groups are listed in the order in
+	// which they first appear among the children, and commands within each group
+	// are listed in declaration order.  Grouping is ignored by the godoc style.
+	Group string
+
+	// Hidden indicates whether to omit this command from the help of its parent,
+	// including "help ...", e.g. for internal or debugging commands.  A hidden
+	// command may still be run, and its own help is still available, e.g. via
+	// "tool help secret".
+	Hidden bool
+
 	// Flags defined for this command.  When a flag F is defined on a command C,
 	// we allow F to be specified on the command line immediately after C, or
 	// after any descendant of C. This FlagSet is only used to specify the
@@ -79,6 +121,31 @@ type Command struct {
 	// command. The flags variables are defined as tagged (`cmdline:""`)
 	// fields in a struct as per the v.io/x/lib/cmd/flagvar package.
 	FlagDefs FlagDefinitions
+	// FlagCompletions optionally maps the names of flags defined in Flags to a
+	// Completer that returns candidate values for the flag, e.g. for use by
+	// shell completion after "-format=".  The flag package doesn't provide a way
+	// to attach such metadata to a flag.Value, hence this separate table.  The
+	// values of a Completer returned by CompleteValues are fixed, so they may be
+	// embedded in a generated completion script; other Completers can only be
+	// called by running the program at completion time.
+	FlagCompletions map[string]Completer
+	// DeprecatedFlags optionally maps the names of deprecated flags defined in
+	// Flags to a message, e.g. "use -newflag".  Deprecated flags continue to
+	// work, but when one is explicitly set on the command line, a warning
+	// containing the message is written to env.Stderr after parsing.
+	DeprecatedFlags map[string]string
+	// FlagShorthands optionally maps the names of flags defined in Flags to a
+	// shorthand, e.g. "v" for "verbose".  The shorthand may be used in place of
+	// the flag name on the command line, and sets the same value.  Usage shows
+	// both names together, e.g. "-v, -verbose=false".  Like the flags, the
+	// shorthands are propagated to descendant commands.
+	FlagShorthands map[string]string
+	// RequiredFlags optionally lists the names of flags defined in Flags that
+	// must be set on the command line, even if they have a non-empty default.
+	// Parse returns a usage error naming the first missing flag before the
+	// Runner of this command, or of a descendant that inherits the flags, is
+	// run.  Requesting help doesn't require the flags.
+	RequiredFlags []string
 	// ParsedFlags contains the FlagSet created by the Command
 	// implementation and that has had its Parse method called. It
 	// should be used instead of the Flags field for handling methods
@@ -93,9 +160,26 @@ type Command struct {
 	// ancestor commands. The flags for the ancestor commands will not be
 	// propagated to the child commands as well.
 	DontInheritFlags bool
+	// PassUnknownFlags indicates whether flags that aren't defined for this
+	// command are passed to the Runner as args, rather than causing a usage
+	// error, e.g. for a thin wrapper around another tool.  The unknown flags
+	// precede the other args, in their original order.  Since there's no way to
+	// tell whether an unknown flag takes a value, the value must be specified in
+	// the same arg, e.g. "-foo=bar".  Cannot be set on a command with Children.
+	PassUnknownFlags bool
+	// OmitZeroFlagValues indicates whether usage messages should omit the
+	// "=value" part for flags whose value is the zero value of its type, e.g.
+	// showing "-verbose" rather than "-verbose=false".  When set, it applies to
+	// the usage of this command and its descendants, including global flags.
+	OmitZeroFlagValues bool
 
 	// Children of the command.
 	Children []*Command
+	// NoHelp indicates whether to prevent the default help command from being
+	// added to the children of this command, e.g. for a command that passes its
+	// args through to another tool.  If set, "help" is treated like any other
+	// unknown command name.  The -help flag is unaffected.
+	NoHelp bool
 
 	// LookPath indicates whether to look for external subcommands in the
 	// directories specified by the PATH environment variable.  The compiled-in
@@ -103,20 +187,34 @@ type Command struct {
 	// occurs if none of the compiled-in children match.
 	//
 	// All global flags and flags set on ancestor commands are passed through to
-	// the external child.
+	// the external child.  Use ImportCommand instead to make the commands of a
+	// cmdline-based binary part of the tree, along with their help.
 	LookPath bool
 
+	// NoBuiltinFlags indicates whether to omit the builtin global flags that are
+	// registered on flag.CommandLine by this package, i.e. -metadata and -time,
+	// e.g. for a minimal tool that wants a clean flag list.  The flags are neither
+	// accepted nor shown in help for this command tree; flag.CommandLine itself
+	// is left unchanged, but as with ParseReentrant, it isn't parsed.  May only
+	// be set on the root command.
+	NoBuiltinFlags bool
+
 	// Runner that runs the command.
 	// Use RunnerFunc to adapt regular functions into Runners.
 	//
 	// At least one of Children or Runner must be specified.  If both are
-	// specified, ArgsName and ArgsLong must be empty, meaning the Runner doesn't
-	// take any args.  Otherwise there's a possible conflict between child names
-	// and the runner args, and an error is returned from Parse.
+	// specified, ArgsName, ArgsLong and PositionalArgs must be empty, meaning the
+	// Runner doesn't take any args.  Otherwise there's a possible conflict
+	// between child names and the runner args, and an error is returned from
+	// Parse.
 	Runner Runner
 
 	// Topics that provide additional info via the default help command.
 	Topics []Topic
+
+	// noBuiltinFlags is set on every command in the tree by Parse, from the
+	// NoBuiltinFlags of the root, for commands run via RunSubcommand.
+	noBuiltinFlags bool
 }
 
 // FlagDefinitions represents a struct containing flag variables and their
@@ -141,6 +239,120 @@ func (f RunnerFunc) Run(env *Env, args []string) error {
 	return f(env, args)
 }
 
+// ResultRunner is an optional interface for Runners that produce a result in
+// addition to an error.  Callers of Parse may type-assert the returned Runner to
+// ResultRunner and call RunResult to obtain the result, e.g. to display it in a
+// REPL.  Run should behave like RunResult, discarding the result; ParseAndRun
+// and Main only ever call Run.
+type ResultRunner interface {
+	Runner
+	RunResult(env *Env, args []string) (interface{}, error)
+}
+
+// ResultRunnerFunc is an adapter that turns regular functions into
+// ResultRunners.
+type ResultRunnerFunc func(*Env, []string) (interface{}, error)
+
+// Run implements the Runner interface method by calling f(env, args) and
+// discarding the result.
+func (f ResultRunnerFunc) Run(env *Env, args []string) error {
+	_, err := f(env, args)
+	return err
+}
+
+// RunResult implements the ResultRunner interface method by calling
+// f(env, args).
+func (f ResultRunnerFunc) RunResult(env *Env, args []string) (interface{}, error) {
+	return f(env, args)
+}
+
+// ContextRunner is an optional interface for Runners that take a
+// context.Context, e.g. for cancellation and deadlines of long-running commands.
+// ParseAndRunContext and MainWithContext call RunContext with their context.
+// Run should behave like RunContext with a background context, since other
+// callers, e.g. ParseAndRun and Main, only ever call Run.
+type ContextRunner interface {
+	Runner
+	RunContext(ctx context.Context, env *Env, args []string) error
+}
+
+// ContextRunnerFunc is an adapter that turns regular functions into
+// ContextRunners.
+type ContextRunnerFunc func(context.Context, *Env, []string) error
+
+// Run implements the Runner interface method by calling
+// f(context.Background(), env, args).
+func (f ContextRunnerFunc) Run(env *Env, args []string) error {
+	return f(context.Background(), env, args)
+}
+
+// RunContext implements the ContextRunner interface method by calling
+// f(ctx, env, args).
+func (f ContextRunnerFunc) RunContext(ctx context.Context, env *Env, args []string) error {
+	return f(ctx, env, args)
+}
+
+// Completer is the interface for completing flag values.
+type Completer interface {
+	// Complete returns the candidate values that start with the given prefix.
+	Complete(prefix string) []string
+}
+
+// CompleterFunc is an adapter that turns regular functions into Completers.
+type CompleterFunc func(prefix string) []string
+
+// Complete implements the Completer interface method by calling f(prefix).
+func (f CompleterFunc) Complete(prefix string) []string {
+	return f(prefix)
+}
+
+// CompleteValues returns a Completer that completes from the given fixed set of
+// values, in the given order.
+func CompleteValues(values ...string) Completer {
+	return valuesCompleter(values)
+}
+
+// valuesCompleter is a Completer with a fixed set of values, which is
+// recognized by code that generates completion scripts.
+type valuesCompleter []string
+
+func (v valuesCompleter) Complete(prefix string) []string {
+	var res []string
+	for _, value := range v {
+		if strings.HasPrefix(value, prefix) {
+			res = append(res, value)
+		}
+	}
+	return res
+}
+
+// CompleteFlag returns the candidate values starting with prefix for the flag
+// with the given name, as specified by FlagCompletions.  Returns nil if the
+// flag has no completions.
+func (cmd *Command) CompleteFlag(name, prefix string) []string {
+	if c := cmd.FlagCompletions[name]; c != nil {
+		return c.Complete(prefix)
+	}
+	return nil
+}
+
+// ArgSpec describes a single positional arg of a command.  Optional args must
+// follow all required args.
+type ArgSpec struct {
+	Name        string // Name of the arg, shown in usage line.
+	Description string // Description of the arg, shown in help.
+	Required    bool   // Whether the arg must be specified.
+}
+
+// usage returns the arg name as shown in the usage line, e.g. "<src>" for a
+// required arg, or "[<dst>]" for an optional arg.
+func (a ArgSpec) usage() string {
+	if a.Required {
+		return "<" + a.Name + ">"
+	}
+	return "[<" + a.Name + ">]"
+}
+
 // Topic represents a help topic that is accessed via the help command.
 type Topic struct {
 	Name  string // Name of the topic.
@@ -162,11 +374,17 @@ type Topic struct {
 //	  cmdline.Main(root)
 //	}
 func Main(root *Command) {
+	MainWithContext(context.Background(), root)
+}
+
+// MainWithContext is like Main, but passes ctx to the runner if it implements
+// ContextRunner, e.g. so that the runner is canceled when ctx is.
+func MainWithContext(ctx context.Context, root *Command) {
 	env := EnvFromOS()
 	if env.Timer != nil && len(env.Timer.Intervals) > 0 {
 		env.Timer.Intervals[0].Name = pathName(env.prefix(), []*Command{root})
 	}
-	err := ParseAndRun(root, env, os.Args[1:])
+	err := ParseAndRunContext(ctx, root, env, os.Args[1:])
 	code := ExitCode(err, env.Stderr)
 	if *flagTime && env.Timer != nil {
 		env.Timer.Finish()
@@ -215,18 +433,29 @@ var flagTime = flag.Bool("time", false, "Dump timing information to stderr befor
 // Parse merges root flags into flag.CommandLine and sets ContinueOnError, so
 // that subsequent calls to flag.Parsed return true.
 func Parse(root *Command, env *Env, args []string) (Runner, []string, error) {
+	return parse(root, env, args, false)
+}
+
+// ParseReentrant is like Parse, but may safely be called any number of times
+// in the same process, e.g. by a REPL that dispatches to its own command tree.
+// Unlike Parse, it never parses or modifies flag.CommandLine; the flags for the
+// root command are parsed using a fresh FlagSet on each call, just like the
+// flags for other commands.  Thus flag.Parsed is unaffected by ParseReentrant.
+//
+// Note that the flag values themselves are shared across calls, since they're
+// defined by the command tree and the global flags.  A flag set by one call
+// retains its value in subsequent calls unless it is set again.
+func ParseReentrant(root *Command, env *Env, args []string) (Runner, []string, error) {
+	return parse(root, env, args, true)
+}
+
+func parse(root *Command, env *Env, args []string, reentrant bool) (Runner, []string, error) {
 	env.TimerPush("cmdline parse")
 	if err := root.registerFlagDefs(); err != nil {
 		return nil, nil, err
 	}
 	defer env.TimerPop()
-	if globalFlags == nil {
-		// Initialize our global flags to a cleaned copy.  We don't want the merging
-		// in parseFlags to contaminate the global flags, even if Parse is called
-		// multiple times, so we keep a single package-level copy.
-		cleanFlags(flag.CommandLine)
-		globalFlags = copyFlags(flag.CommandLine)
-	}
+	initGlobalFlags()
 	// Set env.Usage to the usage of the root command, in case the parse fails.
 	path := []*Command{root}
 	env.Usage = makeHelpRunner(path, env).usageFunc
@@ -234,7 +463,11 @@ func Parse(root *Command, env *Env, args []string) (Runner, []string, error) {
 	if err := checkTreeInvariants(path, env); err != nil {
 		return nil, nil, err
 	}
-	runner, args, err := root.parse(nil, env, args, make(map[string]string))
+	setNoBuiltinFlags(root, root.NoBuiltinFlags)
+	if len(args) > 0 && args[0] == completeName {
+		return completeRunner{root}, args[1:], nil
+	}
+	runner, args, err := root.parse(nil, env, args, make(map[string]string), reentrant)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -243,8 +476,8 @@ func Parse(root *Command, env *Env, args []string) (Runner, []string, error) {
 	// and CMDLINE_FIRST_CALL are only meant to be passed to external children,
 	// and shouldn't be propagated through the user's runner.
 	switch runner.(type) {
-	case helpRunner, binaryRunner:
-		// The help and binary runners need the envvars to be set.
+	case helpRunner, binaryRunner, importRunner:
+		// The help, binary and import runners need the envvars to be set.
 	default:
 		for key := range env.Vars {
 			if strings.HasPrefix(key, "CMDLINE_") {
@@ -260,26 +493,124 @@ func Parse(root *Command, env *Env, args []string) (Runner, []string, error) {
 
 var globalFlags *flag.FlagSet
 
+func initGlobalFlags() {
+	if globalFlags == nil {
+		// Initialize our global flags to a cleaned copy.  We don't want the merging
+		// in parseFlags to contaminate the global flags, even if Parse is called
+		// multiple times, so we keep a single package-level copy.
+		cleanFlags(flag.CommandLine)
+		globalFlags = copyFlags(flag.CommandLine)
+	}
+}
+
+// builtinFlags are the names of the global flags that are registered on
+// flag.CommandLine as a side-effect of importing this package.  The -metadata
+// flag is registered by the v.io/x/lib/metadata package.
+var builtinFlags = []string{metadata.FlagName, "time"}
+
+// pathGlobalFlags returns the global flags that apply to the command tree that
+// contains path, omitting the builtinFlags if the root of the tree has
+// NoBuiltinFlags set.  The first command in path isn't necessarily the root,
+// e.g. for RunSubcommand.  The package-level globalFlags are never modified.
+func pathGlobalFlags(path []*Command) *flag.FlagSet {
+	if len(path) > 0 && (path[0].NoBuiltinFlags || path[0].noBuiltinFlags) {
+		return copyFlagsExcept(globalFlags, builtinFlags)
+	}
+	return globalFlags
+}
+
+// setNoBuiltinFlags sets noBuiltinFlags on cmd and all of its descendants.
+func setNoBuiltinFlags(cmd *Command, noBuiltinFlags bool) {
+	cmd.noBuiltinFlags = noBuiltinFlags
+	for _, child := range cmd.Children {
+		setNoBuiltinFlags(child, noBuiltinFlags)
+	}
+}
+
 // ParseAndRun is a convenience that calls Parse, and then calls Run on the
-// returned runner with the given env and parsed args.
+// returned runner with the given env and parsed args.  The result of a
+// ResultRunner is ignored.
 func ParseAndRun(root *Command, env *Env, args []string) error {
+	return ParseAndRunContext(context.Background(), root, env, args)
+}
+
+// ParseAndRunContext is like ParseAndRun, but if the returned runner implements
+// ContextRunner, calls RunContext with ctx rather than Run.
+func ParseAndRunContext(ctx context.Context, root *Command, env *Env, args []string) error {
 	runner, args, err := Parse(root, env, args)
 	if err != nil {
 		return err
 	}
 	env.TimerPush("cmdline run")
 	defer env.TimerPop()
+	if cr, ok := runner.(ContextRunner); ok {
+		return cr.RunContext(ctx, env, args)
+	}
 	return runner.Run(env, args)
 }
 
+// RunSubcommand runs the child of cmd with the given name or alias, as if name
+// and args had been specified on the command line after cmd.  It's meant for
+// commands that invoke their own subcommands, e.g. an "all" command that runs
+// several others.  The args are parsed for the child, its descendants, and
+// cmd, along with the global flags, but flag.CommandLine is never used, just
+// like ParseReentrant.  Flags defined on ancestors of cmd aren't recognized,
+// and as with ParseReentrant, a flag set by one call retains its value in
+// subsequent calls unless it is set again.
+//
+// Returns a usage error if cmd has no child with the given name.
+func (cmd *Command) RunSubcommand(env *Env, name string, args []string) error {
+	return cmd.RunSubcommandContext(context.Background(), env, name, args)
+}
+
+// RunSubcommandContext is like RunSubcommand, but if the runner of the child
+// implements ContextRunner, calls RunContext with ctx rather than Run.
+func (cmd *Command) RunSubcommandContext(ctx context.Context, env *Env, name string, args []string) error {
+	initGlobalFlags()
+	defer func(usage func(*Env, io.Writer)) { env.Usage = usage }(env.Usage)
+	for _, child := range cmd.Children {
+		if !child.matches(name) {
+			continue
+		}
+		if err := child.registerFlagDefs(); err != nil {
+			return err
+		}
+		runner, args, err := child.parse([]*Command{cmd}, env, args, make(map[string]string), true)
+		if err != nil {
+			return err
+		}
+		if cr, ok := runner.(ContextRunner); ok {
+			return cr.RunContext(ctx, env, args)
+		}
+		return runner.Run(env, args)
+	}
+	return env.UsageErrorf("%s: unknown command %q", pathName(env.prefix(), []*Command{cmd}), name)
+}
+
 func trimSpace(s *string) { *s = strings.TrimSpace(*s) }
 
+// long returns the long description of cmd, calling LongFunc if Long is empty.
+func (cmd *Command) long() string {
+	if cmd.Long == "" && cmd.LongFunc != nil {
+		return strings.TrimSpace(cmd.LongFunc())
+	}
+	return cmd.Long
+}
+
 func cleanTree(cmd *Command) {
 	trimSpace(&cmd.Name)
+	for ax := range cmd.Aliases {
+		trimSpace(&cmd.Aliases[ax])
+	}
 	trimSpace(&cmd.Short)
 	trimSpace(&cmd.Long)
 	trimSpace(&cmd.ArgsName)
 	trimSpace(&cmd.ArgsLong)
+	for ax := range cmd.PositionalArgs {
+		trimSpace(&cmd.PositionalArgs[ax].Name)
+		trimSpace(&cmd.PositionalArgs[ax].Description)
+	}
+	trimSpace(&cmd.Group)
 	for tx := range cmd.Topics {
 		trimSpace(&cmd.Topics[tx].Name)
 		trimSpace(&cmd.Topics[tx].Short)
@@ -330,6 +661,11 @@ Saw %q multiple times.`, cmdPath, name)
 		if err := checkName(child.Name); err != nil {
 			return err
 		}
+		for _, alias := range child.Aliases {
+			if err := checkName(alias); err != nil {
+				return err
+			}
+		}
 	}
 	for _, topic := range cmd.Topics {
 		if err := checkName(topic.Name); err != nil {
@@ -337,21 +673,111 @@ Saw %q multiple times.`, cmdPath, name)
 		}
 	}
 	// Check that our Children / Runner invariant is satisfied.  At least one must
-	// be specified, and if both are specified then ArgsName and ArgsLong must be
-	// empty, meaning the Runner doesn't take any args.
+	// be specified, and if both are specified then ArgsName, ArgsLong and
+	// PositionalArgs must be empty, meaning the Runner doesn't take any args.
 	switch hasC, hasR := len(cmd.Children) > 0, cmd.Runner != nil; {
 	case !hasC && !hasR:
 		msg := fmt.Sprintf(`%v: CODE INVARIANT BROKEN; FIX YOUR CODE
 
 At least one of Children or Runner must be specified.`, cmdPath)
 		return errors.New(msg)
-	case hasC && hasR && (cmd.ArgsName != "" || cmd.ArgsLong != ""):
+	case hasC && hasR && (cmd.ArgsName != "" || cmd.ArgsLong != "" || len(cmd.PositionalArgs) > 0):
 		msg := fmt.Sprintf(`%v: CODE INVARIANT BROKEN; FIX YOUR CODE
 
 Since both Children and Runner are specified, the Runner cannot take args.
 Otherwise a conflict between child names and runner args is possible.`, cmdPath)
 		return errors.New(msg)
 	}
+	// Check that NoBuiltinFlags is only set on the root command.
+	if cmd.NoBuiltinFlags && len(path) > 1 {
+		msg := fmt.Sprintf(`%v: CODE INVARIANT BROKEN; FIX YOUR CODE
+
+NoBuiltinFlags may only be set on the root command.`, cmdPath)
+		return errors.New(msg)
+	}
+	// Check that unknown flags can't be mistaken for child names.
+	if cmd.PassUnknownFlags && len(cmd.Children) > 0 {
+		msg := fmt.Sprintf(`%v: CODE INVARIANT BROKEN; FIX YOUR CODE
+
+PassUnknownFlags cannot be set on a command with Children.`, cmdPath)
+		return errors.New(msg)
+	}
+	// Check that ParseArgs is only set on commands that take args.
+	if cmd.ParseArgs != nil && cmd.Runner == nil {
+		msg := fmt.Sprintf(`%v: CODE INVARIANT BROKEN; FIX YOUR CODE
+
+ParseArgs cannot be set on a command without a Runner.`, cmdPath)
+		return errors.New(msg)
+	}
+	// Check that positional args don't conflict with ArgsName / ArgsLong, and are
+	// well-formed.
+	if len(cmd.PositionalArgs) > 0 && (cmd.ArgsName != "" || cmd.ArgsLong != "") {
+		msg := fmt.Sprintf(`%v: CODE INVARIANT BROKEN; FIX YOUR CODE
+
+At most one of PositionalArgs and ArgsName / ArgsLong may be specified.`, cmdPath)
+		return errors.New(msg)
+	}
+	for ax, arg := range cmd.PositionalArgs {
+		if arg.Name == "" {
+			msg := fmt.Sprintf(`%v: CODE INVARIANT BROKEN; FIX YOUR CODE
+
+Positional arg names cannot be empty.`, cmdPath)
+			return errors.New(msg)
+		}
+		if arg.Required && ax > 0 && !cmd.PositionalArgs[ax-1].Required {
+			msg := fmt.Sprintf(`%v: CODE INVARIANT BROKEN; FIX YOUR CODE
+
+Required positional arg %q cannot follow an optional arg.`, cmdPath, arg.Name)
+			return errors.New(msg)
+		}
+	}
+	// Check that flag completions are only specified for defined flags.
+	for name := range cmd.FlagCompletions {
+		if cmd.Flags.Lookup(name) == nil {
+			msg := fmt.Sprintf(`%v: CODE INVARIANT BROKEN; FIX YOUR CODE
+
+FlagCompletions specified for undefined flag %q.`, cmdPath, name)
+			return errors.New(msg)
+		}
+	}
+	// Check that deprecation messages are only specified for defined flags.
+	for name := range cmd.DeprecatedFlags {
+		if cmd.Flags.Lookup(name) == nil {
+			msg := fmt.Sprintf(`%v: CODE INVARIANT BROKEN; FIX YOUR CODE
+
+DeprecatedFlags specified for undefined flag %q.`, cmdPath, name)
+			return errors.New(msg)
+		}
+	}
+	// Check that required flags are defined.
+	for _, name := range cmd.RequiredFlags {
+		if cmd.Flags.Lookup(name) == nil {
+			msg := fmt.Sprintf(`%v: CODE INVARIANT BROKEN; FIX YOUR CODE
+
+RequiredFlags specified for undefined flag %q.`, cmdPath, name)
+			return errors.New(msg)
+		}
+	}
+	// Check that shorthands are only specified for defined flags, and are
+	// distinct from each other and from the flag names.
+	shorthands := make(map[string]bool)
+	for name, short := range cmd.FlagShorthands {
+		var problem string
+		switch {
+		case cmd.Flags.Lookup(name) == nil:
+			problem = fmt.Sprintf("FlagShorthands specified for undefined flag %q.", name)
+		case short == "":
+			problem = fmt.Sprintf("FlagShorthands specified empty shorthand for flag %q.", name)
+		case cmd.Flags.Lookup(short) != nil:
+			problem = fmt.Sprintf("FlagShorthands shorthand %q for flag %q collides with a flag.", short, name)
+		case shorthands[short]:
+			problem = fmt.Sprintf("FlagShorthands shorthand %q specified for multiple flags.", short)
+		}
+		if problem != "" {
+			return fmt.Errorf("%v: CODE INVARIANT BROKEN; FIX YOUR CODE\n\n%s", cmdPath, problem)
+		}
+		shorthands[short] = true
+	}
 	// Check recursively for all children
 	for _, child := range cmd.Children {
 		if err := checkTreeInvariants(append(path, child), env); err != nil {
@@ -373,16 +799,17 @@ func pathName(prefix string, path []*Command) string {
 }
 
 // nolint: gocyclo
-func (cmd *Command) parse(path []*Command, env *Env, args []string, setFlags map[string]string) (Runner, []string, error) {
+func (cmd *Command) parse(path []*Command, env *Env, args []string, setFlags map[string]string, reentrant bool) (Runner, []string, error) {
 	path = append(path, cmd)
 	cmdPath := pathName(env.prefix(), path)
 	runHelp := makeHelpRunner(path, env)
 	env.Usage = runHelp.usageFunc
 	// Parse flags and retrieve the args remaining after the parse, as well as the
 	// flags that were set.
-	args, setF, err := parseFlags(path, env, args)
+	args, setF, err := parseFlags(path, env, args, reentrant)
 	switch {
 	case err == flag.ErrHelp:
+		runHelp.helpFlag = true
 		return runHelp, nil, nil
 	case err != nil:
 		return nil, nil, env.UsageErrorf("%s: %v", cmdPath, err)
@@ -390,10 +817,14 @@ func (cmd *Command) parse(path []*Command, env *Env, args []string, setFlags map
 	for key, val := range setF {
 		setFlags[key] = val
 	}
+	warnDeprecatedFlags(path, env, setF)
 	// First handle the no-args case.
 	if len(args) == 0 {
 		if cmd.Runner != nil {
-			return cmd.Runner, nil, nil
+			if err := checkRequiredFlags(path, cmdPath, env, setFlags); err != nil {
+				return nil, nil, err
+			}
+			return cmd.runnerArgs(cmdPath, env, nil)
 		}
 		return nil, nil, env.UsageErrorf("%s: no command specified", cmdPath)
 	}
@@ -402,13 +833,13 @@ func (cmd *Command) parse(path []*Command, env *Env, args []string, setFlags map
 	subName, subArgs := args[0], args[1:]
 	if len(cmd.Children) > 0 {
 		for _, child := range cmd.Children {
-			if child.Name == subName {
-				return child.parse(path, env, subArgs, setFlags)
+			if child.matches(subName) {
+				return child.parse(path, env, subArgs, setFlags, reentrant)
 			}
 		}
-		// Every non-leaf command gets a default help command.
-		if helpName == subName {
-			return runHelp.newCommand().parse(path, env, subArgs, setFlags)
+		// Every non-leaf command gets a default help command, unless NoHelp is set.
+		if helpName == subName && !cmd.NoHelp {
+			return runHelp.newCommand().parse(path, env, subArgs, setFlags, reentrant)
 		}
 	}
 	if cmd.LookPath {
@@ -421,10 +852,10 @@ func (cmd *Command) parse(path []*Command, env *Env, args []string, setFlags map
 	// No matching subcommands, check various error cases.
 	switch {
 	case cmd.Runner == nil:
-		return nil, nil, env.UsageErrorf("%s: unknown command %q", cmdPath, subName)
-	case cmd.ArgsName == "":
+		return nil, nil, cmd.unknownCommandError(env, cmdPath, subName)
+	case cmd.argsName() == "":
 		if len(cmd.Children) > 0 {
-			return nil, nil, env.UsageErrorf("%s: unknown command %q", cmdPath, subName)
+			return nil, nil, cmd.unknownCommandError(env, cmdPath, subName)
 		}
 		return nil, nil, env.UsageErrorf("%s: doesn't take arguments", cmdPath)
 	case reflect.DeepEqual(args, []string{helpName, "..."}):
@@ -432,10 +863,166 @@ func (cmd *Command) parse(path []*Command, env *Env, args []string, setFlags map
 	}
 	// INVARIANT:
 	// cmd.Runner != nil && len(args) > 0 &&
-	// cmd.ArgsName != "" && args != []string{"help", "..."}
+	// cmd.argsName() != "" && args != []string{"help", "..."}
+	if err := checkRequiredFlags(path, cmdPath, env, setFlags); err != nil {
+		return nil, nil, err
+	}
+	return cmd.runnerArgs(cmdPath, env, args)
+}
+
+// unknownCommandError returns a usage error for the unknown subcommand subName
+// of cmd.  If subName is a near miss of a child name, the error suggests it.
+func (cmd *Command) unknownCommandError(env *Env, cmdPath, subName string) error {
+	if suggestion := cmd.suggestChild(subName); suggestion != "" {
+		return env.UsageErrorf("%s: unknown command %q\nDid you mean %q?", cmdPath, subName, suggestion)
+	}
+	return env.UsageErrorf("%s: unknown command %q", cmdPath, subName)
+}
+
+// maxSuggestDistance is the maximum edit distance between an unknown subcommand
+// and a child name for the child to be suggested.
+const maxSuggestDistance = 2
+
+// suggestChild returns the visible child name or alias, or "help", that is
+// closest to name, or "" if none is close enough.  Ties are broken in favor of
+// the earliest child.
+func (cmd *Command) suggestChild(name string) string {
+	var candidates []string
+	for _, child := range cmd.visibleChildren() {
+		candidates = append(candidates, child.Name)
+		candidates = append(candidates, child.Aliases...)
+	}
+	if needsHelpChild(cmd) {
+		candidates = append(candidates, helpName)
+	}
+	best, bestDist := "", maxSuggestDistance+1
+	for _, c := range candidates {
+		// Require the distance to be less than the length of name, so that short
+		// names aren't matched to unrelated names, e.g. "ls" to "rm".
+		if d := levenshtein(name, c); d < bestDist && d < len(name) {
+			best, bestDist = c, d
+		}
+	}
+	return best
+}
+
+// levenshtein returns the minimum number of single-rune insertions, deletions
+// and substitutions needed to change a into b.
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min3(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
+// checkRequiredFlags returns a usage error if any of the RequiredFlags that
+// apply to the last command in path isn't in setFlags.
+func checkRequiredFlags(path []*Command, cmdPath string, env *Env, setFlags map[string]string) error {
+	for _, cmd := range flagsPath(path) {
+		for _, name := range cmd.RequiredFlags {
+			if _, ok := setFlags[name]; !ok {
+				return env.UsageErrorf("%s: required flag -%s not set", cmdPath, name)
+			}
+		}
+	}
+	return nil
+}
+
+// runnerArgs returns cmd.Runner along with the args to pass to it, after
+// checking and transforming the args via PositionalArgs and ParseArgs.
+func (cmd *Command) runnerArgs(cmdPath string, env *Env, args []string) (Runner, []string, error) {
+	if err := cmd.checkPositionalArgs(cmdPath, env, args); err != nil {
+		return nil, nil, err
+	}
+	if cmd.ParseArgs != nil {
+		var err error
+		if args, err = cmd.ParseArgs(args); err != nil {
+			if _, ok := err.(ErrExitCode); ok {
+				return nil, nil, err
+			}
+			return nil, nil, env.UsageErrorf("%s: %v", cmdPath, err)
+		}
+	}
 	return cmd.Runner, args, nil
 }
 
+// checkPositionalArgs returns a usage error if the number of args doesn't match
+// cmd.PositionalArgs.  It does nothing if PositionalArgs isn't specified.
+func (cmd *Command) checkPositionalArgs(cmdPath string, env *Env, args []string) error {
+	if len(cmd.PositionalArgs) == 0 {
+		return nil
+	}
+	if len(args) > len(cmd.PositionalArgs) {
+		return env.UsageErrorf("%s: too many arguments: got %d, want at most %d", cmdPath, len(args), len(cmd.PositionalArgs))
+	}
+	for _, arg := range cmd.PositionalArgs[len(args):] {
+		if arg.Required {
+			return env.UsageErrorf("%s: missing argument %s", cmdPath, arg.usage())
+		}
+	}
+	return nil
+}
+
+// argsName returns cmd.ArgsName, or the name generated from cmd.PositionalArgs.
+func (cmd *Command) argsName() string {
+	if len(cmd.PositionalArgs) == 0 {
+		return cmd.ArgsName
+	}
+	names := make([]string, len(cmd.PositionalArgs))
+	for ax, arg := range cmd.PositionalArgs {
+		names[ax] = arg.usage()
+	}
+	return strings.Join(names, " ")
+}
+
+// argsLong returns cmd.ArgsLong, or the description generated from
+// cmd.PositionalArgs, with a heading followed by one aligned line per arg.  Each
+// arg line is indented so that it isn't joined with the next line when wrapped.
+func (cmd *Command) argsLong(cmdPath string) string {
+	if len(cmd.PositionalArgs) == 0 {
+		return cmd.ArgsLong
+	}
+	width := 0
+	for _, arg := range cmd.PositionalArgs {
+		if x := len(arg.usage()); x > width {
+			width = x
+		}
+	}
+	lines := []string{"The " + cmdPath + " args are:"}
+	for _, arg := range cmd.PositionalArgs {
+		line := "   " + arg.usage()
+		if arg.Description != "" {
+			line = fmt.Sprintf("   %-*s - %s", width, arg.usage(), arg.Description)
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
 func (cmd *Command) registerFlagDefs() error {
 	if fs := cmd.FlagDefs.Flags; fs != nil {
 		err := flagvar.RegisterFlagsInStruct(&cmd.Flags, "cmdline", fs, cmd.FlagDefs.ValueDefaults, cmd.FlagDefs.UsageDefaults)
@@ -452,12 +1039,16 @@ func (cmd *Command) registerFlagDefs() error {
 }
 
 // parseFlags parses the flags from args for the command with the given path and
-// env.  Returns the remaining non-flag args and the flags that were set.
-func parseFlags(path []*Command, env *Env, args []string) ([]string, map[string]string, error) {
+// env.  Returns the remaining non-flag args and the flags that were set.  If
+// reentrant is true, flag.CommandLine is never used for parsing.
+func parseFlags(path []*Command, env *Env, args []string, reentrant bool) ([]string, map[string]string, error) {
 	cmd, isRoot := path[len(path)-1], len(path) == 1
+	useCommandLine := isRoot && !reentrant && !cmd.NoBuiltinFlags
+	global := pathGlobalFlags(path)
 	// Parse the merged command-specific and global flags.
 	var flags *flag.FlagSet
-	if isRoot {
+	switch {
+	case useCommandLine:
 		// The root command is special, due to the pitfall described above in the
 		// package doc.  Merge into flag.CommandLine and use that for parsing.  This
 		// ensures that subsequent calls to flag.Parsed will return true, so the
@@ -465,10 +1056,15 @@ func parseFlags(path []*Command, env *Env, args []string) ([]string, map[string]
 		// precedence over command flags for the root command.
 		flags = flag.CommandLine
 		mergeFlags(flags, &cmd.Flags)
-	} else {
+	case isRoot:
+		// Global flags still take precedence over command flags for the root
+		// command, but we parse a copy rather than flag.CommandLine.
+		flags = copyFlags(global)
+		mergeFlags(flags, &cmd.Flags)
+	default:
 		// Command flags take precedence over global flags for non-root commands.
 		flags = pathFlags(path)
-		mergeFlags(flags, globalFlags)
+		mergeFlags(flags, global)
 	}
 	// Silence the many different ways flags.Parse can produce ugly output; we
 	// just want it to return any errors and handle the output ourselves.
@@ -478,21 +1074,113 @@ func parseFlags(path []*Command, env *Env, args []string) ([]string, map[string]
 	flags.Init(cmd.Name, flag.ContinueOnError)
 	flags.SetOutput(io.Discard)
 	flags.Usage = func() {}
-	if isRoot {
+	if useCommandLine {
 		// If this is the root command, we must remember to undo the above changes
 		// on flag.CommandLine after the parse.  We don't know the original settings
 		// of these values, so we just blindly set back to the default values.
 		defer func() {
 			flags.Init(cmd.Name, flag.ExitOnError)
 			flags.SetOutput(nil)
-			flags.Usage = func() { env.Usage(env, env.Stderr) }
+			flags.Usage = func() { env.Usage(env, env.helpOutput(env.Stderr)) }
 		}()
 	}
+	// Replace the shorthands in args with the full flag names, rather than
+	// registering them as flags, since flag.CommandLine is never reset.  A flag
+	// with the same name as a shorthand takes precedence.
+	defined := flags
+	if useCommandLine {
+		defined = copyFlags(global)
+		mergeFlags(defined, &cmd.Flags)
+	}
+	shorthands := make(map[string]string)
+	for name, short := range pathShorthands(path) {
+		if defined.Lookup(name) != nil && defined.Lookup(short) == nil {
+			shorthands[short] = name
+		}
+	}
+	args = expandShorthands(flags, shorthands, args)
+	var unknown []string
+	if cmd.PassUnknownFlags {
+		args, unknown = splitUnknownFlags(flags, args)
+	}
 	if err := flags.Parse(args); err != nil {
 		return nil, nil, err
 	}
 	cmd.ParsedFlags = flags
-	return flags.Args(), extractSetFlags(flags), nil
+	setFlags := extractSetFlags(flags)
+	if len(unknown) > 0 {
+		return append(unknown, flags.Args()...), setFlags, nil
+	}
+	return flags.Args(), setFlags, nil
+}
+
+// splitUnknownFlags splits the leading flags in args into those that are
+// defined in flags, followed by the remaining non-flag args, and those that
+// aren't defined, for Command.PassUnknownFlags.  Since there's no way to tell
+// whether an unknown flag takes a value, the value of an unknown flag must be
+// specified in the same arg, e.g. "-foo=bar".
+func splitUnknownFlags(flags *flag.FlagSet, args []string) (known, unknown []string) {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if len(arg) < 2 || arg[0] != '-' || arg == "--" {
+			// Flag parsing stops at the first non-flag arg, or after "--".
+			return append(known, args[i:]...), unknown
+		}
+		name, hasValue := strings.TrimPrefix(arg[1:], "-"), false
+		if eq := strings.Index(name, "="); eq >= 0 {
+			name, hasValue = name[:eq], true
+		}
+		f := flags.Lookup(name)
+		switch {
+		case f == nil && name != "help" && name != "h":
+			unknown = append(unknown, arg)
+		case f != nil && !hasValue && !isBoolFlag(f) && i+1 < len(args):
+			// The next arg is the value of this flag.
+			known = append(known, arg, args[i+1])
+			i++
+		default:
+			known = append(known, arg)
+		}
+	}
+	return known, unknown
+}
+
+// expandShorthands returns args with each of the leading flags that is named by
+// a shorthand, which maps to the full flag name, renamed to the full flag name.
+func expandShorthands(flags *flag.FlagSet, shorthands map[string]string, args []string) []string {
+	if len(shorthands) == 0 {
+		return args
+	}
+	expanded := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if len(arg) < 2 || arg[0] != '-' || arg == "--" {
+			// Flag parsing stops at the first non-flag arg, or after "--".
+			return append(expanded, args[i:]...)
+		}
+		dashes, name, value := "-", arg[1:], ""
+		if strings.HasPrefix(name, "-") {
+			dashes, name = "--", name[1:]
+		}
+		if eq := strings.Index(name, "="); eq >= 0 {
+			name, value = name[:eq], name[eq:]
+		}
+		if full, ok := shorthands[name]; ok {
+			name, arg = full, dashes+full+value
+		}
+		expanded = append(expanded, arg)
+		if f := flags.Lookup(name); f != nil && value == "" && !isBoolFlag(f) && i+1 < len(args) {
+			// The next arg is the value of this flag.
+			expanded = append(expanded, args[i+1])
+			i++
+		}
+	}
+	return expanded
+}
+
+func isBoolFlag(f *flag.Flag) bool {
+	bf, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && bf.IsBoolFlag()
 }
 
 func mergeFlags(dst, src *flag.FlagSet) {
@@ -512,27 +1200,71 @@ func copyFlags(flags *flag.FlagSet) *flag.FlagSet {
 	return cp
 }
 
-// pathFlags returns the flags that are allowed for the last command in the
-// path.  Flags defined on ancestors are also allowed, except on "help".
-func pathFlags(path []*Command) *flag.FlagSet {
+// copyFlagsExcept is like copyFlags, but omits the flags with the given names.
+func copyFlagsExcept(flags *flag.FlagSet, names []string) *flag.FlagSet {
+	cp := new(flag.FlagSet)
+	flags.VisitAll(func(f *flag.Flag) {
+		for _, name := range names {
+			if f.Name == name {
+				return
+			}
+		}
+		cp.Var(f.Value, f.Name, f.Usage)
+		cp.Lookup(f.Name).DefValue = f.DefValue
+	})
+	return cp
+}
+
+// flagsPath returns the commands whose flags are allowed for the last command
+// in the path, starting with the last command, which takes precedence.  Flags
+// defined on ancestors are also allowed, except on "help".
+func flagsPath(path []*Command) []*Command {
 	cmd := path[len(path)-1]
-	flags := copyFlags(&cmd.Flags)
+	cmds := []*Command{cmd}
 	if cmd.Name != helpName && !cmd.DontInheritFlags {
-		// Walk backwards to merge flags up to the root command.  If this takes too
-		// long, we could consider memoizing previous results.
+		// Walk backwards up to the root command.  If this takes too long, we could
+		// consider memoizing previous results.
 		for p := len(path) - 2; p >= 0; p-- {
 			if path[p].DontPropagateFlags {
 				break
 			}
-			mergeFlags(flags, &path[p].Flags)
+			cmds = append(cmds, path[p])
 			if path[p].DontInheritFlags {
 				break
 			}
 		}
 	}
+	return cmds
+}
+
+// pathFlags returns the flags that are allowed for the last command in the
+// path.
+func pathFlags(path []*Command) *flag.FlagSet {
+	cmds := flagsPath(path)
+	flags := copyFlags(&cmds[0].Flags)
+	for _, cmd := range cmds[1:] {
+		mergeFlags(flags, &cmd.Flags)
+	}
 	return flags
 }
 
+// pathShorthands returns the FlagShorthands that are allowed for the last
+// command in the path, mapping each flag name to its shorthand.
+func pathShorthands(path []*Command) map[string]string {
+	shorthands := make(map[string]string)
+	used := make(map[string]bool)
+	for _, cmd := range flagsPath(path) {
+		for name, short := range cmd.FlagShorthands {
+			// As with the flags, the closest command wins any collisions.
+			if _, ok := shorthands[name]; !ok && !used[short] {
+				shorthands[name] = short
+				used[short] = true
+			}
+		}
+	}
+	return shorthands
+}
+
 func extractSetFlags(flags *flag.FlagSet) map[string]string {
 	// Use FlagSet.Visit rather than VisitAll to restrict to flags that are set.
 	setFlags := make(map[string]string)
@@ -542,6 +1274,28 @@ func extractSetFlags(flags *flag.FlagSet) map[string]string {
 	return setFlags
 }
 
+// warnDeprecatedFlags writes a warning to env.Stderr for each of the set flags
+// that is deprecated by the last command in path, or by the closest ancestor
+// that defines the flag.
+func warnDeprecatedFlags(path []*Command, env *Env, setFlags map[string]string) {
+	var names []string
+	for name := range setFlags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for p := len(path) - 1; p >= 0; p-- {
+			if path[p].Flags.Lookup(name) == nil {
+				continue
+			}
+			if msg, ok := path[p].DeprecatedFlags[name]; ok {
+				fmt.Fprintf(env.Stderr, "WARNING: -%s is deprecated: %s\n", name, msg)
+			}
+			break
+		}
+	}
+}
+
 func flagsAsArgs(x map[string]string) []string {
 	var args []string
 	for key, val := range x {
@@ -557,10 +1311,46 @@ func (cmd *Command) subNames(prefix string) map[string]bool {
 	m := map[string]bool{prefix + "help": true}
 	for _, child := range cmd.Children {
 		m[prefix+child.Name] = true
+		for _, alias := range child.Aliases {
+			m[prefix+alias] = true
+		}
 	}
 	return m
 }
 
+// visibleChildren returns the children of cmd that aren't Hidden.
+func (cmd *Command) visibleChildren() []*Command {
+	var children []*Command
+	for _, child := range cmd.Children {
+		if !child.Hidden {
+			children = append(children, child)
+		}
+	}
+	return children
+}
+
+// matches returns true iff name is the name or one of the aliases of cmd.
+func (cmd *Command) matches(name string) bool {
+	if cmd.Name == name {
+		return true
+	}
+	for _, alias := range cmd.Aliases {
+		if alias == name {
+			return true
+		}
+	}
+	return false
+}
+
+// displayName returns the name of cmd as shown in the help of its parent,
+// followed by its aliases in parentheses, e.g. "remove (rm, del)".
+func (cmd *Command) displayName() string {
+	if len(cmd.Aliases) == 0 {
+		return cmd.Name
+	}
+	return cmd.Name + " (" + strings.Join(cmd.Aliases, ", ") + ")"
+}
+
 // ErrExitCode may be returned by Runner.Run to cause the program to exit with a
 // specific error code.
 type ErrExitCode int
@@ -577,24 +1367,41 @@ const ErrUsage = ErrExitCode(2)
 // ExitCode returns the exit code corresponding to err.
 //
 //	0:    if err == nil
-//	code: if err is ErrExitCode(code)
+//	code: if err is ErrExitCode(code), or the exit code of an external child
+//	      command run via LookPath or ImportCommand
 //	1:    all other errors
 //
-// Writes the error message for "all other errors" to w, if w is non-nil.
+// Writes the error message to w, if w is non-nil, except for ErrUsage, since
+// a message has already been written by Env.UsageErrorf, ErrExitCode(0), and
+// the exit code of an external child command, since the child has already
+// written its own error output.
 func ExitCode(err error, w io.Writer) int {
 	if err == nil {
 		return 0
 	}
-	if code, ok := err.(ErrExitCode); ok {
-		return int(code)
+	if child, ok := err.(childExitError); ok {
+		// We don't print "ERROR: exit code N" to avoid cluttering the output.
+		return int(child.code)
 	}
-	if w != nil {
-		// We don't print "ERROR: exit code N" above to avoid cluttering the output.
+	code, ok := err.(ErrExitCode)
+	if !ok {
+		code = 1
+	}
+	if w != nil && code != ErrUsage && code != 0 {
 		fmt.Fprintf(w, "ERROR: %v\n", err)
 	}
-	return 1
+	return int(code)
+}
+
+// childExitError is returned by binaryRunner when the external child command
+// exits with a non-zero exit code.
+type childExitError struct {
+	code ErrExitCode
 }
 
+func (e childExitError) Error() string { return e.code.Error() }
+func (e childExitError) Unwrap() error { return e.code }
+
 type binaryRunner struct {
 	subCmd  string
 	cmdPath string
@@ -614,7 +1421,7 @@ func (b binaryRunner) Run(env *Env, args []string) error {
 	// Make sure we return the exit code from the binary, if it exited.
 	if exitError, ok := err.(*exec.ExitError); ok {
 		if status, ok := exitError.Sys().(syscall.WaitStatus); ok {
-			return ErrExitCode(status.ExitStatus())
+			return childExitError{ErrExitCode(status.ExitStatus())}
 		}
 	}
 	return err
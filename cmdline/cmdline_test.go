@@ -6,9 +6,11 @@ package cmdline
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -17,6 +19,7 @@ import (
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"v.io/x/lib/envvar"
 	"v.io/x/lib/lookpath"
@@ -468,6 +471,7 @@ The cmdrun help flags are:
       full      - Good for cmdline output, shows all global flags.
       godoc     - Good for godoc processing.
       shortonly - Only output short description.
+      json      - Machine-readable command tree, as used by ImportCommand.
    Override the default by setting the CMDLINE_STYLE environment variable.
  -width=80
    Format output to this target width in runes, or unlimited if width < 0.
@@ -647,6 +651,7 @@ The onecmd help flags are:
       full      - Good for cmdline output, shows all global flags.
       godoc     - Good for godoc processing.
       shortonly - Only output short description.
+      json      - Machine-readable command tree, as used by ImportCommand.
    Override the default by setting the CMDLINE_STYLE environment variable.
  -width=80
    Format output to this target width in runes, or unlimited if width < 0.
@@ -707,6 +712,7 @@ The onecmd help flags are:
       full      - Good for cmdline output, shows all global flags.
       godoc     - Good for godoc processing.
       shortonly - Only output short description.
+      json      - Machine-readable command tree, as used by ImportCommand.
    Override the default by setting the CMDLINE_STYLE environment variable.
  -width=80
    Format output to this target width in runes, or unlimited if width < 0.
@@ -921,6 +927,7 @@ The multi help flags are:
       full      - Good for cmdline output, shows all global flags.
       godoc     - Good for godoc processing.
       shortonly - Only output short description.
+      json      - Machine-readable command tree, as used by ImportCommand.
    Override the default by setting the CMDLINE_STYLE environment variable.
  -width=80
    Format output to this target width in runes, or unlimited if width < 0.
@@ -1322,6 +1329,7 @@ The toplevelprog help flags are:
       full      - Good for cmdline output, shows all global flags.
       godoc     - Good for godoc processing.
       shortonly - Only output short description.
+      json      - Machine-readable command tree, as used by ImportCommand.
    Override the default by setting the CMDLINE_STYLE environment variable.
  -width=80
    Format output to this target width in runes, or unlimited if width < 0.
@@ -1452,6 +1460,7 @@ The toplevelprog echoprog help flags are:
       full      - Good for cmdline output, shows all global flags.
       godoc     - Good for godoc processing.
       shortonly - Only output short description.
+      json      - Machine-readable command tree, as used by ImportCommand.
    Override the default by setting the CMDLINE_STYLE environment variable.
  -width=80
    Format output to this target width in runes, or unlimited if width < 0.
@@ -1889,6 +1898,7 @@ The prog1 help flags are:
       full      - Good for cmdline output, shows all global flags.
       godoc     - Good for godoc processing.
       shortonly - Only output short description.
+      json      - Machine-readable command tree, as used by ImportCommand.
    Override the default by setting the CMDLINE_STYLE environment variable.
  -width=80
    Format output to this target width in runes, or unlimited if width < 0.
@@ -1983,6 +1993,7 @@ The prog1 prog2 help flags are:
       full      - Good for cmdline output, shows all global flags.
       godoc     - Good for godoc processing.
       shortonly - Only output short description.
+      json      - Machine-readable command tree, as used by ImportCommand.
    Override the default by setting the CMDLINE_STYLE environment variable.
  -width=80
    Format output to this target width in runes, or unlimited if width < 0.
@@ -2047,6 +2058,7 @@ The prog1 prog2 prog3 help flags are:
       full      - Good for cmdline output, shows all global flags.
       godoc     - Good for godoc processing.
       shortonly - Only output short description.
+      json      - Machine-readable command tree, as used by ImportCommand.
    Override the default by setting the CMDLINE_STYLE environment variable.
  -width=80
    Format output to this target width in runes, or unlimited if width < 0.
@@ -2111,6 +2123,7 @@ The prog1 prog2 prog3 help flags are:
       full      - Good for cmdline output, shows all global flags.
       godoc     - Good for godoc processing.
       shortonly - Only output short description.
+      json      - Machine-readable command tree, as used by ImportCommand.
    Override the default by setting the CMDLINE_STYLE environment variable.
  -width=80
    Format output to this target width in runes, or unlimited if width < 0.
@@ -2234,6 +2247,7 @@ The prog1 help flags are:
       full      - Good for cmdline output, shows all global flags.
       godoc     - Good for godoc processing.
       shortonly - Only output short description.
+      json      - Machine-readable command tree, as used by ImportCommand.
    Override the default by setting the CMDLINE_STYLE environment variable.
  -width=<terminal width>
    Format output to this target width in runes, or unlimited if width < 0.
@@ -2305,6 +2319,105 @@ The global flags are:
 	runTestCases(t, prog, tests)
 }
 
+func TestLongFunc(t *testing.T) {
+	calls := 0
+	child := &Command{
+		Name:  "child",
+		Short: "description of child.",
+		LongFunc: func() string {
+			calls++
+			return "\nThe long description of child, loaded lazily.\n"
+		},
+		Runner: RunnerFunc(runEcho),
+	}
+	prog := &Command{
+		Name:     "program",
+		Short:    "Test long descriptions from functions.",
+		Long:     "Test long descriptions from functions.",
+		LongFunc: func() string { return "Ignored since Long is set." },
+		Children: []*Command{child},
+	}
+	var tests = []testCase{
+		{
+			Args:   []string{"child"},
+			Stdout: "[]\n",
+		},
+		{
+			Args: []string{"help"},
+			Stdout: `Test long descriptions from functions.
+
+Usage:
+   program [flags] <command>
+
+The program commands are:
+   child       description of child.
+   help        Display help for commands or topics
+Run "program help [command]" for command usage.
+
+The global flags are:
+ -global1=
+   global test flag 1
+ -global2=0
+   global test flag 2
+`,
+		},
+		{
+			Args: []string{"help", "child"},
+			Stdout: `The long description of child, loaded lazily.
+
+Usage:
+   program child [flags]
+
+The global flags are:
+ -global1=
+   global test flag 1
+ -global2=0
+   global test flag 2
+`,
+		},
+	}
+	runTestCases(t, prog, tests)
+	// LongFunc is only called when showing the help for child.
+	if got, want := calls, 1; got != want {
+		t.Errorf("got %d calls, want %d", got, want)
+	}
+}
+
+func TestHelpSeparator(t *testing.T) {
+	prog := &Command{
+		Name:     "program",
+		Short:    "Test help separators.",
+		Long:     "Test help separators.",
+		Children: []*Command{{Name: "child", Short: "Child.", Long: "Child.", Runner: RunnerFunc(runEcho)}},
+	}
+	tests := []struct {
+		vars      map[string]string
+		separator string
+	}{
+		{nil, strings.Repeat("=", 80)},
+		{map[string]string{"CMDLINE_SEPARATOR": "-="}, strings.Repeat("-=", 40)},
+		{map[string]string{"CMDLINE_SEPARATOR": "~", "CMDLINE_WIDTH": "10"}, strings.Repeat("~", 10)},
+		{map[string]string{"CMDLINE_SEPARATOR": ""}, ""},
+	}
+	for _, test := range tests {
+		flag.CommandLine = flag.NewFlagSet("test", flag.ContinueOnError)
+		var stdout bytes.Buffer
+		env := &Env{Stdout: &stdout, Stderr: &stdout, Vars: envvar.MergeMaps(baseVars, test.vars)}
+		if err := ParseAndRun(prog, env, []string{"help", "..."}); err != nil {
+			t.Fatalf("%v: %v", test.vars, err)
+		}
+		got := stdout.String()
+		// Each of the child and help commands is preceded by a separator line.
+		want := "\n" + test.separator + "\nProgram child\n"
+		if !strings.Contains(got, want) {
+			t.Errorf("%v: got %q, want substring %q", test.vars, got, want)
+		}
+		if test.separator == "" && strings.Contains(got, "=====") {
+			t.Errorf("%v: got %q, want no separator", test.vars, got)
+		}
+	}
+}
+
 func TestHideGlobalFlags(t *testing.T) {
 	HideGlobalFlagsExcept(regexp.MustCompile(`^global2$`))
 	cmdChild := &Command{
@@ -2437,6 +2550,243 @@ The global flags are:
 	nonHiddenGlobalFlags = nil
 }
 
+func TestOmitZeroFlagValues(t *testing.T) {
+	cmdChild := &Command{
+		Name:   "child",
+		Short:  "description of child command.",
+		Long:   "blah blah blah",
+		Runner: RunnerFunc(runEcho),
+	}
+	cmdChild.Flags.Bool("cbool", false, "cbool desc")
+	cmdChild.Flags.Int("cint", 3, "cint desc")
+	prog := &Command{
+		Name:               "program",
+		Short:              "Test omitting zero flag values.",
+		Long:               "Test omitting zero flag values.",
+		Children:           []*Command{cmdChild},
+		OmitZeroFlagValues: true,
+	}
+	prog.Flags.String("pstring", "", "pstring desc")
+	var tests = []testCase{
+		{
+			Args: []string{"help", "child"},
+			Stdout: `blah blah blah
+
+Usage:
+   program child [flags]
+
+The program child flags are:
+ -cbool
+   cbool desc
+ -cint=3
+   cint desc
+
+The global flags are:
+ -global1
+   global test flag 1
+ -global2
+   global test flag 2
+
+Run "program help -style=full child" to show all flags.
+`,
+		},
+		{
+			Args: []string{"help", "-style=full", "child"},
+			Stdout: `blah blah blah
+
+Usage:
+   program child [flags]
+
+The program child flags are:
+ -cbool
+   cbool desc
+ -cint=3
+   cint desc
+
+ -pstring
+   pstring desc
+
+The global flags are:
+ -global1
+   global test flag 1
+ -global2
+   global test flag 2
+`,
+		},
+		{
+			Args:   []string{"child", "-cbool"},
+			Stdout: "[]\n",
+		},
+	}
+	runTestCases(t, prog, tests)
+}
+
+// listFlag is a custom flag.Value whose String method renders a confusing
+// default, which is fixed by implementing DefaultStringer.
+type listFlag struct {
+	values *[]string
+}
+
+func (f listFlag) String() string {
+	if f.values == nil {
+		return "<nil>"
+	}
+	return strings.Join(*f.values, ",")
+}
+
+func (f listFlag) Set(v string) error {
+	*f.values = append(*f.values, v)
+	return nil
+}
+
+type defaultListFlag struct {
+	listFlag
+}
+
+func (f defaultListFlag) DefaultString() string {
+	if f.values == nil || len(*f.values) == 0 {
+		return "<none>"
+	}
+	return f.String()
+}
+
+func TestDefaultStringer(t *testing.T) {
+	var list []string
+	child := &Command{
+		Name:   "child",
+		Short:  "description of child.",
+		Long:   "blah blah blah",
+		Runner: RunnerFunc(runEcho),
+	}
+	child.Flags.Var(listFlag{}, "list1", "list1 desc")
+	child.Flags.Var(defaultListFlag{}, "list2", "list2 desc")
+	child.Flags.Var(defaultListFlag{listFlag{&list}}, "list3", "list3 desc")
+	prog := &Command{
+		Name:     "program",
+		Short:    "Test default strings.",
+		Long:     "Test default strings.",
+		Children: []*Command{child},
+	}
+	var tests = []testCase{
+		{
+			Args: []string{"help", "child"},
+			Stdout: `blah blah blah
+
+Usage:
+   program child [flags]
+
+The program child flags are:
+ -list1=<nil>
+   list1 desc
+ -list2=<none>
+   list2 desc
+ -list3=<none>
+   list3 desc
+
+The global flags are:
+ -global1=
+   global test flag 1
+ -global2=0
+   global test flag 2
+`,
+		},
+		{
+			Args: []string{"help", "-style=godoc", "child"},
+			Stdout: `blah blah blah
+
+Usage:
+   program child [flags]
+
+The program child flags are:
+ -list1=<nil>
+   list1 desc
+ -list2=<none>
+   list2 desc
+ -list3=<none>
+   list3 desc
+
+The global flags are:
+ -global1=
+   global test flag 1
+ -global2=0
+   global test flag 2
+`,
+		},
+	}
+	runTestCases(t, prog, tests)
+}
+
+func TestCommandGroups(t *testing.T) {
+	newChild := func(name, group string) *Command {
+		return &Command{
+			Name:   name,
+			Short:  "description of " + name + ".",
+			Long:   "blah blah blah",
+			Group:  group,
+			Runner: RunnerFunc(runEcho),
+		}
+	}
+	prog := &Command{
+		Name:  "program",
+		Short: "Test command groups.",
+		Long:  "Test command groups.",
+		Children: []*Command{
+			newChild("start", "Management Commands"),
+			newChild("version", ""),
+			newChild("stop", "Management Commands"),
+			newChild("fmt", "Utility Commands"),
+		},
+	}
+	var tests = []testCase{
+		{
+			Args: []string{"help"},
+			Stdout: `Test command groups.
+
+Usage:
+   program [flags] <command>
+
+The program commands are:
+   version     description of version.
+   help        Display help for commands or topics
+Management Commands:
+   start       description of start.
+   stop        description of stop.
+Utility Commands:
+   fmt         description of fmt.
+Run "program help [command]" for command usage.
+
+The global flags are:
+ -global1=
+   global test flag 1
+ -global2=0
+   global test flag 2
+`,
+		},
+		{
+			Args: []string{"help", "-style=godoc"},
+			Stdout: `Test command groups.
+
+Usage:
+   program [flags] <command>
+
+The program commands are:
+   start       description of start.
+   version     description of version.
+   stop        description of stop.
+   fmt         description of fmt.
+   help        Display help for commands or topics
+
+The global flags are:
+ -global1=
+   global test flag 1
+ -global2=0
+   global test flag 2
+`,
+		},
+	}
+	runTestCases(t, prog, tests)
+}
+
 func TestRootCommandFlags(t *testing.T) {
 	root := &Command{
 		Name:   "root",
@@ -2671,6 +3021,7 @@ The unlikely help flags are:
       full      - Good for cmdline output, shows all global flags.
       godoc     - Good for godoc processing.
       shortonly - Only output short description.
+      json      - Machine-readable command tree, as used by ImportCommand.
    Override the default by setting the CMDLINE_STYLE environment variable.
  -width=80
    Format output to this target width in runes, or unlimited if width < 0.
@@ -2805,6 +3156,7 @@ The unlikely help flags are:
       full      - Good for cmdline output, shows all global flags.
       godoc     - Good for godoc processing.
       shortonly - Only output short description.
+      json      - Machine-readable command tree, as used by ImportCommand.
    Override the default by setting the CMDLINE_STYLE environment variable.
  -width=<terminal width>
    Format output to this target width in runes, or unlimited if width < 0.
@@ -2973,6 +3325,21 @@ The global flags are:
 	}
 	tests = tests[:1]
 	runTestCases(t, cmd, tests)
+
+	// The exit code of the child is returned, but ExitCode doesn't repeat the
+	// error, since the child has already written it.
+	var stderr bytes.Buffer
+	env := &Env{Stdout: io.Discard, Stderr: &stderr, Vars: map[string]string{"PATH": strings.Join(tokens, string(os.PathListSeparator))}}
+	err = ParseAndRun(cmd, env, []string{"exitcode"})
+	if !errors.Is(err, ErrExitCode(42)) {
+		t.Errorf("got %v, want %v", err, ErrExitCode(42))
+	}
+	if got, want := ExitCode(err, &stderr), 42; got != want {
+		t.Errorf("got code %v, want %v", got, want)
+	}
+	if got, want := stderr.String(), "ERROR: exit code 42\n"; got != want {
+		t.Errorf("got stderr %q, want %q", got, want)
+	}
 }
 
 func TestParsedFlags(t *testing.T) {
@@ -3034,14 +3401,866 @@ func TestParsedFlags(t *testing.T) {
 	}
 }
 
-type fc struct {
-	DontPropagateFlags bool
-	DontInheritFlags   bool
+func TestResultRunner(t *testing.T) {
+	var ran []string
+	root := &Command{
+		Name:     "root",
+		Short:    "short",
+		Long:     "long.",
+		ArgsName: "[args]",
+		Runner: ResultRunnerFunc(func(_ *Env, args []string) (interface{}, error) {
+			ran = append(ran, args...)
+			return len(args), nil
+		}),
+	}
+	var stdout, stderr bytes.Buffer
+	env := &Env{Stdout: &stdout, Stderr: &stderr}
+	runner, args, err := Parse(root, env, []string{"a", "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr, ok := runner.(ResultRunner)
+	if !ok {
+		t.Fatalf("got %T, want a ResultRunner", runner)
+	}
+	result, err := rr.RunResult(env, args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := result, interface{}(2); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// ParseAndRun ignores the result.
+	if err := ParseAndRun(root, env, []string{"c"}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := ran, []string{"a", "b", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// Regular runners are not ResultRunners.
+	root.Runner = RunnerFunc(runHello)
+	if runner, _, err = Parse(root, env, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := runner.(ResultRunner); ok {
+		t.Errorf("%T should not be a ResultRunner", runner)
+	}
 }
 
-func TestFlagPropagation(t *testing.T) {
-	var err error
-	env := EnvFromOS()
+func TestContextRunner(t *testing.T) {
+	started := make(chan struct{})
+	root := &Command{
+		Name:  "root",
+		Short: "short",
+		Long:  "long.",
+		Runner: ContextRunnerFunc(func(ctx context.Context, env *Env, _ []string) error {
+			close(started)
+			<-ctx.Done()
+			return ctx.Err()
+		}),
+	}
+	var stdout, stderr bytes.Buffer
+	env := &Env{Stdout: &stdout, Stderr: &stderr}
+
+	// The runner observes cancellation of the context.
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() { errc <- ParseAndRunContext(ctx, root, env, nil) }()
+	<-started
+	cancel()
+	select {
+	case err := <-errc:
+		if err != context.Canceled {
+			t.Errorf("got error %v, want %v", err, context.Canceled)
+		}
+	case <-time.After(time.Minute):
+		t.Fatal("runner didn't observe cancellation")
+	}
+
+	// The runner observes the deadline of the context.
+	started = make(chan struct{})
+	ctx, cancel = context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	if err := ParseAndRunContext(ctx, root, env, nil); err != context.DeadlineExceeded {
+		t.Errorf("got error %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// Run uses a background context, which is never canceled.
+	root.Runner = ContextRunnerFunc(func(ctx context.Context, env *Env, _ []string) error {
+		if ctx.Done() != nil {
+			return errors.New("got a cancelable context")
+		}
+		return nil
+	})
+	if err := ParseAndRun(root, env, nil); err != nil {
+		t.Error(err)
+	}
+
+	// Regular runners still work with ParseAndRunContext.
+	root.Runner = RunnerFunc(runHello)
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	if err := ParseAndRunContext(ctx, root, env, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := stdout.String(), "Hello\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestHelpOutput(t *testing.T) {
+	child := &Command{
+		Name:   "child",
+		Short:  "description of child.",
+		Long:   "blah blah blah",
+		Runner: RunnerFunc(runEcho),
+	}
+	root := &Command{
+		Name:     "root",
+		Short:    "short",
+		Long:     "long.",
+		Children: []*Command{child},
+	}
+	tests := []struct {
+		args                    []string
+		stdout, stderr, helpOut bool
+	}{
+		{[]string{"-help"}, false, false, true},
+		{[]string{"child", "-h"}, false, false, true},
+		{[]string{"help"}, true, false, false},
+		{[]string{"help", "child"}, true, false, false},
+		{[]string{"-xx"}, false, true, false},
+	}
+	for _, test := range tests {
+		var stdout, stderr, helpOut bytes.Buffer
+		env := &Env{
+			Stdout:     &stdout,
+			Stderr:     &stderr,
+			HelpOutput: &helpOut,
+			Vars:       map[string]string{"CMDLINE_WIDTH": "80"},
+		}
+		runner, args, err := Parse(root, env, test.args)
+		if err == nil {
+			err = runner.Run(env, args)
+		}
+		if got, want := err != nil, test.stderr; got != want {
+			t.Errorf("%v: got error %v", test.args, err)
+		}
+		if got, want := stdout.Len() > 0, test.stdout; got != want {
+			t.Errorf("%v: got stdout %q", test.args, stdout.String())
+		}
+		if got, want := stderr.Len() > 0, test.stderr; got != want {
+			t.Errorf("%v: got stderr %q", test.args, stderr.String())
+		}
+		if got, want := helpOut.Len() > 0, test.helpOut; got != want {
+			t.Errorf("%v: got help output %q", test.args, helpOut.String())
+		}
+	}
+}
+
+func TestFlagCompletions(t *testing.T) {
+	cmd := &Command{
+		Name:   "cmd",
+		Short:  "short",
+		Long:   "long.",
+		Runner: RunnerFunc(runHello),
+		FlagCompletions: map[string]Completer{
+			"format": CompleteValues("json", "jsonl", "text"),
+			"dir": CompleterFunc(func(prefix string) []string {
+				return []string{prefix + "/"}
+			}),
+		},
+	}
+	cmd.Flags.String("format", "text", "Output format.")
+	cmd.Flags.String("dir", "", "Directory.")
+	cmd.Flags.Bool("verbose", false, "Verbose output.")
+	runTestCases(t, cmd, []testCase{{Args: []string{}, Stdout: "Hello\n"}})
+
+	tests := []struct {
+		name, prefix string
+		want         []string
+	}{
+		{"format", "", []string{"json", "jsonl", "text"}},
+		{"format", "json", []string{"json", "jsonl"}},
+		{"format", "x", nil},
+		{"dir", "foo", []string{"foo/"}},
+		{"verbose", "", nil},
+		{"undefined", "", nil},
+	}
+	for _, test := range tests {
+		if got, want := cmd.CompleteFlag(test.name, test.prefix), test.want; !reflect.DeepEqual(got, want) {
+			t.Errorf("%s=%s: got %v, want %v", test.name, test.prefix, got, want)
+		}
+	}
+
+	cmd.FlagCompletions["undefined"] = CompleteValues("a")
+	wantErr := `cmd: CODE INVARIANT BROKEN; FIX YOUR CODE
+
+FlagCompletions specified for undefined flag "undefined".`
+	runTestCases(t, cmd, []testCase{{Args: []string{}, Err: wantErr}})
+}
+
+func TestDeprecatedFlags(t *testing.T) {
+	child := &Command{
+		Name:            "child",
+		Short:           "short",
+		Long:            "long.",
+		Runner:          RunnerFunc(runEcho),
+		ArgsName:        "[args]",
+		DeprecatedFlags: map[string]string{"oldchild": "use -newchild"},
+	}
+	child.Flags.String("oldchild", "", "Deprecated.")
+	child.Flags.String("newchild", "", "Replacement.")
+	parent := &Command{
+		Name:            "parent",
+		Short:           "short",
+		Long:            "long.",
+		Children:        []*Command{child},
+		DeprecatedFlags: map[string]string{"oldname": "use -newname"},
+	}
+	parent.Flags.String("oldname", "", "Deprecated.")
+	parent.Flags.String("newname", "", "Replacement.")
+	runTestCases(t, parent, []testCase{
+		{Args: []string{"child", "a"}, Stdout: "[a]\n"},
+		{Args: []string{"-newname=x", "child", "-newchild=y", "a"}, Stdout: "[a]\n"},
+		{
+			Args:   []string{"-oldname=x", "child", "a"},
+			Stdout: "[a]\n",
+			Stderr: "WARNING: -oldname is deprecated: use -newname\n",
+		},
+		{
+			Args:   []string{"child", "-oldname=x", "-oldchild=y", "a"},
+			Stdout: "[a]\n",
+			Stderr: "WARNING: -oldchild is deprecated: use -newchild\nWARNING: -oldname is deprecated: use -newname\n",
+		},
+	})
+
+	child.DeprecatedFlags["undefined"] = "gone"
+	wantErr := `parent child: CODE INVARIANT BROKEN; FIX YOUR CODE
+
+DeprecatedFlags specified for undefined flag "undefined".`
+	runTestCases(t, parent, []testCase{{Args: []string{}, Err: wantErr}})
+}
+
+func TestFlagShorthands(t *testing.T) {
+	var verbose bool
+	var name string
+	runPrint := func(env *Env, args []string) error {
+		fmt.Fprintf(env.Stdout, "verbose=%v name=%q %v\n", verbose, name, args)
+		verbose, name = false, ""
+		return nil
+	}
+	child := &Command{
+		Name:           "child",
+		Short:          "short",
+		Long:           "long.",
+		Runner:         RunnerFunc(runPrint),
+		ArgsName:       "[args]",
+		FlagShorthands: map[string]string{"name": "n"},
+	}
+	child.Flags.StringVar(&name, "name", "", "The name.")
+	parent := &Command{
+		Name:           "parent",
+		Short:          "short",
+		Long:           "long.",
+		Children:       []*Command{child},
+		FlagShorthands: map[string]string{"verbose": "v"},
+	}
+	parent.Flags.BoolVar(&verbose, "verbose", false, "Verbose output.")
+	runTestCases(t, parent, []testCase{
+		{Args: []string{"child", "a"}, Stdout: "verbose=false name=\"\" [a]\n"},
+		{Args: []string{"-v", "child", "-n", "x", "a"}, Stdout: "verbose=true name=\"x\" [a]\n"},
+		{Args: []string{"child", "-v", "-name=y", "a"}, Stdout: "verbose=true name=\"y\" [a]\n"},
+		{Args: []string{"-verbose", "child", "-v=false", "a"}, Stdout: "verbose=false name=\"\" [a]\n"},
+		{
+			Args: []string{"help", "-style=full", "child"},
+			Stdout: `long.
+
+Usage:
+   parent child [flags] [args]
+
+The parent child flags are:
+ -n, -name=
+   The name.
+
+ -v, -verbose=false
+   Verbose output.
+
+The global flags are:
+ -global1=
+   global test flag 1
+ -global2=0
+   global test flag 2
+`,
+		},
+	})
+
+	child.FlagShorthands["name"] = "verbose"
+	child.Flags.Bool("verbose", false, "Shadows the parent flag.")
+	wantErr := `parent child: CODE INVARIANT BROKEN; FIX YOUR CODE
+
+FlagShorthands shorthand "verbose" for flag "name" collides with a flag.`
+	runTestCases(t, parent, []testCase{{Args: []string{}, Err: wantErr}})
+}
+
+func TestFlagShorthandsParseTwice(t *testing.T) {
+	root := &Command{
+		Name:           "root",
+		Short:          "short",
+		Long:           "long.",
+		Runner:         RunnerFunc(runEcho),
+		ArgsName:       "[args]",
+		FlagShorthands: map[string]string{"name": "n"},
+		RequiredFlags:  []string{"name"},
+	}
+	root.Flags.String("name", "", "The name.")
+	// The required flag is set via its shorthand on every parse, since the
+	// shorthand isn't left behind in flag.CommandLine.
+	for i := 0; i < 2; i++ {
+		env := &Env{Stdout: io.Discard, Stderr: io.Discard, Vars: baseVars}
+		if _, _, err := Parse(root, env, []string{"-n", "x", "a"}); err != nil {
+			t.Errorf("%d: got %v, want nil", i, err)
+		}
+		if f := flag.CommandLine.Lookup("n"); f != nil {
+			t.Errorf("%d: got shorthand %v in flag.CommandLine, want none", i, f.Name)
+		}
+	}
+}
+
+func TestRequiredFlags(t *testing.T) {
+	child := &Command{
+		Name:          "child",
+		Short:         "short",
+		Long:          "long.",
+		Runner:        RunnerFunc(runEcho),
+		ArgsName:      "[args]",
+		RequiredFlags: []string{"name"},
+	}
+	child.Flags.String("name", "", "The name.")
+	parent := &Command{
+		Name:          "parent",
+		Short:         "short",
+		Long:          "long.",
+		Children:      []*Command{child},
+		RequiredFlags: []string{"level"},
+	}
+	parent.Flags.Int("level", 1, "The level.")
+	childUsage := `long.
+
+Usage:
+   parent child [flags] [args]
+
+The parent child flags are:
+ -name=
+   The name.
+
+The global flags are:
+ -global1=
+   global test flag 1
+ -global2=0
+   global test flag 2
+
+Run "parent help -style=full child" to show all flags.
+`
+	// Flag values persist across test cases, so those that set -name come last.
+	runTestCases(t, parent, []testCase{
+		{Args: []string{"child", "-help"}, Stdout: childUsage},
+		{Args: []string{"help", "child"}, Stdout: childUsage},
+		{
+			Args:   []string{"-level=2", "child", "a"},
+			Err:    errUsageStr,
+			Stderr: "ERROR: parent child: required flag -name not set\n\n" + childUsage,
+		},
+		{
+			// The default value of a required flag isn't enough.
+			Args:   []string{"child", "-name=x", "a"},
+			Err:    errUsageStr,
+			Stderr: "ERROR: parent child: required flag -level not set\n\n" + strings.Replace(childUsage, "-name=", "-name=x", 1),
+		},
+		{Args: []string{"-level=2", "child", "-name=x", "a"}, Stdout: "[a]\n"},
+		{Args: []string{"child", "-name", "x", "-level", "1"}, Stdout: "[]\n"},
+	})
+
+	child.RequiredFlags = append(child.RequiredFlags, "undefined")
+	wantErr := `parent child: CODE INVARIANT BROKEN; FIX YOUR CODE
+
+RequiredFlags specified for undefined flag "undefined".`
+	runTestCases(t, parent, []testCase{{Args: []string{}, Err: wantErr}})
+}
+
+func TestPositionalArgs(t *testing.T) {
+	prog := &Command{
+		Name:   "copy",
+		Short:  "Copy a file.",
+		Long:   "Copy copies a file.",
+		Runner: RunnerFunc(runEcho),
+		PositionalArgs: []ArgSpec{
+			{Name: "src", Description: "The file to copy.", Required: true},
+			{Name: "dst", Description: "The destination.", Required: true},
+			{Name: "mode"},
+		},
+	}
+	usage := `Copy copies a file.
+
+Usage:
+   copy [flags] <src> <dst> [<mode>]
+
+The copy args are:
+   <src>    - The file to copy.
+   <dst>    - The destination.
+   [<mode>]
+
+The global flags are:
+ -global1=
+   global test flag 1
+ -global2=0
+   global test flag 2
+`
+	runTestCases(t, prog, []testCase{
+		{Args: []string{"a", "b"}, Stdout: "[a b]\n"},
+		{Args: []string{"a", "b", "c"}, Stdout: "[a b c]\n"},
+		{Args: []string{"help"}, Err: errUsageStr, Stderr: "ERROR: copy: missing argument <dst>\n\n" + usage},
+		{Args: []string{}, Err: errUsageStr, Stderr: "ERROR: copy: missing argument <src>\n\n" + usage},
+		{
+			Args:   []string{"a", "b", "c", "d"},
+			Err:    errUsageStr,
+			Stderr: "ERROR: copy: too many arguments: got 4, want at most 3\n\n" + usage,
+		},
+		{Args: []string{"-help"}, Stdout: usage},
+	})
+
+	prog.ArgsName = "<src> <dst>"
+	wantErr := `copy: CODE INVARIANT BROKEN; FIX YOUR CODE
+
+At most one of PositionalArgs and ArgsName / ArgsLong may be specified.`
+	runTestCases(t, prog, []testCase{{Args: []string{}, Err: wantErr}})
+
+	prog.ArgsName = ""
+	prog.PositionalArgs = []ArgSpec{{Name: "src"}, {Name: "dst", Required: true}}
+	wantErr = `copy: CODE INVARIANT BROKEN; FIX YOUR CODE
+
+Required positional arg "dst" cannot follow an optional arg.`
+	runTestCases(t, prog, []testCase{{Args: []string{}, Err: wantErr}})
+}
+
+func TestNoHelp(t *testing.T) {
+	prog := &Command{
+		Name:   "program",
+		Short:  "Test NoHelp.",
+		Long:   "Test NoHelp.",
+		NoHelp: true,
+		Children: []*Command{{
+			Name:     "echo",
+			Short:    "Print strings on stdout.",
+			Long:     "Echo prints any strings passed in to stdout.",
+			ArgsName: "[strings]",
+			Runner:   RunnerFunc(runEcho),
+		}},
+	}
+	usage := `Test NoHelp.
+
+Usage:
+   program [flags] <command>
+
+The program commands are:
+   echo        Print strings on stdout.
+
+The global flags are:
+ -global1=
+   global test flag 1
+ -global2=0
+   global test flag 2
+`
+	runTestCases(t, prog, []testCase{
+		{Args: []string{"echo", "help"}, Stdout: "[help]\n"},
+		{Args: []string{"-help"}, Stdout: usage},
+		{Args: []string{"help"}, Err: errUsageStr, Stderr: "ERROR: program: unknown command \"help\"\n\n" + usage},
+	})
+}
+
+func TestCommandAliases(t *testing.T) {
+	echo := &Command{
+		Name:     "echo",
+		Aliases:  []string{"print", "say"},
+		Short:    "Print strings on stdout.",
+		Long:     "Echo prints any strings passed in to stdout.",
+		ArgsName: "[strings]",
+		Runner:   RunnerFunc(runEcho),
+	}
+	prog := &Command{
+		Name:     "program",
+		Short:    "Test aliases.",
+		Long:     "Test aliases.",
+		Children: []*Command{echo},
+	}
+	usage := `Test aliases.
+
+Usage:
+   program [flags] <command>
+
+The program commands are:
+   echo (print, say) Print strings on stdout.
+   help              Display help for commands or topics
+Run "program help [command]" for command usage.
+
+The global flags are:
+ -global1=
+   global test flag 1
+ -global2=0
+   global test flag 2
+`
+	echoUsage := `Echo prints any strings passed in to stdout.
+
+Usage:
+   program echo [flags] [strings]
+
+The global flags are:
+ -global1=
+   global test flag 1
+ -global2=0
+   global test flag 2
+`
+	runTestCases(t, prog, []testCase{
+		{Args: []string{"echo", "a"}, Stdout: "[a]\n"},
+		{Args: []string{"print", "b"}, Stdout: "[b]\n"},
+		{Args: []string{"say", "c"}, Stdout: "[c]\n"},
+		{Args: []string{"help"}, Stdout: usage},
+		{Args: []string{"help", "say"}, Stdout: echoUsage},
+		{Args: []string{"echo", "-help"}, Stdout: echoUsage},
+		{Args: []string{"shout"}, Err: errUsageStr, Stderr: "ERROR: program: unknown command \"shout\"\n\n" + usage},
+	})
+
+	// An alias may not collide with the name or alias of a sibling.
+	dup := &Command{
+		Name:    "say",
+		Aliases: []string{"tell"},
+		Short:   "Say hello.",
+		Long:    "Say hello.",
+		Runner:  RunnerFunc(runHello),
+	}
+	prog.Children = append(prog.Children, dup)
+	wantErr := `program: CODE INVARIANT BROKEN; FIX YOUR CODE
+
+Each command must have unique children and topic names.
+Saw "say" multiple times.`
+	runTestCases(t, prog, []testCase{{Args: []string{"echo"}, Err: wantErr}})
+	dup.Name, dup.Aliases = "tell", []string{"print"}
+	wantErr = strings.Replace(wantErr, `"say"`, `"print"`, 1)
+	runTestCases(t, prog, []testCase{{Args: []string{"echo"}, Err: wantErr}})
+}
+
+func TestHiddenCommands(t *testing.T) {
+	prog := &Command{
+		Name:  "program",
+		Short: "Test hidden commands.",
+		Long:  "Test hidden commands.",
+		Children: []*Command{{
+			Name:     "echo",
+			Short:    "Print strings on stdout.",
+			Long:     "Echo prints any strings passed in to stdout.",
+			ArgsName: "[strings]",
+			Runner:   RunnerFunc(runEcho),
+		}, {
+			Name:   "secret",
+			Short:  "Internal debugging command.",
+			Long:   "Secret is an internal debugging command.",
+			Hidden: true,
+			Runner: RunnerFunc(runHello),
+		}},
+	}
+	usage := `Test hidden commands.
+
+Usage:
+   program [flags] <command>
+
+The program commands are:
+   echo        Print strings on stdout.
+   help        Display help for commands or topics
+Run "program help [command]" for command usage.
+
+The global flags are:
+ -global1=
+   global test flag 1
+ -global2=0
+   global test flag 2
+`
+	secretUsage := `Secret is an internal debugging command.
+
+Usage:
+   program secret [flags]
+
+The global flags are:
+ -global1=
+   global test flag 1
+ -global2=0
+   global test flag 2
+`
+	runTestCases(t, prog, []testCase{
+		{Args: []string{"secret"}, Stdout: "Hello\n"},
+		{Args: []string{"echo", "a"}, Stdout: "[a]\n"},
+		{Args: []string{"help"}, Stdout: usage},
+		{Args: []string{"-help"}, Stdout: usage},
+		{Args: []string{"help", "secret"}, Stdout: secretUsage},
+		{Args: []string{"secret", "-help"}, Stdout: secretUsage},
+	})
+
+	// "help ..." omits the hidden command.
+	var stdout bytes.Buffer
+	env := &Env{Stdout: &stdout, Stderr: &stdout, Vars: baseVars}
+	if err := ParseAndRun(prog, env, []string{"help", "..."}); err != nil {
+		t.Fatal(err)
+	}
+	if got := stdout.String(); !strings.Contains(got, "program echo") || strings.Contains(got, "secret") {
+		t.Errorf("help ... got:\n%s\nwant echo but not secret", got)
+	}
+}
+
+func TestSuggestCommand(t *testing.T) {
+	prog := &Command{
+		Name:  "program",
+		Short: "Test suggestions.",
+		Long:  "Test suggestions.",
+		Children: []*Command{{
+			Name:     "echo",
+			Short:    "Print strings on stdout.",
+			Long:     "Echo prints any strings passed in to stdout.",
+			ArgsName: "[strings]",
+			Runner:   RunnerFunc(runEcho),
+		}, {
+			Name:    "status",
+			Aliases: []string{"st"},
+			Short:   "Show status.",
+			Long:    "Show status.",
+			Runner:  RunnerFunc(runHello),
+		}},
+	}
+	usage := `Test suggestions.
+
+Usage:
+   program [flags] <command>
+
+The program commands are:
+   echo        Print strings on stdout.
+   status (st) Show status.
+   help        Display help for commands or topics
+Run "program help [command]" for command usage.
+
+The global flags are:
+ -global1=
+   global test flag 1
+ -global2=0
+   global test flag 2
+`
+	suggest := func(name, suggestion string) string {
+		return fmt.Sprintf("ERROR: program: unknown command %q\nDid you mean %q?\n\n%s", name, suggestion, usage)
+	}
+	unknown := func(name string) string {
+		return fmt.Sprintf("ERROR: program: unknown command %q\n\n%s", name, usage)
+	}
+	runTestCases(t, prog, []testCase{
+		{Args: []string{"ecoh"}, Err: errUsageStr, Stderr: suggest("ecoh", "echo")},
+		{Args: []string{"ech", "a"}, Err: errUsageStr, Stderr: suggest("ech", "echo")},
+		{Args: []string{"stats"}, Err: errUsageStr, Stderr: suggest("stats", "status")},
+		{Args: []string{"hepl"}, Err: errUsageStr, Stderr: suggest("hepl", "help")},
+		{Args: []string{"sts"}, Err: errUsageStr, Stderr: suggest("sts", "st")},
+		{Args: []string{"foo"}, Err: errUsageStr, Stderr: unknown("foo")},
+		{Args: []string{"ls"}, Err: errUsageStr, Stderr: unknown("ls")},
+		{Args: []string{"statistics"}, Err: errUsageStr, Stderr: unknown("statistics")},
+	})
+}
+
+func TestNoBuiltinFlags(t *testing.T) {
+	// The builtin flags are normally registered on the original flag.CommandLine,
+	// so simulate them on a fresh one, and re-initialize the global flags.
+	defer func(fs *flag.FlagSet, global *flag.FlagSet) {
+		flag.CommandLine, globalFlags = fs, global
+	}(flag.CommandLine, globalFlags)
+	setup := func() {
+		flag.CommandLine = flag.NewFlagSet("test", flag.ContinueOnError)
+		flag.String("global1", "", "global test flag 1")
+		flag.Bool("metadata", false, "Displays metadata for the program and exits.")
+		flag.Bool("time", false, "Dump timing information to stderr before exiting the program.")
+		globalFlags = nil
+	}
+	prog := &Command{
+		Name:   "program",
+		Short:  "Test NoBuiltinFlags.",
+		Long:   "Test NoBuiltinFlags.",
+		Runner: RunnerFunc(runHello),
+	}
+	parse := func(args ...string) (string, error) {
+		var stdout, stderr bytes.Buffer
+		env := &Env{Stdout: &stdout, Stderr: &stderr, Vars: baseVars}
+		runner, args, err := Parse(prog, env, args)
+		if err == nil {
+			err = runner.Run(env, args)
+		}
+		return stdout.String() + stderr.String(), err
+	}
+
+	// Without NoBuiltinFlags, the builtin flags are accepted and shown.
+	setup()
+	if _, err := parse("-time"); err != nil {
+		t.Errorf("-time: %v", err)
+	}
+	if out, _ := parse("-help"); !strings.Contains(out, " -time=") || !strings.Contains(out, " -metadata=") {
+		t.Errorf("-help: builtin flags missing from output:\n%s", out)
+	}
+
+	// With NoBuiltinFlags, they're rejected and omitted.
+	prog.NoBuiltinFlags = true
+	commandLine, global := flag.CommandLine, globalFlags
+	for _, arg := range []string{"-time", "-metadata"} {
+		if _, err := parse(arg); err != ErrUsage {
+			t.Errorf("%s: got error %v, want %v", arg, err, ErrUsage)
+		}
+	}
+	if out, _ := parse("-help"); strings.Contains(out, " -time=") || strings.Contains(out, " -metadata=") {
+		t.Errorf("-help: builtin flags present in output:\n%s", out)
+	}
+	if out, err := parse("-global1=x"); err != nil || out != "Hello\n" {
+		t.Errorf("-global1=x: got %q, %v, want %q, nil", out, err, "Hello\n")
+	}
+
+	// They're also rejected for subcommands run via RunSubcommand.
+	group := &Command{
+		Name:  "group",
+		Short: "short",
+		Long:  "long.",
+		Children: []*Command{{
+			Name:   "hello",
+			Short:  "short",
+			Long:   "long.",
+			Runner: RunnerFunc(runHello),
+		}},
+	}
+	group.Children = append(group.Children, &Command{
+		Name:  "all",
+		Short: "short",
+		Long:  "long.",
+		Runner: RunnerFunc(func(env *Env, args []string) error {
+			return group.RunSubcommand(env, "hello", args)
+		}),
+		ArgsName: "[args]",
+	})
+	tree := &Command{
+		Name:           "tree",
+		Short:          "short",
+		Long:           "long.",
+		NoBuiltinFlags: true,
+		Children:       []*Command{group},
+	}
+	env := &Env{Stdout: io.Discard, Stderr: io.Discard, Vars: baseVars}
+	if err := ParseAndRun(tree, env, []string{"group", "all", "--", "-time"}); err != ErrUsage {
+		t.Errorf("group all -- -time: got error %v, want %v", err, ErrUsage)
+	}
+
+	// The process-wide flag sets are unchanged, so other command trees still get
+	// the builtin flags.
+	if flag.CommandLine != commandLine || globalFlags != global {
+		t.Errorf("flag.CommandLine or the global flags were replaced")
+	}
+	for _, name := range []string{"time", "metadata"} {
+		if flag.Lookup(name) == nil || globalFlags.Lookup(name) == nil {
+			t.Errorf("%s flag was removed", name)
+		}
+	}
+	prog.NoBuiltinFlags = false
+	if _, err := parse("-time"); err != nil {
+		t.Errorf("-time: %v", err)
+	}
+
+	// NoBuiltinFlags may only be set on the root command.
+	prog = &Command{
+		Name:     "parent",
+		Short:    "parent",
+		Long:     "parent",
+		Children: []*Command{prog},
+	}
+	prog.Children[0].NoBuiltinFlags = true
+	wantErr := `parent program: CODE INVARIANT BROKEN; FIX YOUR CODE
+
+NoBuiltinFlags may only be set on the root command.`
+	if _, err := parse(); errString(err) != wantErr {
+		t.Errorf("got error %v, want %v", err, wantErr)
+	}
+}
+
+func TestPassUnknownFlags(t *testing.T) {
+	var verbose bool
+	var name string
+	wrap := &Command{
+		Name:             "wrap",
+		Short:            "Wrap another tool.",
+		Long:             "Wrap another tool.",
+		ArgsName:         "[args]",
+		Runner:           RunnerFunc(runEcho),
+		PassUnknownFlags: true,
+	}
+	wrap.Flags.BoolVar(&verbose, "v", false, "verbose")
+	wrap.Flags.StringVar(&name, "name", "", "name")
+	prog := &Command{
+		Name:     "program",
+		Short:    "Test PassUnknownFlags.",
+		Long:     "Test PassUnknownFlags.",
+		Children: []*Command{wrap},
+	}
+	tests := []struct {
+		args        []string
+		stdout      string
+		verbose     bool
+		name        string
+		wantUnknown bool
+	}{
+		{[]string{"wrap", "a"}, "[a]\n", false, "", false},
+		{[]string{"wrap", "-foo", "-v", "a", "-bar"}, "[-foo a -bar]\n", true, "", false},
+		{[]string{"wrap", "-name", "x", "--foo=1", "-v=false", "a"}, "[--foo=1 a]\n", false, "x", false},
+		{[]string{"wrap", "-x=1", "--", "-y"}, "[-x=1 -y]\n", false, "", false},
+		// Unknown flags are only passed through for the wrap command.
+		{[]string{"-foo", "wrap"}, "", false, "", true},
+	}
+	for _, test := range tests {
+		verbose, name = false, ""
+		flag.CommandLine = flag.NewFlagSet("test", flag.ContinueOnError)
+		var stdout, stderr bytes.Buffer
+		env := &Env{Stdout: &stdout, Stderr: &stderr, Vars: baseVars}
+		err := ParseAndRun(prog, env, test.args)
+		if test.wantUnknown {
+			if err == nil || !strings.Contains(stderr.String(), "flag provided but not defined: -foo") {
+				t.Errorf("%v: got error %v, stderr %q, want unknown flag error", test.args, err, stderr.String())
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: %v\n%s", test.args, err, stderr.String())
+			continue
+		}
+		if got, want := stdout.String(), test.stdout; got != want {
+			t.Errorf("%v: got stdout %q, want %q", test.args, got, want)
+		}
+		if verbose != test.verbose || name != test.name {
+			t.Errorf("%v: got flags (%v, %q), want (%v, %q)", test.args, verbose, name, test.verbose, test.name)
+		}
+	}
+
+	wrap.Children = []*Command{{Name: "child", Short: "short", Long: "long.", Runner: RunnerFunc(runHello)}}
+	wrap.ArgsName = ""
+	wantErr := `program wrap: CODE INVARIANT BROKEN; FIX YOUR CODE
+
+PassUnknownFlags cannot be set on a command with Children.`
+	runTestCases(t, prog, []testCase{{Args: []string{}, Err: wantErr}})
+}
+
+type fc struct {
+	DontPropagateFlags bool
+	DontInheritFlags   bool
+}
+
+func TestFlagPropagation(t *testing.T) {
+	var err error
+	env := EnvFromOS()
 
 	tests := []struct {
 		flagConfigs []fc
@@ -3135,3 +4354,454 @@ func createCommandTree(flagConfigs []fc) []*Command {
 
 	return result
 }
+
+func TestParseReentrant(t *testing.T) {
+	flag.CommandLine = flag.NewFlagSet("test", flag.ContinueOnError)
+	var a, b bool
+	child := &Command{
+		Name:     "child",
+		Short:    "short",
+		Long:     "long.",
+		ArgsName: "[args]",
+		Runner:   RunnerFunc(runHello),
+	}
+	child.Flags.BoolVar(&b, "b", false, "bool")
+	root := &Command{
+		Name:     "root",
+		Short:    "short",
+		Long:     "long.",
+		Children: []*Command{child},
+	}
+	root.Flags.BoolVar(&a, "a", false, "bool")
+	var stderr bytes.Buffer
+	env := &Env{Stdout: &stderr, Stderr: &stderr, Vars: baseVars}
+	tests := []struct {
+		args         []string
+		rest         []string
+		wantA, wantB bool
+	}{
+		{[]string{"-a", "child", "x"}, []string{"x"}, true, false},
+		{[]string{"child", "-b", "y"}, []string{"y"}, false, true},
+		{[]string{"child"}, nil, false, false},
+	}
+	for _, test := range tests {
+		a, b = false, false
+		_, rest, err := ParseReentrant(root, env, test.args)
+		if err != nil {
+			t.Fatalf("%v: %v\n%s", test.args, err, stderr.String())
+		}
+		if got, want := rest, test.rest; !reflect.DeepEqual(got, want) {
+			t.Errorf("%v: got args %v, want %v", test.args, got, want)
+		}
+		if a != test.wantA || b != test.wantB {
+			t.Errorf("%v: got (a, b) = (%v, %v), want (%v, %v)", test.args, a, b, test.wantA, test.wantB)
+		}
+		// flag.CommandLine must be left untouched.
+		if flag.CommandLine.Parsed() {
+			t.Errorf("%v: flag.CommandLine should not be parsed", test.args)
+		}
+		if flag.CommandLine.Lookup("a") != nil {
+			t.Errorf("%v: flag.CommandLine should not contain root flags", test.args)
+		}
+	}
+	// Bad flags are still reported.
+	if _, _, err := ParseReentrant(root, env, []string{"-xx"}); err == nil {
+		t.Errorf("expected an error")
+	}
+}
+
+func TestRunSubcommand(t *testing.T) {
+	flag.CommandLine = flag.NewFlagSet("test", flag.ContinueOnError)
+	var x bool
+	var ran []string
+	child := &Command{
+		Name:     "child",
+		Aliases:  []string{"kid"},
+		Short:    "short",
+		Long:     "long.",
+		ArgsName: "[args]",
+		Runner: RunnerFunc(func(env *Env, args []string) error {
+			ran = append(ran, fmt.Sprintf("child %v %v", x, args))
+			return nil
+		}),
+	}
+	child.Flags.BoolVar(&x, "x", false, "bool")
+	root := &Command{
+		Name:  "root",
+		Short: "short",
+		Long:  "long.",
+	}
+	all := &Command{
+		Name:  "all",
+		Short: "short",
+		Long:  "long.",
+		Runner: RunnerFunc(func(env *Env, args []string) error {
+			if err := root.RunSubcommand(env, "child", []string{"-x", "a"}); err != nil {
+				return err
+			}
+			if err := root.RunSubcommand(env, "child", []string{"-x=false", "b"}); err != nil {
+				return err
+			}
+			// Aliases may be used in place of the name.
+			return root.RunSubcommand(env, "kid", []string{"c"})
+		}),
+	}
+	root.Children = []*Command{child, all}
+	var stderr bytes.Buffer
+	env := &Env{Stdout: &stderr, Stderr: &stderr, Vars: baseVars}
+	if err := ParseAndRun(root, env, []string{"all"}); err != nil {
+		t.Fatalf("%v\n%s", err, stderr.String())
+	}
+	if got, want := ran, []string{"child true [a]", "child false [b]", "child false [c]"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	// Unknown commands and bad flags are usage errors.
+	if err := root.RunSubcommand(env, "foo", nil); err != ErrUsage {
+		t.Errorf("got %v, want %v", err, ErrUsage)
+	}
+	if err := root.RunSubcommand(env, "child", []string{"-y"}); err != ErrUsage {
+		t.Errorf("got %v, want %v", err, ErrUsage)
+	}
+
+	// RunSubcommandContext passes the context to a ContextRunner, so an "all"
+	// command run via ParseAndRunContext observes cancellation in its children.
+	child.Runner = ContextRunnerFunc(func(ctx context.Context, env *Env, args []string) error {
+		return ctx.Err()
+	})
+	all.Runner = ContextRunnerFunc(func(ctx context.Context, env *Env, args []string) error {
+		return root.RunSubcommandContext(ctx, env, "child", nil)
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := ParseAndRunContext(ctx, root, env, []string{"all"}); err != context.Canceled {
+		t.Errorf("got %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		err    error
+		code   int
+		output string
+	}{
+		{nil, 0, ""},
+		{ErrExitCode(0), 0, ""},
+		{ErrUsage, 2, ""},
+		{ErrExitCode(42), 42, "ERROR: exit code 42\n"},
+		{childExitError{42}, 42, ""},
+		{errors.New("oops"), 1, "ERROR: oops\n"},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		if got, want := ExitCode(test.err, &buf), test.code; got != want {
+			t.Errorf("%v: got code %v, want %v", test.err, got, want)
+		}
+		if got, want := buf.String(), test.output; got != want {
+			t.Errorf("%v: got output %q, want %q", test.err, got, want)
+		}
+		// A nil writer is allowed.
+		if got, want := ExitCode(test.err, nil), test.code; got != want {
+			t.Errorf("%v: got code %v, want %v", test.err, got, want)
+		}
+	}
+}
+
+func TestShowExitCode(t *testing.T) {
+	root := &Command{
+		Name:   "root",
+		Short:  "short",
+		Long:   "long.",
+		Runner: RunnerFunc(runHello),
+	}
+	for _, show := range []bool{false, true} {
+		var stderr bytes.Buffer
+		env := &Env{Stdout: &stderr, Stderr: &stderr, Vars: baseVars, ShowExitCode: show}
+		if err := ParseAndRun(root, env, []string{"foo"}); err != ErrUsage {
+			t.Errorf("got %v, want %v", err, ErrUsage)
+		}
+		want := "ERROR: root: doesn't take arguments\n"
+		if show {
+			want = "ERROR: root: doesn't take arguments (exit code 2)\n"
+		}
+		if got := stderr.String(); !strings.HasPrefix(got, want) {
+			t.Errorf("got %q, want prefix %q", got, want)
+		}
+	}
+}
+
+func TestParseArgs(t *testing.T) {
+	set := &Command{
+		Name:     "set",
+		Short:    "Set values.",
+		Long:     "Set values.",
+		ArgsName: "<key=value> ...",
+		Runner:   RunnerFunc(runEcho),
+		ParseArgs: func(args []string) ([]string, error) {
+			if len(args) == 0 {
+				return nil, errors.New("no values specified")
+			}
+			var keys []string
+			for _, arg := range args {
+				kv := strings.SplitN(arg, "=", 2)
+				if len(kv) != 2 {
+					return nil, fmt.Errorf("%q isn't of the form key=value", arg)
+				}
+				keys = append(keys, kv[0])
+			}
+			return keys, nil
+		},
+	}
+	prog := &Command{
+		Name:     "program",
+		Short:    "Test ParseArgs.",
+		Long:     "Test ParseArgs.",
+		Children: []*Command{set},
+	}
+	tests := []struct {
+		args          []string
+		stdout, error string
+	}{
+		{[]string{"set", "a=1", "b=2"}, "[a b]\n", ""},
+		{[]string{"set", "a=1", "b"}, "", `ERROR: program set: "b" isn't of the form key=value`},
+		{[]string{"set"}, "", "ERROR: program set: no values specified"},
+	}
+	for _, test := range tests {
+		var stdout, stderr bytes.Buffer
+		env := &Env{Stdout: &stdout, Stderr: &stderr, Vars: baseVars}
+		err := ParseAndRun(prog, env, test.args)
+		if test.error != "" {
+			if err != ErrUsage || !strings.HasPrefix(stderr.String(), test.error+"\n") {
+				t.Errorf("%v: got error %v, stderr %q, want usage error %q", test.args, err, stderr.String(), test.error)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: %v\n%s", test.args, err, stderr.String())
+			continue
+		}
+		if got, want := stdout.String(), test.stdout; got != want {
+			t.Errorf("%v: got stdout %q, want %q", test.args, got, want)
+		}
+	}
+
+	// Other exit codes are returned as-is.
+	set.ParseArgs = func([]string) ([]string, error) { return nil, ErrExitCode(3) }
+	if err := ParseAndRun(prog, &Env{Stdout: io.Discard, Stderr: io.Discard, Vars: baseVars}, []string{"set"}); err != ErrExitCode(3) {
+		t.Errorf("got %v, want %v", err, ErrExitCode(3))
+	}
+
+	set.Runner = nil
+	set.Children = []*Command{{Name: "child", Short: "short", Long: "long.", Runner: RunnerFunc(runHello)}}
+	set.ArgsName = ""
+	var stderr bytes.Buffer
+	err := ParseAndRun(prog, &Env{Stdout: &stderr, Stderr: &stderr, Vars: baseVars}, []string{"set"})
+	if err == nil || !strings.Contains(err.Error(), "ParseArgs cannot be set on a command without a Runner.") {
+		t.Errorf("got %v, want invariant error", err)
+	}
+}
+
+func TestImportCommand(t *testing.T) {
+	flag.CommandLine = flag.NewFlagSet("test", flag.ContinueOnError)
+	tmpDir := t.TempDir()
+	bins := map[string]string{}
+	for _, name := range []string{"flags", "nested"} {
+		bins[name] = lookpath.ExecutableFilename(filepath.Join(tmpDir, name))
+		cmd := exec.Command("go", "build", "-o", bins[name], filepath.Join(".", "testdata", name+".go"))
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("%v, %v", string(out), err)
+		}
+	}
+	var stdout, stderr bytes.Buffer
+	env := &Env{Stdout: &stdout, Stderr: &stderr, Vars: map[string]string{"CMDLINE_WIDTH": "80"}}
+	flags, err := ImportCommand(env, bins["flags"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	nested, err := ImportCommand(env, bins["nested"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	nested.Name = "sub"
+	root := &Command{
+		Name:     "root",
+		Short:    "short",
+		Long:     "long.",
+		Children: []*Command{flags, nested},
+	}
+
+	// The imported commands appear in the help of the parent.
+	if err := ParseAndRun(root, env, []string{"help", "..."}); err != nil {
+		t.Fatalf("%v\n%s", err, stderr.String())
+	}
+	for _, want := range []string{
+		"   flags       Short description of command flags\n",
+		"   sub         Short description of command nested\n",
+		"Usage:\n   root flags [flags] [args]\n\n[args] are ignored\n",
+		"The root flags flags are:\n -global1=\n   description of global1\n",
+		"Root sub child - Short description of command child\n\nLong description of command child.\n",
+	} {
+		if !strings.Contains(stdout.String(), want) {
+			t.Errorf("got %q, want it to contain %q", stdout.String(), want)
+		}
+	}
+
+	// Running an imported command runs the binary, passing the flags and args.
+	stdout.Reset()
+	stderr.Reset()
+	if err := ParseAndRun(root, env, []string{"flags", "-local", "x", "a"}); err != nil {
+		t.Fatalf("%v\n%s", err, stderr.String())
+	}
+	if got, want := stdout.String(), "global1=\"\" shared=\"\" local=\"x\" [\"a\"]\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	stdout.Reset()
+	if got, want := ParseAndRun(root, env, []string{"sub", "child"}), ErrExitCode(2); !errors.Is(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := stderr.String(), "ERROR: wombats!"; !strings.HasPrefix(got, want) {
+		t.Errorf("got %q, want prefix %q", got, want)
+	}
+
+	// Unknown flags are rejected by the parent.
+	stderr.Reset()
+	if got, want := ParseAndRun(root, env, []string{"flags", "-nosuchflag"}), ErrUsage; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// Binaries that aren't cmdline-based can't be imported.
+	if _, err := ImportCommand(env, filepath.Join(tmpDir, "nosuchbinary")); err == nil {
+		t.Errorf("expected error")
+	}
+}
+
+func TestGenerateBashCompletion(t *testing.T) {
+	flag.CommandLine = flag.NewFlagSet("test", flag.ContinueOnError)
+	flag.String("global1", "", "global test flag 1")
+	flag.Int64("global2", 0, "global test flag 2")
+	echo := &Command{
+		Name:           "echo",
+		Aliases:        []string{"print"},
+		Short:          "Print strings on stdout",
+		Long:           "Echo prints any strings passed in to stdout.",
+		Runner:         RunnerFunc(runEcho),
+		ArgsName:       "[strings]",
+		ArgsLong:       "[strings] are arbitrary strings that will be echoed.",
+		FlagShorthands: map[string]string{"newline": "n", "format": "f"},
+		FlagCompletions: map[string]Completer{
+			"format": CompleteValues("json", "text"),
+			"dir": CompleterFunc(func(prefix string) []string {
+				return []string{prefix + "/", prefix + "2/"}
+			}),
+		},
+	}
+	echo.Flags.Bool("newline", true, "Print a trailing newline.")
+	echo.Flags.String("format", "text", "Output format.")
+	echo.Flags.String("dir", "", "Directory.")
+	leaf := &Command{
+		Name:   "leaf",
+		Short:  "Leaf command",
+		Long:   "Leaf command.",
+		Runner: RunnerFunc(runHello),
+	}
+	leaf.Flags.Bool("leafflag", false, "Leaf flag.")
+	sub := &Command{
+		Name:     "sub",
+		Short:    "Sub command",
+		Long:     "Sub command.",
+		Children: []*Command{leaf},
+	}
+	tool := &Command{
+		Name:     "tool",
+		Short:    "Test tool",
+		Long:     "Test tool.",
+		Children: []*Command{echo, sub},
+		Topics:   []Topic{{Name: "topic", Short: "Help topic", Long: "Help topic."}},
+	}
+	tool.Flags.Bool("toolflag", false, "Tool flag.")
+
+	var buf bytes.Buffer
+	if err := GenerateBashCompletion(tool, &buf); err != nil {
+		t.Fatal(err)
+	}
+	script := buf.String()
+	for _, want := range []string{
+		"complete -F _tool_complete tool\n",
+		"'tool')\n\t\tcmds='echo sub help'\n\t\tflags='-global1 -global2 -help -toolflag'\n",
+		"'tool echo')\n\t\tcmds=''\n\t\tflags='-dir -f -format -global1 -global2 -help -n -newline -toolflag'\n",
+		"'tool echo format'|'tool echo f')\n\t\t\tvalues='json text'\n",
+		"'tool echo dir')\n\t\t\tvalues=\"$(\"${COMP_WORDS[0]}\" __complete 'echo' '-dir='\"$value\" 2>/dev/null)\"\n",
+		"'tool sub')\n\t\tcmds='leaf help'\n\t\tflags='-global1 -global2 -help -toolflag'\n",
+		"'tool sub leaf')\n\t\tcmds=''\n\t\tflags='-global1 -global2 -help -leafflag -toolflag'\n",
+		"'tool help')\n\t\tcmds='echo sub topic'\n\t\tflags='-global1 -global2 -help -style -width'\n",
+	} {
+		if !strings.Contains(script, want) {
+			t.Errorf("script doesn't contain %q:\n%s", want, script)
+		}
+	}
+
+	// The hidden __complete mode writes the values of the flag.
+	for _, test := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"__complete", "echo", "-dir=fo"}, "fo/\nfo2/\n"},
+		{[]string{"__complete", "print", "--format=t"}, "text\n"},
+		{[]string{"__complete", "echo", "-f="}, "json\ntext\n"},
+		{[]string{"__complete", "-format="}, ""},
+		{[]string{"__complete", "nosuchcmd", "-dir="}, ""},
+		{[]string{"__complete"}, ""},
+	} {
+		var stdout bytes.Buffer
+		env := &Env{Stdout: &stdout, Stderr: &stdout, Vars: baseVars}
+		if err := ParseAndRun(tool, env, test.args); err != nil {
+			t.Errorf("%q: %v", test.args, err)
+		}
+		if got, want := stdout.String(), test.want; got != want {
+			t.Errorf("%q: got %q, want %q", test.args, got, want)
+		}
+	}
+
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash not found")
+	}
+	tests := []struct {
+		words []string
+		want  string
+	}{
+		{[]string{"tool", ""}, "echo sub help"},
+		{[]string{"tool", "s"}, "sub"},
+		{[]string{"tool", "-t"}, "-toolflag"},
+		{[]string{"tool", "echo", "-n"}, "-n -newline"},
+		{[]string{"tool", "print", "-n"}, "-n -newline"},
+		{[]string{"tool", "-toolflag", "sub", ""}, "leaf help"},
+		{[]string{"tool", "sub", "leaf", "-l"}, "-leafflag"},
+		{[]string{"tool", "help", "t"}, "topic"},
+		{[]string{"tool", "echo", "-format=j"}, "-format=json"},
+		{[]string{"tool", "echo", "--f="}, "--f=json --f=text"},
+		{[]string{"tool", "echo", "-format", "=", "t"}, "text"},
+		{[]string{"tool", "echo", "-f", "="}, "=json =text"},
+		{[]string{"tool", "echo", "-n=t"}, ""},
+		{[]string{"tool", "-format=j"}, ""},
+		{[]string{"tool", "print", "-dir=fo"}, "-dir=fo/ -dir=fo2/"},
+	}
+	// Completers other than CompleteValues are called by running the program,
+	// which is simulated by a function that checks its args.
+	fake := `tool() { [[ "$*" == "__complete echo -dir=fo" ]] && printf '%s\n' fo/ fo2/; }` + "\n"
+	for _, test := range tests {
+		var words []string
+		for _, w := range test.words {
+			words = append(words, bashQuote(w))
+		}
+		input := fmt.Sprintf("%s%sCOMP_WORDS=(%s)\nCOMP_CWORD=%d\n_tool_complete\necho \"${COMPREPLY[*]}\"\n", script, fake, strings.Join(words, " "), len(words)-1)
+		c := exec.Command(bash, "--norc", "--noprofile")
+		c.Stdin = strings.NewReader(input)
+		out, err := c.Output()
+		if err != nil {
+			t.Fatalf("%q: %v", test.words, err)
+		}
+		if got, want := strings.TrimSpace(string(out)), test.want; got != want {
+			t.Errorf("%q: got %q, want %q", test.words, got, want)
+		}
+	}
+}
@@ -0,0 +1,307 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cmdline
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// GenerateBashCompletion writes a bash completion script for the command tree
+// rooted at root to w.  The script completes subcommand names at each level of
+// the tree, and flag names for words that start with a dash.  The flags offered
+// for a command are the ones that are allowed by Parse, i.e. its own flags,
+// flags inherited from its ancestors, and the global flags.
+//
+// The script also completes the values of flags specified via "-flag=", for
+// flags with FlagCompletions.  The values of a Completer returned by
+// CompleteValues are embedded in the script.  Other Completers are called at
+// completion time, by running the program with the hidden "__complete" first
+// arg, followed by the names of the subcommands and "-flag=prefix"; the
+// candidate values are written to stdout, one per line.
+//
+// The script is typically written to a file that is sourced by the user's
+// ~/.bashrc, or to the system bash-completion directory.
+func GenerateBashCompletion(root *Command, w io.Writer) error {
+	if err := root.registerFlagDefs(); err != nil {
+		return err
+	}
+	initGlobalFlags()
+	cleanTree(root)
+	var nodes []completionNode
+	collectCompletionNodes([]*Command{root}, &nodes)
+	fn := "_" + bashIdent(root.Name) + "_complete"
+	fmt.Fprintf(w, "# bash completion for %s, generated by cmdline.\n", root.Name)
+	fmt.Fprintf(w, "%s() {\n", fn)
+	fmt.Fprintf(w, "\tlocal cur=\"${COMP_WORDS[COMP_CWORD]}\" path=%s i\n", bashQuote(root.Name))
+	// Walk the words before the cursor to find the command being completed.
+	// Words that don't name a child of the current command are skipped, since
+	// they may be flags, flag values or positional args.
+	fmt.Fprintf(w, "\tfor ((i = 1; i < COMP_CWORD; i++)); do\n")
+	if len(nodes) > 1 {
+		fmt.Fprintf(w, "\t\tcase \"$path ${COMP_WORDS[i]}\" in\n")
+		for _, node := range nodes[1:] {
+			var patterns []string
+			for _, p := range append([]string{node.path}, node.aliasPaths...) {
+				patterns = append(patterns, bashQuote(p))
+			}
+			fmt.Fprintf(w, "\t\t%s)\n", strings.Join(patterns, "|"))
+			fmt.Fprintf(w, "\t\t\tpath=%s\n", bashQuote(node.path))
+			fmt.Fprintf(w, "\t\t\t;;\n")
+		}
+		fmt.Fprintf(w, "\t\tesac\n")
+	} else {
+		fmt.Fprintf(w, "\t\t:\n")
+	}
+	fmt.Fprintf(w, "\tdone\n")
+	writeBashValueCompletion(w, nodes)
+	fmt.Fprintf(w, "\tlocal cmds flags\n")
+	fmt.Fprintf(w, "\tcase \"$path\" in\n")
+	for _, node := range nodes {
+		fmt.Fprintf(w, "\t%s)\n", bashQuote(node.path))
+		fmt.Fprintf(w, "\t\tcmds=%s\n", bashQuote(strings.Join(node.cmds, " ")))
+		fmt.Fprintf(w, "\t\tflags=%s\n", bashQuote(strings.Join(node.flags, " ")))
+		fmt.Fprintf(w, "\t\t;;\n")
+	}
+	fmt.Fprintf(w, "\tesac\n")
+	fmt.Fprintf(w, "\tif [[ \"$cur\" == -* ]]; then\n")
+	fmt.Fprintf(w, "\t\tCOMPREPLY=($(compgen -W \"$flags\" -- \"$cur\"))\n")
+	fmt.Fprintf(w, "\telse\n")
+	fmt.Fprintf(w, "\t\tCOMPREPLY=($(compgen -W \"$cmds\" -- \"$cur\"))\n")
+	fmt.Fprintf(w, "\tfi\n")
+	fmt.Fprintf(w, "}\n")
+	_, err := fmt.Fprintf(w, "complete -F %s %s\n", fn, root.Name)
+	return err
+}
+
+// writeBashValueCompletion writes the part of the bash completion script that
+// completes flag values, if any of the nodes have FlagCompletions.  The value
+// may be in the same word as the flag, or in a separate word if "=" is in
+// COMP_WORDBREAKS, which is the default.
+func writeBashValueCompletion(w io.Writer, nodes []completionNode) {
+	hasValues := false
+	for _, node := range nodes {
+		hasValues = hasValues || len(node.values) > 0
+	}
+	if !hasValues {
+		return
+	}
+	fmt.Fprintf(w, "\tlocal flag value=\"$cur\" prefix values\n")
+	fmt.Fprintf(w, "\tif [[ \"$cur\" == -*=* ]]; then\n")
+	fmt.Fprintf(w, "\t\tflag=\"${cur%%%%=*}\" value=\"${cur#*=}\" prefix=\"${cur%%%%=*}=\"\n")
+	fmt.Fprintf(w, "\telif [[ \"$cur\" == = && \"${COMP_WORDS[COMP_CWORD-1]}\" == -* ]]; then\n")
+	fmt.Fprintf(w, "\t\tflag=\"${COMP_WORDS[COMP_CWORD-1]}\" value= prefix==\n")
+	fmt.Fprintf(w, "\telif [[ \"${COMP_WORDS[COMP_CWORD-1]}\" == = && \"${COMP_WORDS[COMP_CWORD-2]}\" == -* ]]; then\n")
+	fmt.Fprintf(w, "\t\tflag=\"${COMP_WORDS[COMP_CWORD-2]}\"\n")
+	fmt.Fprintf(w, "\tfi\n")
+	fmt.Fprintf(w, "\tif [[ -n \"$flag\" ]]; then\n")
+	fmt.Fprintf(w, "\t\tflag=\"${flag#-}\"\n")
+	fmt.Fprintf(w, "\t\tcase \"$path ${flag#-}\" in\n")
+	for _, node := range nodes {
+		for _, v := range node.values {
+			var patterns []string
+			for _, name := range v.names {
+				patterns = append(patterns, bashQuote(node.path+" "+name))
+			}
+			fmt.Fprintf(w, "\t\t%s)\n", strings.Join(patterns, "|"))
+			if values, ok := v.completer.(valuesCompleter); ok {
+				fmt.Fprintf(w, "\t\t\tvalues=%s\n", bashQuote(strings.Join(values, " ")))
+			} else {
+				args := []string{completeName}
+				for _, name := range strings.Fields(node.path)[1:] {
+					args = append(args, bashQuote(name))
+				}
+				args = append(args, bashQuote("-"+v.names[0]+"=")+"\"$value\"")
+				fmt.Fprintf(w, "\t\t\tvalues=\"$(\"${COMP_WORDS[0]}\" %s 2>/dev/null)\"\n", strings.Join(args, " "))
+			}
+			fmt.Fprintf(w, "\t\t\t;;\n")
+		}
+	}
+	fmt.Fprintf(w, "\t\tesac\n")
+	fmt.Fprintf(w, "\t\tCOMPREPLY=($(compgen -P \"$prefix\" -W \"$values\" -- \"$value\"))\n")
+	fmt.Fprintf(w, "\t\treturn\n")
+	fmt.Fprintf(w, "\tfi\n")
+}
+
+// completionNode holds the completions for a single command in the tree.
+type completionNode struct {
+	path       string            // Space-separated command names from the root.
+	aliasPaths []string          // Paths ending in an alias of the command.
+	cmds       []string          // Names of the subcommands.
+	flags      []string          // Flags, including the leading dash.
+	values     []valueCompletion // Completions of flag values.
+}
+
+// valueCompletion holds the completions for the values of a single flag.
+type valueCompletion struct {
+	names     []string // Name of the flag, followed by its shorthand, if any.
+	completer Completer
+}
+
+// collectCompletionNodes appends the completionNode for the last command in
+// path, followed by the nodes for all of its descendants, to nodes.
+func collectCompletionNodes(path []*Command, nodes *[]completionNode) {
+	cmd := path[len(path)-1]
+	var names []string
+	for _, p := range path {
+		names = append(names, p.Name)
+	}
+	node := completionNode{
+		path:   strings.Join(names, " "),
+		flags:  completionFlags(path),
+		values: valueCompletions(path),
+	}
+	for _, alias := range cmd.Aliases {
+		node.aliasPaths = append(node.aliasPaths, strings.Join(names[:len(names)-1], " ")+" "+alias)
+	}
+	for _, child := range cmd.visibleChildren() {
+		node.cmds = append(node.cmds, child.Name)
+	}
+	hasHelp := len(cmd.Children) > 0 && !cmd.NoHelp
+	if hasHelp {
+		node.cmds = append(node.cmds, helpName)
+	}
+	*nodes = append(*nodes, node)
+	for _, child := range cmd.Children {
+		collectCompletionNodes(append(path, child), nodes)
+	}
+	if hasHelp {
+		// The default help command takes the names of its siblings and the help
+		// topics as args.
+		help := helpRunner{path, &helpConfig{}}.newCommand()
+		helpNode := completionNode{
+			path:  node.path + " " + helpName,
+			cmds:  append([]string(nil), node.cmds[:len(node.cmds)-1]...),
+			flags: completionFlags(append(path, help)),
+		}
+		for _, topic := range cmd.Topics {
+			helpNode.cmds = append(helpNode.cmds, topic.Name)
+		}
+		*nodes = append(*nodes, helpNode)
+	}
+}
+
+// completionFlags returns the sorted flags allowed for the last command in
+// path, including shorthands and global flags.
+func completionFlags(path []*Command) []string {
+	seen := map[string]bool{"help": true}
+	add := func(f *flag.Flag) { seen[f.Name] = true }
+	pathFlags(path).VisitAll(add)
+	pathGlobalFlags(path).VisitAll(add)
+	for _, short := range pathShorthands(path) {
+		seen[short] = true
+	}
+	var flags []string
+	for name := range seen {
+		flags = append(flags, "-"+name)
+	}
+	sort.Strings(flags)
+	return flags
+}
+
+// valueCompletions returns the valueCompletions for the flags allowed for the
+// last command in path, sorted by flag name.
+func valueCompletions(path []*Command) []valueCompletion {
+	completions, shorthands := pathFlagCompletions(path), pathShorthands(path)
+	var names []string
+	for name := range completions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var values []valueCompletion
+	for _, name := range names {
+		v := valueCompletion{names: []string{name}, completer: completions[name]}
+		if short, ok := shorthands[name]; ok {
+			v.names = append(v.names, short)
+		}
+		values = append(values, v)
+	}
+	return values
+}
+
+// pathFlagCompletions returns the FlagCompletions for the flags allowed for the
+// last command in path.  As with the flags, the closest command that defines a
+// flag wins any collisions.
+func pathFlagCompletions(path []*Command) map[string]Completer {
+	completions := make(map[string]Completer)
+	seen := make(map[string]bool)
+	for _, cmd := range flagsPath(path) {
+		cmd.Flags.VisitAll(func(f *flag.Flag) {
+			if seen[f.Name] {
+				return
+			}
+			seen[f.Name] = true
+			if c := cmd.FlagCompletions[f.Name]; c != nil {
+				completions[f.Name] = c
+			}
+		})
+	}
+	return completions
+}
+
+// completeName is the hidden first arg that runs completeRunner, which is used
+// by generated completion scripts to call Completers at completion time.
+const completeName = "__complete"
+
+// completeRunner writes the candidate values of a flag to env.Stdout, one per
+// line.  The args are the names of the subcommands of root, followed by the
+// flag and the prefix of its value, e.g. "-flag=prefix".  Nothing is written if
+// the args don't name a command and flag with FlagCompletions.
+type completeRunner struct {
+	root *Command
+}
+
+func (c completeRunner) Run(env *Env, args []string) error {
+	if len(args) == 0 {
+		return nil
+	}
+	path := []*Command{c.root}
+	for _, name := range args[:len(args)-1] {
+		var next *Command
+		for _, child := range path[len(path)-1].Children {
+			if child.matches(name) {
+				next = child
+				break
+			}
+		}
+		if next == nil {
+			return nil
+		}
+		path = append(path, next)
+	}
+	name := strings.TrimPrefix(strings.TrimPrefix(args[len(args)-1], "-"), "-")
+	name, prefix, _ := strings.Cut(name, "=")
+	for full, short := range pathShorthands(path) {
+		if name == short {
+			name = full
+		}
+	}
+	if completer := pathFlagCompletions(path)[name]; completer != nil {
+		for _, value := range completer.Complete(prefix) {
+			fmt.Fprintln(env.Stdout, value)
+		}
+	}
+	return nil
+}
+
+// bashIdent returns s with all characters that aren't valid in a bash function
+// name replaced by underscores.
+func bashIdent(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, s)
+}
+
+// bashQuote returns s as a single-quoted bash word.
+func bashQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -9,6 +9,7 @@ import (
 	"io"
 	"os"
 	"strconv"
+	"strings"
 
 	"v.io/x/lib/envvar"
 	"v.io/x/lib/lookpath"
@@ -18,15 +19,51 @@ import (
 
 // EnvFromOS returns a new environment based on the operating system.
 func EnvFromOS() *Env {
+	vars := envvar.SliceToMap(os.Environ())
 	return &Env{
-		Stdin:  os.Stdin,
-		Stdout: os.Stdout,
-		Stderr: os.Stderr,
-		Vars:   envvar.SliceToMap(os.Environ()),
-		Timer:  timing.NewTimer("root"),
+		Stdin:        os.Stdin,
+		Stdout:       os.Stdout,
+		Stderr:       os.Stderr,
+		Vars:         vars,
+		Timer:        timing.NewTimer("root"),
+		Terminal:     terminalMode(vars),
+		ShowExitCode: showExitCode(vars),
 	}
 }
 
+// showExitCode returns true iff the CMDLINE_SHOW_EXIT_CODE environment variable
+// is set to a true boolean value.
+func showExitCode(vars map[string]string) bool {
+	show, _ := strconv.ParseBool(vars["CMDLINE_SHOW_EXIT_CODE"])
+	return show
+}
+
+// terminalMode returns TerminalOn or TerminalOff if the CMDLINE_TERMINAL
+// environment variable is set to a boolean value, otherwise TerminalAuto.
+func terminalMode(vars map[string]string) TerminalMode {
+	isTerminal, err := strconv.ParseBool(vars["CMDLINE_TERMINAL"])
+	switch {
+	case err != nil:
+		return TerminalAuto
+	case isTerminal:
+		return TerminalOn
+	default:
+		return TerminalOff
+	}
+}
+
+// TerminalMode describes whether the output of an Env is a terminal.
+type TerminalMode int
+
+const (
+	// TerminalAuto detects whether the output is a terminal from the OS.
+	TerminalAuto TerminalMode = iota
+	// TerminalOn treats the output as a terminal.
+	TerminalOn
+	// TerminalOff treats the output as not being a terminal.
+	TerminalOff
+)
+
 // Env represents the environment for command parsing and running.  Typically
 // EnvFromOS is used to produce a default environment.  The environment may be
 // explicitly set for finer control; e.g. in tests.
@@ -37,6 +74,31 @@ type Env struct {
 	Vars   map[string]string // Environment variables
 	Timer  *timing.Timer
 
+	// Terminal indicates whether Stdout is a terminal.  The zero value,
+	// TerminalAuto, detects this from the OS; set it explicitly for finer
+	// control, e.g. TerminalOff forces deterministic output in tests.
+	// EnvFromOS sets it from the CMDLINE_TERMINAL environment variable.
+	// Formatting that depends on the terminal, such as defaulting to the
+	// terminal width, doesn't occur if Terminal is TerminalOff.
+	Terminal TerminalMode
+
+	// HelpOutput, if non-nil, is where usage requested via the -h or -help flags
+	// is written.  By default such usage is written to Stdout when the flags are
+	// handled by Parse, and to Stderr when handled by a subsequent call to
+	// flag.Parse.  Usage printed due to errors is always written to Stderr, and
+	// output of the help command is always written to Stdout.
+	HelpOutput io.Writer
+
+	// AssumeYes, if true, makes Confirm return true without prompting.  It is
+	// typically set by a runner from a -yes or -force flag.
+	AssumeYes bool
+
+	// ShowExitCode, if true, makes usage errors state the exit code, e.g.
+	// "ERROR: root: unknown command "foo" (exit code 2)", for scripts that
+	// parse the output.  EnvFromOS sets it from the CMDLINE_SHOW_EXIT_CODE
+	// environment variable.
+	ShowExitCode bool
+
 	// Usage is a function that prints usage information to w.  Typically set by
 	// calls to Main or Parse to print usage of the leaf command.
 	Usage func(env *Env, w io.Writer)
@@ -44,15 +106,27 @@ type Env struct {
 
 func (e *Env) clone() *Env {
 	return &Env{
-		Stdin:  e.Stdin,
-		Stdout: e.Stdout,
-		Stderr: e.Stderr,
-		Vars:   envvar.CopyMap(e.Vars),
-		Usage:  e.Usage,
-		Timer:  e.Timer, // use the same timer for all operations
+		Stdin:        e.Stdin,
+		Stdout:       e.Stdout,
+		Stderr:       e.Stderr,
+		Vars:         envvar.CopyMap(e.Vars),
+		Usage:        e.Usage,
+		Timer:        e.Timer, // use the same timer for all operations
+		Terminal:     e.Terminal,
+		HelpOutput:   e.HelpOutput,
+		AssumeYes:    e.AssumeYes,
+		ShowExitCode: e.ShowExitCode,
 	}
 }
 
+// helpOutput returns e.HelpOutput if it is set, otherwise def.
+func (e *Env) helpOutput(def io.Writer) io.Writer {
+	if e.HelpOutput != nil {
+		return e.HelpOutput
+	}
+	return def
+}
+
 // UsageErrorf prints the error message represented by the printf-style format
 // and args, followed by the output of the Usage function.  Returns ErrUsage to
 // make it easy to use from within the Runner.Run function.
@@ -60,6 +134,41 @@ func (e *Env) UsageErrorf(format string, args ...interface{}) error {
 	return usageErrorf(e, e.Usage, format, args...)
 }
 
+// Confirm writes the prompt followed by " [y/N] " to Stdout, and reads a line
+// from Stdin.  Returns true iff the line is "y" or "yes", ignoring case and
+// surrounding whitespace; an empty line, EOF or read error means no.  Returns
+// true without prompting if AssumeYes is set.
+//
+// Stdin is read a byte at a time, so that nothing beyond the line is consumed;
+// callers may continue reading from Stdin afterwards.
+func (e *Env) Confirm(prompt string) bool {
+	if e.AssumeYes {
+		return true
+	}
+	fmt.Fprintf(e.Stdout, "%s [y/N] ", prompt)
+	var line []byte
+	for buf := make([]byte, 1); ; {
+		n, err := e.Stdin.Read(buf)
+		if n > 0 {
+			if buf[0] == '\n' {
+				break
+			}
+			line = append(line, buf[0])
+		}
+		if err != nil {
+			if err != io.EOF {
+				return false
+			}
+			break
+		}
+	}
+	switch strings.ToLower(strings.TrimSpace(string(line))) {
+	case "y", "yes":
+		return true
+	}
+	return false
+}
+
 // TimerPush calls e.Timer.Push(name), only if the Timer is non-nil.
 func (e *Env) TimerPush(name string) {
 	if e.Timer != nil {
@@ -93,6 +202,9 @@ func (e *Env) LookPathPrefix(prefix string, names map[string]bool) ([]string, er
 func usageErrorf(env *Env, usage func(*Env, io.Writer), format string, args ...interface{}) error {
 	fmt.Fprint(env.Stderr, "ERROR: ")
 	fmt.Fprintf(env.Stderr, format, args...)
+	if env.ShowExitCode {
+		fmt.Fprintf(env.Stderr, " (%v)", ErrUsage)
+	}
 	fmt.Fprint(env.Stderr, "\n\n")
 	if usage != nil {
 		usage(env, env.Stderr)
@@ -109,6 +221,9 @@ func (e *Env) width() int {
 	if width, err := strconv.Atoi(e.Vars["CMDLINE_WIDTH"]); err == nil && width != 0 {
 		return width
 	}
+	if e.Terminal == TerminalOff {
+		return defaultWidth
+	}
 	if _, width, err := textutil.TerminalSize(); err == nil && width != 0 {
 		return width
 	}
@@ -121,6 +236,17 @@ func (e *Env) style() style {
 	return style
 }
 
+// separator returns the string that is repeated to form the line breaks between
+// commands in recursive help output, which defaults to "=".  Set the
+// CMDLINE_SEPARATOR environment variable to override the default; set it to
+// the empty string to separate commands with blank lines instead.
+func (e *Env) separator() string {
+	if sep, ok := e.Vars["CMDLINE_SEPARATOR"]; ok {
+		return sep
+	}
+	return "="
+}
+
 func (e *Env) prefix() string {
 	return e.Vars["CMDLINE_PREFIX"]
 }
@@ -137,6 +263,7 @@ const (
 	styleFull                   // Similar to compact but shows all global flags.
 	styleGoDoc                  // Good for godoc processing.
 	styleShortOnly              // Only output short description.
+	styleJSON                   // Machine-readable command tree.
 )
 
 func (s *style) String() string {
@@ -149,6 +276,8 @@ func (s *style) String() string {
 		return "godoc"
 	case styleShortOnly:
 		return "shortonly"
+	case styleJSON:
+		return "json"
 	default:
 		panic(fmt.Errorf("unhandled style %d", *s))
 	}
@@ -165,6 +294,8 @@ func (s *style) Set(value string) error {
 		*s = styleGoDoc
 	case "shortonly":
 		*s = styleShortOnly
+	case "json":
+		*s = styleJSON
 	default:
 		return fmt.Errorf("unknown style %q", value)
 	}
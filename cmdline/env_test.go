@@ -94,3 +94,66 @@ func TestEnvStyle(t *testing.T) {
 	}
 	os.Unsetenv("CMDLINE_STYLE")
 }
+
+func TestEnvIsTerminal(t *testing.T) {
+	tests := []struct {
+		value string
+		want  TerminalMode
+	}{
+		{"true", TerminalOn},
+		{"1", TerminalOn},
+		{"false", TerminalOff},
+		{"0", TerminalOff},
+		{"", TerminalAuto},
+		{"foobar", TerminalAuto},
+	}
+	for _, test := range tests {
+		if err := os.Setenv("CMDLINE_TERMINAL", test.value); err != nil {
+			t.Errorf("Setenv(%q) failed: %v", test.value, err)
+		} else if got, want := EnvFromOS().Terminal, test.want; got != want {
+			t.Errorf("%q got %v, want %v", test.value, got, want)
+		}
+	}
+	os.Unsetenv("CMDLINE_TERMINAL")
+	// The terminal width is never consulted if the output isn't a terminal.
+	env := &Env{Vars: map[string]string{}, Terminal: TerminalOff}
+	if got, want := env.width(), defaultWidth; got != want {
+		t.Errorf("got width %v, want %v", got, want)
+	}
+}
+
+func TestEnvConfirm(t *testing.T) {
+	tests := []struct {
+		stdin     string
+		assumeYes bool
+		want      bool
+		wantRest  string
+	}{
+		{"", false, false, ""},
+		{"\n", false, false, ""},
+		{"y\n", false, true, ""},
+		{"Yes\nmore\n", false, true, "more\n"},
+		{"  YES  ", false, true, ""},
+		{"n\n", false, false, ""},
+		{"yeah\n", false, false, ""},
+		{"no\n", true, true, "no\n"},
+	}
+	for _, test := range tests {
+		var stdout bytes.Buffer
+		stdin := bytes.NewBufferString(test.stdin)
+		env := &Env{Stdin: stdin, Stdout: &stdout, AssumeYes: test.assumeYes}
+		if got, want := env.Confirm("Delete?"), test.want; got != want {
+			t.Errorf("%q got %v, want %v", test.stdin, got, want)
+		}
+		if got, want := stdin.String(), test.wantRest; got != want {
+			t.Errorf("%q got remaining stdin %q, want %q", test.stdin, got, want)
+		}
+		wantPrompt := "Delete? [y/N] "
+		if test.assumeYes {
+			wantPrompt = ""
+		}
+		if got, want := stdout.String(), wantPrompt; got != want {
+			t.Errorf("%q got prompt %q, want %q", test.stdin, got, want)
+		}
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"go/doc/comment"
 	"io"
 	"path/filepath"
+	"reflect"
 	"regexp"
 	"strings"
 	"unicode"
@@ -33,6 +34,7 @@ func makeHelpRunner(path []*Command, env *Env) helpRunner {
 		style:     env.style(),
 		width:     env.width(),
 		prefix:    env.prefix(),
+		separator: env.separator(),
 		firstCall: env.firstCall(),
 	}}
 }
@@ -43,18 +45,32 @@ type helpConfig struct {
 	style     style
 	width     int
 	prefix    string
+	separator string // repeated to form line breaks; empty for blank lines
 	firstCall bool
+	helpFlag  bool // help was requested via the -h or -help flags
 }
 
 // Run implements the Runner interface method.
 func (h helpRunner) Run(env *Env, args []string) error {
-	w := textutil.NewUTF8WrapWriter(env.Stdout, h.width)
+	out := env.Stdout
+	if h.helpFlag {
+		out = env.helpOutput(out)
+	}
+	if h.style == styleJSON {
+		// The json output isn't wrapped, so that it remains valid.
+		return runJSONHelp(out, env, args, h.path, h.helpConfig)
+	}
+	w := textutil.NewUTF8WrapWriter(out, h.width)
 	defer w.Flush()
 	return runHelp(w, env, args, h.path, h.helpConfig)
 }
 
 // usageFunc is used as the implementation of the Env.Usage function.
 func (h helpRunner) usageFunc(env *Env, writer io.Writer) {
+	if h.style == styleJSON {
+		writeJSONUsage(writer, h.path, h.prefix) // nolint: errcheck
+		return
+	}
 	w := textutil.NewUTF8WrapWriter(writer, h.width)
 	usage(w, env, h.path, h.helpConfig, h.helpConfig.firstCall)
 	w.Flush()
@@ -89,6 +105,7 @@ The formatting style for help output:
    full      - Good for cmdline output, shows all global flags.
    godoc     - Good for godoc processing.
    shortonly - Only output short description.
+   json      - Machine-readable command tree, as used by ImportCommand.
 Override the default by setting the CMDLINE_STYLE environment variable.
 `)
 	help.Flags.IntVar(&h.width, "width", h.width, `
@@ -117,11 +134,11 @@ func runHelp(w *textutil.WrapWriter, env *Env, args []string, path []*Command, c
 	cmd, cmdPath := path[len(path)-1], pathName(config.prefix, path)
 	subName, subArgs := args[0], args[1:]
 	for _, child := range cmd.Children {
-		if child.Name == subName {
+		if child.matches(subName) {
 			return runHelp(w, env, subArgs, append(path, child), config)
 		}
 	}
-	if helpName == subName {
+	if helpName == subName && !cmd.NoHelp {
 		help := helpRunner{path, config}.newCommand()
 		return runHelp(w, env, subArgs, append(path, help), config)
 	}
@@ -184,9 +201,9 @@ func firstRuneToUpper(s string) string {
 	return string(unicode.ToUpper(r)) + s[n:]
 }
 
-func lineBreak(w *textutil.WrapWriter, style style) {
+func lineBreak(w *textutil.WrapWriter, config *helpConfig) {
 	w.Flush()
-	switch style {
+	switch config.style {
 	case styleCompact, styleFull:
 		width := w.Width()
 		if width < 0 {
@@ -194,17 +211,34 @@ func lineBreak(w *textutil.WrapWriter, style style) {
 			// need a reasonable width for our visual line break.
 			width = defaultWidth
 		}
-		fmt.Fprintln(w, strings.Repeat("=", width))
+		fmt.Fprintln(w, separatorLine(config.separator, width))
 	case styleGoDoc:
 		fmt.Fprintln(w)
 	}
 	w.Flush()
 }
 
+// separatorLine returns sep repeated to fill width runes, truncating the last
+// repetition if necessary.  Returns the empty string if sep is empty.
+func separatorLine(sep string, width int) string {
+	if sep == "" {
+		return ""
+	}
+	runes := []rune(sep)
+	line := make([]rune, width)
+	for i := range line {
+		line[i] = runes[i%len(runes)]
+	}
+	return string(line)
+}
+
 // needsHelpChild returns true if cmd needs a default help command to be
-// appended to its children.  Every command that has children and doesn't
-// already have a "help" command needs a help child.
+// appended to its children.  Every command that has children, doesn't already
+// have a "help" command, and hasn't set NoHelp needs a help child.
 func needsHelpChild(cmd *Command) bool {
+	if cmd.NoHelp {
+		return false
+	}
 	for _, child := range cmd.Children {
 		if child.Name == helpName {
 			return false
@@ -217,7 +251,7 @@ func needsHelpChild(cmd *Command) bool {
 func usageAll(w *textutil.WrapWriter, env *Env, path []*Command, config *helpConfig, firstCall bool) {
 	cmd, cmdPath := path[len(path)-1], pathName(config.prefix, path)
 	usage(w, env, path, config, firstCall)
-	for _, child := range cmd.Children {
+	for _, child := range cmd.visibleChildren() {
 		usageAll(w, env, append(path, child), config, false)
 	}
 	if firstCall && needsHelpChild(cmd) {
@@ -259,13 +293,13 @@ func usageAll(w *textutil.WrapWriter, env *Env, path []*Command, config *helpCon
 				continue
 			}
 			// The external child does not support "help" or "-help".
-			lineBreak(w, config.style)
+			lineBreak(w, config)
 			subName := strings.TrimPrefix(filepath.Base(subCmd), cmdPrefix)
 			fmt.Fprintln(w, godocHeader(cmdPath+" "+subName, missingDescription))
 		}
 	}
 	for _, topic := range cmd.Topics {
-		lineBreak(w, config.style)
+		lineBreak(w, config)
 		w.ForceVerbatim(true)
 		fmt.Fprintln(w, godocHeader(cmdPath+" "+topic.Name, topic.Short))
 		w.ForceVerbatim(false)
@@ -287,23 +321,23 @@ func usage(w *textutil.WrapWriter, env *Env, path []*Command, config *helpConfig
 		return
 	}
 	if !firstCall {
-		lineBreak(w, config.style)
+		lineBreak(w, config)
 		w.ForceVerbatim(true)
 		fmt.Fprintln(w, godocHeader(cmdPath, cmd.Short))
 		w.ForceVerbatim(false)
 		fmt.Fprintln(w)
 	}
-	fmt.Fprintln(w, cmd.Long)
+	fmt.Fprintln(w, cmd.long())
 	fmt.Fprintln(w)
 	// Usage line.
 	fmt.Fprintln(w, "Usage:")
 	cmdPathF := "   " + cmdPath
-	if countFlags(pathFlags(path), nil, true) > 0 || countFlags(globalFlags, nil, true) > 0 {
+	if countFlags(pathFlags(path), nil, true) > 0 || countFlags(pathGlobalFlags(path), nil, true) > 0 {
 		cmdPathF += " [flags]"
 	}
 	if cmd.Runner != nil {
-		if cmd.ArgsName != "" {
-			fmt.Fprintln(w, cmdPathF, cmd.ArgsName)
+		if argsName := cmd.argsName(); argsName != "" {
+			fmt.Fprintln(w, cmdPathF, argsName)
 		} else {
 			fmt.Fprintln(w, cmdPathF)
 		}
@@ -313,6 +347,7 @@ func usage(w *textutil.WrapWriter, env *Env, path []*Command, config *helpConfig
 	if cmd.LookPath {
 		extChildren, _ = env.LookPathPrefix(cmdPrefix, cmd.subNames(cmdPrefix))
 	}
+	children := cmd.visibleChildren()
 	hasSubcommands := len(cmd.Children) > 0 || len(extChildren) > 0
 	if hasSubcommands {
 		fmt.Fprintln(w, cmdPathF, "<command>")
@@ -324,8 +359,8 @@ func usage(w *textutil.WrapWriter, env *Env, path []*Command, config *helpConfig
 	}
 	const minNameWidth = 11
 	nameWidth := minNameWidth
-	for _, child := range cmd.Children {
-		if w := len(child.Name); w > nameWidth {
+	for _, child := range children {
+		if w := len(child.displayName()); w > nameWidth {
 			nameWidth = w
 		}
 	}
@@ -338,16 +373,29 @@ func usage(w *textutil.WrapWriter, env *Env, path []*Command, config *helpConfig
 	// Built-in commands.
 	if len(cmd.Children) > 0 {
 		w.SetIndents()
-		fmt.Fprintln(w, "The", cmdPath, "commands are:")
+		ungrouped, groups := groupChildren(children, config.style)
+		showHelp := firstCall && needsHelpChild(cmd)
+		if len(ungrouped) > 0 || showHelp {
+			fmt.Fprintln(w, "The", cmdPath, "commands are:")
+		}
 		// Print as a table with aligned columns Name and Short.
 		w.SetIndents(spaces(3), spaces(3+nameWidth+1))
-		for _, child := range cmd.Children {
-			printShort(nameWidth, child.Name, child.Short)
+		for _, child := range ungrouped {
+			printShort(nameWidth, child.displayName(), child.Short)
 		}
 		// Default help command.
-		if firstCall && needsHelpChild(cmd) {
+		if showHelp {
 			printShort(nameWidth, helpName, helpShort)
 		}
+		// Grouped commands, each under their own heading.
+		for _, group := range groups {
+			w.SetIndents()
+			fmt.Fprintf(w, "%s:\n", group.name)
+			w.SetIndents(spaces(3), spaces(3+nameWidth+1))
+			for _, child := range group.children {
+				printShort(nameWidth, child.displayName(), child.Short)
+			}
+		}
 	}
 	// External commands.
 	if len(extChildren) > 0 {
@@ -374,14 +422,14 @@ func usage(w *textutil.WrapWriter, env *Env, path []*Command, config *helpConfig
 	// Command footer.
 	if hasSubcommands {
 		w.SetIndents()
-		if firstCall && config.style != styleGoDoc {
+		if firstCall && config.style != styleGoDoc && !cmd.NoHelp {
 			fmt.Fprintf(w, "Run \"%s help [command]\" for command usage.\n", cmdPath)
 		}
 	}
 	// Args.
-	if cmd.Runner != nil && cmd.ArgsLong != "" {
+	if argsLong := cmd.argsLong(cmdPath); cmd.Runner != nil && argsLong != "" {
 		fmt.Fprintln(w)
-		fmt.Fprintln(w, cmd.ArgsLong)
+		fmt.Fprintln(w, argsLong)
 	}
 	// Help topics.
 	if len(cmd.Topics) > 0 {
@@ -403,15 +451,19 @@ func usage(w *textutil.WrapWriter, env *Env, path []*Command, config *helpConfig
 			fmt.Fprintf(w, "Run \"%s help [topic]\" for topic details.\n", cmdPath)
 		}
 	}
-	hidden := flagsUsage(w, path, config)
+	omitZero := omitZeroFlagValues(path)
+	hidden := flagsUsage(w, path, config, omitZero)
 	// Only show global flags on the first call.
 	if firstCall {
-		hidden = globalFlagsUsage(w, config) || hidden
+		hidden = globalFlagsUsage(w, pathGlobalFlags(path), config, omitZero) || hidden
 	}
 	if hidden {
 		fmt.Fprintln(w)
 		fullhelp := fmt.Sprintf(`Run "%s help -style=full" to show all flags.`, cmdPath)
-		if len(cmd.Children) == 0 {
+		switch {
+		case cmd.NoHelp:
+			fullhelp = fmt.Sprintf(`Run "CMDLINE_STYLE=full %s -help" to show all flags.`, cmdPath)
+		case len(cmd.Children) == 0:
 			if len(path) > 1 {
 				parentPath := pathName(config.prefix, path[:len(path)-1])
 				fullhelp = fmt.Sprintf(`Run "%s help -style=full %s" to show all flags.`, parentPath, cmd.Name)
@@ -423,9 +475,41 @@ func usage(w *textutil.WrapWriter, env *Env, path []*Command, config *helpConfig
 	}
 }
 
-func flagsUsage(w *textutil.WrapWriter, path []*Command, config *helpConfig) bool {
+// commandGroup is a named group of commands, shown under its own heading.
+type commandGroup struct {
+	name     string
+	children []*Command
+}
+
+// groupChildren splits children into the ungrouped commands, and the groups of
+// commands that have a Group.  The godoc style ignores grouping, so all
+// children are returned as ungrouped.
+func groupChildren(children []*Command, style style) ([]*Command, []commandGroup) {
+	if style == styleGoDoc {
+		return children, nil
+	}
+	var ungrouped []*Command
+	var groups []commandGroup
+	index := make(map[string]int)
+	for _, child := range children {
+		if child.Group == "" {
+			ungrouped = append(ungrouped, child)
+			continue
+		}
+		gx, ok := index[child.Group]
+		if !ok {
+			gx = len(groups)
+			index[child.Group] = gx
+			groups = append(groups, commandGroup{name: child.Group})
+		}
+		groups[gx].children = append(groups[gx].children, child)
+	}
+	return ungrouped, groups
+}
+
+func flagsUsage(w *textutil.WrapWriter, path []*Command, config *helpConfig, omitZero bool) bool {
 	cmd, cmdPath := path[len(path)-1], pathName(config.prefix, path)
-	allFlags := pathFlags(path)
+	allFlags, shorthands := pathFlags(path), pathShorthands(path)
 	numCompact := countFlags(&cmd.Flags, nil, true)
 	numFull := countFlags(allFlags, nil, true) - numCompact
 	if config.style == styleCompact {
@@ -433,7 +517,7 @@ func flagsUsage(w *textutil.WrapWriter, path []*Command, config *helpConfig) boo
 		if numCompact > 0 {
 			fmt.Fprintln(w)
 			fmt.Fprintln(w, "The", cmdPath, "flags are:")
-			printFlags(w, &cmd.Flags, nil, config.style, nil, true)
+			printFlags(w, &cmd.Flags, nil, config.style, nil, true, omitZero, shorthands)
 		}
 		return numFull > 0
 	}
@@ -441,24 +525,24 @@ func flagsUsage(w *textutil.WrapWriter, path []*Command, config *helpConfig) boo
 	if numCompact > 0 || numFull > 0 {
 		fmt.Fprintln(w)
 		fmt.Fprintln(w, "The", cmdPath, "flags are:")
-		printFlags(w, &cmd.Flags, nil, config.style, nil, true)
+		printFlags(w, &cmd.Flags, nil, config.style, nil, true, omitZero, shorthands)
 		if numCompact > 0 && numFull > 0 {
 			fmt.Fprintln(w)
 		}
-		printFlags(w, allFlags, &cmd.Flags, config.style, nil, true)
+		printFlags(w, allFlags, &cmd.Flags, config.style, nil, true, omitZero, shorthands)
 	}
 	return false
 }
 
-func globalFlagsUsage(w *textutil.WrapWriter, config *helpConfig) bool {
-	numCompact := countFlags(globalFlags, nonHiddenGlobalFlags, true)
-	numFull := countFlags(globalFlags, nonHiddenGlobalFlags, false)
+func globalFlagsUsage(w *textutil.WrapWriter, flags *flag.FlagSet, config *helpConfig, omitZero bool) bool {
+	numCompact := countFlags(flags, nonHiddenGlobalFlags, true)
+	numFull := countFlags(flags, nonHiddenGlobalFlags, false)
 	if config.style == styleCompact {
 		// Compact style, only show compact flags.
 		if numCompact > 0 {
 			fmt.Fprintln(w)
 			fmt.Fprintln(w, "The global flags are:")
-			printFlags(w, globalFlags, nil, config.style, nonHiddenGlobalFlags, true)
+			printFlags(w, flags, nil, config.style, nonHiddenGlobalFlags, true, omitZero, nil)
 		}
 		return numFull > 0
 	}
@@ -466,11 +550,11 @@ func globalFlagsUsage(w *textutil.WrapWriter, config *helpConfig) bool {
 	if numCompact > 0 || numFull > 0 {
 		fmt.Fprintln(w)
 		fmt.Fprintln(w, "The global flags are:")
-		printFlags(w, globalFlags, nil, config.style, nonHiddenGlobalFlags, true)
+		printFlags(w, flags, nil, config.style, nonHiddenGlobalFlags, true, omitZero, nil)
 		if numCompact > 0 && numFull > 0 {
 			fmt.Fprintln(w)
 		}
-		printFlags(w, globalFlags, nil, config.style, nonHiddenGlobalFlags, false)
+		printFlags(w, flags, nil, config.style, nonHiddenGlobalFlags, false, omitZero, nil)
 	}
 	return false
 }
@@ -484,7 +568,48 @@ func countFlags(flags *flag.FlagSet, regexps []*regexp.Regexp, match bool) (num
 	return
 }
 
-func printFlags(w *textutil.WrapWriter, flags, filter *flag.FlagSet, style style, regexps []*regexp.Regexp, match bool) {
+// omitZeroFlagValues returns true iff OmitZeroFlagValues is set on any command
+// in the path.
+func omitZeroFlagValues(path []*Command) bool {
+	for _, cmd := range path {
+		if cmd.OmitZeroFlagValues {
+			return true
+		}
+	}
+	return false
+}
+
+// isZeroValue returns true iff value is the string representation of the zero
+// value of the flag's type.  Mirrors the logic in the standard flag package.
+func isZeroValue(f *flag.Flag, value string) (isZero bool) {
+	defer func() {
+		// The String method of some flag.Value implementations may panic when
+		// called on a zero value; treat those as non-zero.
+		if recover() != nil {
+			isZero = false
+		}
+	}()
+	var z reflect.Value
+	if typ := reflect.TypeOf(f.Value); typ.Kind() == reflect.Ptr {
+		z = reflect.New(typ.Elem())
+	} else {
+		z = reflect.Zero(typ)
+	}
+	return value == z.Interface().(flag.Value).String()
+}
+
+// DefaultStringer is an optional interface that may be implemented by
+// flag.Value types to control how their default value is shown in usage
+// messages.  If implemented, DefaultString is used in place of the String
+// method and flag.Flag.DefValue, which may be confusing for custom types,
+// e.g. "<nil>".
+type DefaultStringer interface {
+	DefaultString() string
+}
+
+// printFlags prints the usage of flags, except for those in filter.  The
+// shorthands map flag names to their shorthand, which is shown alongside.
+func printFlags(w *textutil.WrapWriter, flags, filter *flag.FlagSet, style style, regexps []*regexp.Regexp, match, omitZero bool, shorthands map[string]string) {
 	flags.VisitAll(func(f *flag.Flag) {
 		if filter != nil && filter.Lookup(f.Name) != nil {
 			return
@@ -498,7 +623,18 @@ func printFlags(w *textutil.WrapWriter, flags, filter *flag.FlagSet, style style
 			// help will show "/usr/home/me/foo" while godoc will show "$HOME/foo".
 			value = f.DefValue
 		}
-		fmt.Fprintf(w, " -%s=%v", f.Name, value)
+		if ds, ok := f.Value.(DefaultStringer); ok {
+			value = ds.DefaultString()
+		}
+		name := "-" + f.Name
+		if short, ok := shorthands[f.Name]; ok {
+			name = "-" + short + ", " + name
+		}
+		if omitZero && isZeroValue(f, value) {
+			fmt.Fprintf(w, " %s", name)
+		} else {
+			fmt.Fprintf(w, " %s=%v", name, value)
+		}
 		w.SetIndents(spaces(3))
 		fmt.Fprintln(w, f.Usage)
 		w.SetIndents()
@@ -0,0 +1,213 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cmdline
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// jsonCommand is the representation of a command tree produced by the json
+// help style, and consumed by ImportCommand.
+type jsonCommand struct {
+	Name     string        `json:"name"`
+	Aliases  []string      `json:"aliases,omitempty"`
+	Hidden   bool          `json:"hidden,omitempty"`
+	Short    string        `json:"short,omitempty"`
+	Long     string        `json:"long,omitempty"`
+	ArgsName string        `json:"argsName,omitempty"`
+	ArgsLong string        `json:"argsLong,omitempty"`
+	Runner   bool          `json:"runner,omitempty"`
+	Flags    []jsonFlag    `json:"flags,omitempty"`
+	Children []jsonCommand `json:"children,omitempty"`
+	Topics   []jsonTopic   `json:"topics,omitempty"`
+}
+
+type jsonFlag struct {
+	Name    string `json:"name"`
+	Usage   string `json:"usage,omitempty"`
+	Default string `json:"default,omitempty"`
+	Bool    bool   `json:"bool,omitempty"`
+}
+
+type jsonTopic struct {
+	Name  string `json:"name"`
+	Short string `json:"short,omitempty"`
+	Long  string `json:"long,omitempty"`
+}
+
+// newJSONCommand returns the json representation of the tree rooted at the
+// last command in path.  The default help commands aren't included.
+func newJSONCommand(path []*Command, prefix string) jsonCommand {
+	cmd := path[len(path)-1]
+	j := jsonCommand{
+		Name:     cmd.Name,
+		Aliases:  cmd.Aliases,
+		Hidden:   cmd.Hidden,
+		Short:    cmd.Short,
+		Long:     cmd.long(),
+		ArgsName: cmd.argsName(),
+		ArgsLong: cmd.argsLong(pathName(prefix, path)),
+		Runner:   cmd.Runner != nil,
+	}
+	cmd.Flags.VisitAll(func(f *flag.Flag) {
+		bf, ok := f.Value.(interface{ IsBoolFlag() bool })
+		j.Flags = append(j.Flags, jsonFlag{
+			Name:    f.Name,
+			Usage:   f.Usage,
+			Default: f.DefValue,
+			Bool:    ok && bf.IsBoolFlag(),
+		})
+	})
+	for _, child := range cmd.Children {
+		j.Children = append(j.Children, newJSONCommand(append(path, child), prefix))
+	}
+	for _, topic := range cmd.Topics {
+		j.Topics = append(j.Topics, jsonTopic(topic))
+	}
+	return j
+}
+
+// runJSONHelp implements the help command for the json style, writing the
+// tree rooted at the command identified by args to w.
+func runJSONHelp(w io.Writer, env *Env, args []string, path []*Command, config *helpConfig) error {
+	for _, subName := range args {
+		cmd, found := path[len(path)-1], false
+		for _, child := range cmd.Children {
+			if child.matches(subName) {
+				path, found = append(path, child), true
+				break
+			}
+		}
+		if !found {
+			fn := helpRunner{path, config}.usageFunc
+			return usageErrorf(env, fn, "%s: unknown command %q", pathName(config.prefix, path), subName)
+		}
+	}
+	return writeJSONUsage(w, path, config.prefix)
+}
+
+func writeJSONUsage(w io.Writer, path []*Command, prefix string) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(newJSONCommand(path, prefix))
+}
+
+// ImportCommand returns a command tree that mirrors the tree of the
+// cmdline-based binary, which is obtained by running it with the -help flag,
+// and CMDLINE_STYLE set to "json".  The binary may be a name to look up in
+// PATH, or a path to an executable.
+//
+// The returned tree may be added to the Children of another command, so that
+// the commands of the binary are shown in the help of the parent, like any
+// other children.  Running an imported command runs the binary with the
+// corresponding subcommand names, followed by the imported flags that were set
+// on the command line, and the args.  The root of the returned tree is named
+// after the root command of the binary; set its Name to choose another name.
+func ImportCommand(env *Env, binary string) (*Command, error) {
+	if !strings.ContainsRune(binary, filepath.Separator) {
+		path, err := env.LookPath(binary)
+		if err != nil {
+			return nil, err
+		}
+		binary = path
+	}
+	var stdout, stderr bytes.Buffer
+	envCopy := env.clone()
+	envCopy.Stdin = nil
+	envCopy.Stdout = &stdout
+	envCopy.Stderr = &stderr
+	envCopy.Vars["CMDLINE_STYLE"] = "json"
+	delete(envCopy.Vars, "CMDLINE_PREFIX")
+	if err := (binaryRunner{binary, ""}).Run(envCopy, []string{"-help"}); err != nil {
+		return nil, fmt.Errorf("%s -help: %v\n%s", binary, err, stderr.String())
+	}
+	var j jsonCommand
+	if err := json.Unmarshal(stdout.Bytes(), &j); err != nil {
+		return nil, fmt.Errorf("%s -help: invalid json usage: %v", binary, err)
+	}
+	return newImportedCommand(binary, nil, nil, j), nil
+}
+
+// newImportedCommand returns the command corresponding to j, which is reached
+// by running binary with the subcommand names in path.  The flags are those of
+// the ancestors of j, which are also allowed after j.
+func newImportedCommand(binary string, path []string, flags []*importedFlag, j jsonCommand) *Command {
+	cmd := &Command{
+		Name:    j.Name,
+		Aliases: j.Aliases,
+		Hidden:  j.Hidden,
+		Short:   j.Short,
+		Long:    j.Long,
+	}
+	if len(j.Children) == 0 {
+		cmd.ArgsName = j.ArgsName
+		cmd.ArgsLong = j.ArgsLong
+	}
+	// Copy flags, so that appending doesn't affect our siblings.
+	flags = append([]*importedFlag(nil), flags...)
+	for _, jf := range j.Flags {
+		f := &importedFlag{name: jf.Name, value: jf.Default, isBool: jf.Bool}
+		cmd.Flags.Var(f, jf.Name, jf.Usage)
+		flags = append(flags, f)
+	}
+	if j.Runner {
+		cmd.Runner = importRunner{binary, path, flags}
+	}
+	for _, jc := range j.Children {
+		childPath := append(append([]string(nil), path...), jc.Name)
+		cmd.Children = append(cmd.Children, newImportedCommand(binary, childPath, flags, jc))
+	}
+	for _, jt := range j.Topics {
+		cmd.Topics = append(cmd.Topics, Topic(jt))
+	}
+	return cmd
+}
+
+// importedFlag is a flag.Value that records the value of a flag of an imported
+// command, so that it can be passed through to the binary.
+type importedFlag struct {
+	name, value string
+	isBool, set bool
+}
+
+func (f *importedFlag) String() string {
+	if f == nil {
+		return ""
+	}
+	return f.value
+}
+
+func (f *importedFlag) Set(value string) error {
+	f.value, f.set = value, true
+	return nil
+}
+
+func (f *importedFlag) IsBoolFlag() bool {
+	return f.isBool
+}
+
+// importRunner runs an imported command, by running its binary with the
+// subcommand names in path, followed by the flags that were set.
+type importRunner struct {
+	binary string
+	path   []string
+	flags  []*importedFlag
+}
+
+func (r importRunner) Run(env *Env, args []string) error {
+	binArgs := append([]string(nil), r.path...)
+	for _, f := range r.flags {
+		if f.set {
+			binArgs = append(binArgs, "-"+f.name+"="+f.value)
+		}
+	}
+	return binaryRunner{r.binary, ""}.Run(env, append(binArgs, args...))
+}
@@ -4,7 +4,10 @@ go 1.18
 
 require (
 	github.com/spf13/pflag v1.0.5
+	go.opentelemetry.io/otel/trace v1.7.0
 	golang.org/x/crypto v0.28.0
 	golang.org/x/net v0.30.0
 	golang.org/x/sys v0.26.0
 )
+
+require go.opentelemetry.io/otel v1.7.0 // indirect
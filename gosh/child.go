@@ -29,6 +29,18 @@ func SendVars(vars map[string]string) {
 	fmt.Fprintf(os.Stderr, "%s%s%s\n", varsPrefix, data, varsSuffix)
 }
 
+// readyVar is the reserved var sent by sendReady.
+const readyVar = "goshReady"
+
+// sendReady sends readyVar to the parent process if the parent requested it
+// via Cmd.SendReady. Called by InitMain immediately before running the Func.
+func sendReady() {
+	if os.Getenv(envSendReady) != "" {
+		os.Unsetenv(envSendReady)
+		SendVars(map[string]string{readyVar: "1"})
+	}
+}
+
 // watchParent periodically checks whether the parent process has exited and, if
 // so, kills the current process. Meant to be run in a goroutine.
 func watchParent() {
@@ -26,7 +26,12 @@ var (
 	errAlreadyCalledWait  = errors.New("gosh: already called Cmd.Wait")
 	errAlreadySetStdin    = errors.New("gosh: already set stdin")
 	errDidNotCallStart    = errors.New("gosh: did not call Cmd.Start")
+	errDidNotCallWait     = errors.New("gosh: did not call Cmd.Wait")
+	errOutputDiscarded    = errors.New("gosh: output was discarded")
 	errProcessExited      = errors.New("gosh: process exited")
+	errReadyTimeout       = errors.New("gosh: timed out waiting for ready")
+	errSendReadyNotSet    = errors.New("gosh: Cmd.SendReady not set")
+	errNoStdinPipe        = errors.New("gosh: stdin is not a pipe")
 )
 
 // Cmd represents a command. Not thread-safe.
@@ -34,14 +39,20 @@ var (
 type Cmd struct {
 	// Err is the most recent error from this Cmd (may be nil).
 	Err error
-	// Path is the path of the command to run.
+	// Path is the path of the command to run. A relative path that contains a
+	// separator, e.g. "./bin/tool", is resolved against Dir if set, or else
+	// against the Shell's working directory (see Shell.Pushd) at the time the
+	// Cmd was created, rather than the process's working directory at Start.
 	Path string
+	// Dir is the working directory of the command. If empty, the command runs in
+	// the process's working directory. A relative Dir is resolved like Path.
+	Dir string
 	// Vars is the map of env vars for this Cmd.
 	Vars map[string]string
 	// Args is the list of args for this Cmd, starting with the resolved path.
 	// Note, we set Args[0] to the resolved path (rather than the user-specified
 	// name) so that a command started by Shell can reliably determine the path to
-	// its executable.
+	// its executable. Use AppendArgs to add args.
 	Args []string
 	// IgnoreParentExit, if true, makes it so the child process does not exit when
 	// its parent exits. Only takes effect if the child process was spawned via
@@ -51,10 +62,31 @@ type Cmd struct {
 	// the given duration has elapsed. Only takes effect if the child process was
 	// spawned via Shell.FuncCmd or explicitly calls InitChildMain.
 	ExitAfter time.Duration
+	// SendReady, if true, specifies that the child process should send a
+	// reserved var to the parent once the Func begins executing, for use with
+	// AwaitReady. Only takes effect if the child process was spawned via
+	// Shell.FuncCmd.
+	SendReady bool
 	// PropagateOutput is inherited from Shell.PropagateChildOutput.
 	PropagateOutput bool
 	// OutputDir is inherited from Shell.ChildOutputDir.
 	OutputDir string
+	// OutputMaxSize, if positive, is the maximum size in bytes of each file
+	// written to OutputDir. Once a file would exceed this size, it is rotated:
+	// e.g. "foo.stdout" is renamed to "foo.stdout.1", any existing
+	// "foo.stdout.1" is renamed to "foo.stdout.2", and so on, and writing
+	// continues in a new "foo.stdout". A single write is never split across
+	// files.
+	OutputMaxSize int64
+	// OutputMaxFiles is the maximum number of rotated files to keep for each
+	// stream when OutputMaxSize is positive; older files are deleted. If zero,
+	// it defaults to 5.
+	OutputMaxFiles int
+	// TimestampOutput, if true, records each chunk of stdout and stderr output
+	// read from the child process along with the time it was read, for latency
+	// analysis. Each chunk typically corresponds to a single write by the child.
+	// Use OutputChunks to retrieve the chunks.
+	TimestampOutput bool
 	// ExitErrorIsOk specifies whether an *exec.ExitError should be reported via
 	// Shell.HandleError.
 	ExitErrorIsOk bool
@@ -65,28 +97,64 @@ type Cmd struct {
 	// closed pipe error occurs, Cmd.Err will be nil, and no err is reported to
 	// Shell.HandleError.
 	IgnoreClosedPipeError bool
+	// FailOnStderr, if true, causes Wait to return an error if the child process
+	// wrote anything to stderr, other than the gosh vars used to communicate
+	// with the parent. The error includes the captured stderr.
+	FailOnStderr bool
 	// ExtraFiles is used to populate ExtraFiles in the underlying exec.Cmd
 	// object. Does not get cloned.
 	ExtraFiles []*os.File
 	// Internal state.
 	sh                *Shell
+	baseDir           string // working directory when created, for resolving Path and Dir
 	c                 *exec.Cmd
 	calledStart       bool
 	calledWait        bool
 	cond              *sync.Cond
 	waitChan          chan error
+	doneChan          chan struct{} // closed once the process has exited
+	startHookDone     chan struct{} // closed once Shell.OnCmdStart has returned
 	stdinDoneChan     chan error
-	started           bool // protected by sh.cleanupMu
-	exited            bool // protected by cond.L
-	calledCleanup     bool // protected by cleanupMu
+	stdinPipeCloser   io.Closer // set by stdinPipe
+	started           bool      // protected by sh.cleanupMu; written under cond.L
+	exited            bool      // protected by cond.L
+	calledCleanup     bool      // protected by cleanupMu
 	cleanupMu         sync.Mutex
 	stdoutHeadTail    *headTail
 	stderrHeadTail    *headTail
+	stdoutFull        *bytes.Buffer // set by CaptureStdout, Stdout, etc.
+	stderrFull        *bytes.Buffer // set by StdoutStderr
 	stdoutWriters     []io.Writer
 	stderrWriters     []io.Writer
 	afterStartClosers []io.Closer
 	afterWaitClosers  []io.Closer
 	recvVars          map[string]string // protected by cond.L
+	recording         *Recording        // set if started in record mode
+	recordingIndex    int               // index of this Cmd in recording
+	recordStdout      *bytes.Buffer
+	recordStderr      *bytes.Buffer
+	replayed          *RecordedCmd              // set if started in replay or dry-run mode
+	ignoreDryRun      bool                      // run even if Shell.DryRun is set
+	rlimits           []rlimit                  // set by SetRlimit
+	outputDecoder     func(io.Writer) io.Writer // set by SetOutputDecoder
+	stderrTripwire    *tripwireWriter           // set if FailOnStderr
+	ptyMaster         *os.File                  // set by AllocatePTY
+	ptyDoneChan       chan error                // receives the result of copying from ptyMaster
+	chunksMu          sync.Mutex
+	chunks            []OutputChunk // protected by chunksMu, set if TimestampOutput
+}
+
+// rlimit is a resource limit set by Cmd.SetRlimit.
+type rlimit struct {
+	resource int
+	cur, max uint64
+}
+
+// OutputChunk represents a chunk of output read from a child process.
+type OutputChunk struct {
+	Time   time.Time // when the chunk was read
+	Stream string    // "stdout" or "stderr"
+	Data   []byte
 }
 
 // Shell returns the shell that this Cmd was created from.
@@ -102,11 +170,32 @@ func (c *Cmd) Clone() *Cmd {
 	return res
 }
 
+// AppendArgs appends the given args to the command's Args, after the resolved
+// path in Args[0] and any args already present. Must be called before Start.
+func (c *Cmd) AppendArgs(args ...string) {
+	c.sh.Ok()
+	c.handleError(c.appendArgs(args...))
+}
+
+// SetCleanEnv replaces the command's Vars with a copy of vars, so that the child
+// process runs with only the given env vars, rather than with vars inherited
+// from the Shell. The var that tells a child spawned via Shell.FuncCmd which
+// Func to run is preserved. Must be called before Start.
+//
+// Note that the command's path was already resolved when the Cmd was created,
+// using the PATH in Shell.Vars; the PATH in vars, if any, only affects the
+// child process itself.
+func (c *Cmd) SetCleanEnv(vars map[string]string) {
+	c.sh.Ok()
+	c.handleError(c.setCleanEnv(vars))
+}
+
 // StdinPipe returns a WriteCloser backed by an unlimited-size pipe for the
 // command's stdin. The pipe will be closed when the process exits, but may also
 // be closed earlier by the caller, e.g. if the command does not exit until its
 // stdin is closed. Must be called before Start. Only one call may be made to
-// StdinPipe or SetStdinReader; subsequent calls will fail.
+// StdinPipe, SetStdinReader, SetStdinChannel or InheritStdin; subsequent calls
+// will fail.
 func (c *Cmd) StdinPipe() io.WriteCloser {
 	c.sh.Ok()
 	res, err := c.stdinPipe()
@@ -138,14 +227,45 @@ func (c *Cmd) StderrPipe() io.ReadCloser {
 	return res
 }
 
+// CloseStdin closes the command's stdin pipe, so that the command reads EOF
+// once it has consumed all data written so far. It is equivalent to calling
+// Close on the WriteCloser returned by StdinPipe, and is useful for signaling
+// EOF in manually constructed pipelines. Requires that stdin was configured via
+// StdinPipe or SetStdinChannel; in the latter case, subsequently received
+// slices are discarded. May be called more than once.
+func (c *Cmd) CloseStdin() {
+	c.sh.Ok()
+	c.handleError(c.closeStdin())
+}
+
 // SetStdinReader configures this Cmd to read stdin from the given Reader. Must
-// be called before Start. Only one call may be made to StdinPipe or
-// SetStdinReader; subsequent calls will fail.
+// be called before Start. Only one call may be made to StdinPipe,
+// SetStdinReader, SetStdinChannel or InheritStdin; subsequent calls will fail.
 func (c *Cmd) SetStdinReader(r io.Reader) {
 	c.sh.Ok()
 	c.handleError(c.setStdinReader(r))
 }
 
+// SetStdinChannel configures this Cmd to write each slice received from ch to
+// the command's stdin, and to close stdin once ch is closed. If the process
+// exits before ch is closed, subsequently received slices are discarded, so
+// that senders never block indefinitely. Must be called before Start. Only one
+// call may be made to StdinPipe, SetStdinReader, SetStdinChannel or
+// InheritStdin; subsequent calls will fail.
+func (c *Cmd) SetStdinChannel(ch <-chan []byte) {
+	c.sh.Ok()
+	c.handleError(c.setStdinChannel(ch))
+}
+
+// InheritStdin configures this Cmd to read stdin directly from the parent's
+// os.Stdin, e.g. to run an interactive command from a terminal. Must be called
+// before Start. Only one call may be made to StdinPipe, SetStdinReader,
+// SetStdinChannel or InheritStdin; subsequent calls will fail.
+func (c *Cmd) InheritStdin() {
+	c.sh.Ok()
+	c.handleError(c.setStdinReader(os.Stdin))
+}
+
 // AddStdoutWriter configures this Cmd to tee stdout to the given Writer. Must
 // be called before Start. If the same Writer is passed to both AddStdoutWriter
 // and AddStderrWriter, Cmd will ensure that Write is never called concurrently.
@@ -162,6 +282,43 @@ func (c *Cmd) AddStderrWriter(w io.Writer) {
 	c.handleError(c.addStderrWriter(w))
 }
 
+// CaptureStdout configures this Cmd to tee stdout to the returned Buffer, for
+// use when driving the command via Start and Wait rather than via Stdout. Must
+// be called before Start. The Buffer must not be accessed until Wait (or
+// Terminate, etc.) has returned.
+func (c *Cmd) CaptureStdout() *bytes.Buffer {
+	c.sh.Ok()
+	res, err := c.captureStdout()
+	c.handleError(err)
+	return res
+}
+
+// DiscardOutput configures this Cmd to not retain the head and tail of its
+// stdout and stderr, which are otherwise buffered in memory (up to 64KB each)
+// so that they can be logged if the command fails. This is useful for
+// long-running commands that write a lot of output that nobody reads. The
+// tradeoff is that if the command fails, its output will not be available to
+// help diagnose the failure. Other destinations configured for the command's
+// output (e.g. StdoutPipe, AddStdoutWriter, PropagateOutput, OutputDir) are
+// unaffected. Must be called before Start.
+func (c *Cmd) DiscardOutput() {
+	c.sh.Ok()
+	c.handleError(c.discardOutput())
+}
+
+// SetOutputDecoder configures this Cmd to pass its stdout and stderr through
+// decoders created by the given function, before they reach any other
+// destination (e.g. Stdout, StdoutPipe, AddStdoutWriter, PropagateOutput,
+// OutputDir). The function is called once for each stream, and should return a
+// Writer that writes the decoded form of its input to w, e.g. to transcode
+// Latin-1 output to UTF-8. If the returned Writer is also an io.Closer, it is
+// closed once the process exits, before any other destination is closed, so
+// that it can flush any buffered output. Must be called before Start.
+func (c *Cmd) SetOutputDecoder(f func(w io.Writer) io.Writer) {
+	c.sh.Ok()
+	c.handleError(c.setOutputDecoder(f))
+}
+
 // Start starts the command.
 func (c *Cmd) Start() {
 	c.sh.Ok()
@@ -177,6 +334,28 @@ func (c *Cmd) AwaitVars(keys ...string) map[string]string {
 	return res
 }
 
+// AwaitVarsTimeout is like AwaitVars, but gives up once the given timeout has
+// elapsed or the process has exited, without reporting an error. Returns the
+// vars that were received, along with the keys for which no value was
+// received. A non-positive timeout means no timeout. Must not be called before
+// Start or after Wait.
+func (c *Cmd) AwaitVarsTimeout(timeout time.Duration, keys ...string) (map[string]string, []string) {
+	c.sh.Ok()
+	res, missing, err := c.awaitVarsTimeout(timeout, keys...)
+	c.handleError(err)
+	return res, missing
+}
+
+// AwaitReady waits for the child process to confirm that its Func has begun
+// executing. Requires SendReady to have been set before Start. Fails if the
+// process exits without confirming, or if the given timeout elapses first; a
+// non-positive timeout means no timeout. Must not be called before Start or
+// after Wait.
+func (c *Cmd) AwaitReady(timeout time.Duration) {
+	c.sh.Ok()
+	c.handleError(c.awaitReady(timeout))
+}
+
 // Wait waits for the command to exit.
 func (c *Cmd) Wait() {
 	c.sh.Ok()
@@ -197,6 +376,41 @@ func (c *Cmd) Terminate(sig os.Signal) {
 	c.handleError(c.terminate(sig))
 }
 
+// TerminateGracefully sends a signal to the underlying process, then waits up
+// to the given grace period for it to exit. If the process is still running
+// once the grace period has elapsed, it is killed as if by Kill. Like Terminate,
+// TerminateGracefully succeeds as long as the process exits, regardless of the
+// exit code.
+func (c *Cmd) TerminateGracefully(sig os.Signal, grace time.Duration) {
+	c.sh.Ok()
+	c.handleError(c.terminateGracefully(sig, grace))
+}
+
+// DumpStacks sends SIGQUIT to the underlying process, then waits for it to exit
+// and returns the head and tail of its stderr. A Go program responds to SIGQUIT
+// by writing the stack traces of all its goroutines to stderr, then exiting
+// with exit code 2; thus DumpStacks is useful for debugging a hung FuncCmd
+// child, e.g. one that has deadlocked. Like Terminate, DumpStacks succeeds as
+// long as the process exits, regardless of the exit code. If the process hasn't
+// installed its signal handlers yet, or isn't a Go program, it may exit without
+// writing any stack traces. On Windows, where there is no SIGQUIT, the process
+// is killed and no stack traces are written.
+func (c *Cmd) DumpStacks() string {
+	c.sh.Ok()
+	res, err := c.dumpStacks()
+	c.handleError(err)
+	return res
+}
+
+// Kill causes the underlying process to exit immediately, by calling
+// os.Process.Kill. Unlike Signal(os.Kill), it does not go through
+// TranslateSignal. Kill does not wait for the process to exit; call Wait to do
+// so.
+func (c *Cmd) Kill() {
+	c.sh.Ok()
+	c.handleError(c.kill())
+}
+
 // Run calls Start followed by Wait.
 func (c *Cmd) Run() {
 	c.sh.Ok()
@@ -229,14 +443,102 @@ func (c *Cmd) CombinedOutput() string {
 	return res
 }
 
-// Pid returns the command's PID, or -1 if the command has not been started.
+// CopyStdoutTo writes the stdout of this Cmd to w, e.g. to archive it once the
+// command has failed. If the full stdout was captured, via CaptureStdout,
+// Stdout or StdoutStderr, it is written in its entirety; otherwise, the
+// retained head and tail of stdout are written, with a marker in place of any
+// skipped bytes. Must be called after Wait, and fails if DiscardOutput was
+// called.
+func (c *Cmd) CopyStdoutTo(w io.Writer) {
+	c.sh.Ok()
+	c.handleError(c.copyOutputTo(w, c.stdoutFull, c.stdoutHeadTail))
+}
+
+// CopyStderrTo is like CopyStdoutTo, but for stderr. The full stderr is only
+// captured by StdoutStderr.
+func (c *Cmd) CopyStderrTo(w io.Writer) {
+	c.sh.Ok()
+	c.handleError(c.copyOutputTo(w, c.stderrFull, c.stderrHeadTail))
+}
+
+// Environ returns the environment that the command is started with, as a slice
+// of "key=value" strings sorted by key: Vars, along with the reserved vars that
+// configure the child process, e.g. for FuncCmd. It reflects the current Vars
+// and options, so it may be called before Start, e.g. to diagnose why the child
+// process didn't see a var.
+func (c *Cmd) Environ() []string {
+	vars := copyMap(c.Vars)
+	if c.IgnoreParentExit {
+		delete(vars, envWatchParent)
+	} else {
+		vars[envWatchParent] = "1"
+	}
+	if c.ExitAfter == 0 {
+		delete(vars, envExitAfter)
+	} else {
+		vars[envExitAfter] = c.ExitAfter.String()
+	}
+	if c.SendReady {
+		vars[envSendReady] = "1"
+	} else {
+		delete(vars, envSendReady)
+	}
+	c.setPlatformVars(vars)
+	return mapToSlice(vars)
+}
+
+// String returns the command's args joined by spaces, starting with the
+// resolved path.
+func (c *Cmd) String() string {
+	return strings.Join(c.Args, " ")
+}
+
+// Pid returns the command's PID, or -1 if the command has not been started or
+// was replayed (see Shell.Replay).
 func (c *Cmd) Pid() int {
-	if !c.started {
+	if !c.started || c.replayed != nil {
 		return -1
 	}
 	return c.c.Process.Pid
 }
 
+// ExitSignal returns the signal that terminated the underlying process and
+// true, if the process died due to a signal, e.g. to check that Terminate
+// killed it with SIGTERM. Returns nil and false if the process exited normally,
+// if Wait (or Terminate, etc.) has not been called, or if the command was
+// replayed (see Shell.Replay).
+func (c *Cmd) ExitSignal() (os.Signal, bool) {
+	if !c.calledWait || c.replayed != nil {
+		return nil, false
+	}
+	return exitSignal(c.c.ProcessState)
+}
+
+// OutputChunks returns the chunks of output read from the child process so far,
+// in the order they were read, if TimestampOutput was set. Unlike most Cmd
+// methods, it is thread-safe, and may be called while the command is running.
+func (c *Cmd) OutputChunks() []OutputChunk {
+	c.chunksMu.Lock()
+	defer c.chunksMu.Unlock()
+	return append([]OutputChunk(nil), c.chunks...)
+}
+
+// IsRunning returns true iff the command has been started and has not yet
+// exited. Unlike most Cmd methods, it is thread-safe, and may be called
+// concurrently with Wait.
+func (c *Cmd) IsRunning() bool {
+	return c.isRunning()
+}
+
+// WaitChan returns a channel that is closed once the underlying process has
+// exited and its output has been fully processed, e.g. for use in a select
+// statement. Unlike Wait, it does not report the exit status, and may be called
+// any number of times, both before and after Start and Wait. If Start is never
+// called, the returned channel is never closed.
+func (c *Cmd) WaitChan() <-chan struct{} {
+	return c.doneChan
+}
+
 // Internals
 // =========
 
@@ -248,9 +550,11 @@ func newCmdInternal(sh *Shell, vars map[string]string, path string, args []strin
 		Vars:           vars,
 		Args:           append([]string{path}, args...),
 		sh:             sh,
+		baseDir:        getwd(),
 		c:              &exec.Cmd{},
 		cond:           sync.NewCond(&sync.Mutex{}),
 		waitChan:       make(chan error, 1),
+		doneChan:       make(chan struct{}),
 		stdoutHeadTail: newHeadTail(headTailCapacity),
 		stderrHeadTail: newHeadTail(headTailCapacity),
 		recvVars:       map[string]string{},
@@ -269,17 +573,58 @@ func newCmd(sh *Shell, vars map[string]string, name string, args ...string) (*Cm
 	// Mimics https://golang.org/src/os/exec/exec.go Command.
 	if filepath.Base(name) == name {
 		lp, err := lookpath.Look(sh.Vars, name)
-		if err != nil {
+		switch {
+		case err == nil:
+			name = lp
+		case sh.replaying == nil:
+			// Replayed commands aren't executed, so they needn't exist.
 			return nil, fmt.Errorf("gosh: failed to locate executable: %s", name)
 		}
-		name = lp
 	}
 	return newCmdInternal(sh, vars, name, args)
 }
 
+// getwd returns the working directory of the process, or "" if it can't be
+// determined, in which case relative paths are left to the os/exec package.
+func getwd() string {
+	dir, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	return dir
+}
+
+// dir returns c.Dir, resolving a relative Dir against c.baseDir.
+func (c *Cmd) dir() string {
+	if c.Dir == "" || filepath.IsAbs(c.Dir) || c.baseDir == "" {
+		return c.Dir
+	}
+	return filepath.Join(c.baseDir, c.Dir)
+}
+
+// path returns c.Path, resolving a relative path that contains a separator
+// against the directory returned by c.dir, or else c.baseDir. Names without a
+// separator were already looked up in PATH by newCmd.
+func (c *Cmd) path() string {
+	if filepath.IsAbs(c.Path) || filepath.Base(c.Path) == c.Path {
+		return c.Path
+	}
+	base := c.dir()
+	if base == "" {
+		base = c.baseDir
+	}
+	if base == "" {
+		return c.Path
+	}
+	return filepath.Join(base, c.Path)
+}
+
 func isExitError(err error) bool {
-	_, ok := err.(*exec.ExitError)
-	return ok
+	switch err.(type) {
+	case *exec.ExitError, *replayExitError:
+		return true
+	}
+	return false
 }
 
 func (c *Cmd) errorIsOk(err error) bool {
@@ -321,7 +666,7 @@ func (c *Cmd) handleError(err error) {
 		err = nil
 	}
 	if isExitError(err) && !c.sh.ContinueOnError {
-		c.sh.tb.Logf("gosh: command failed: %s\n", strings.Join(c.Args, " "))
+		c.sh.tb.Logf("gosh: command failed: %s\n", c)
 		c.sh.tb.Logf("\nSTDOUT\n%s\n%s\n", sep, c.stdoutHeadTail.String())
 		c.sh.tb.Logf("\nSTDERR\n%s\n%s\n", sep, c.stderrHeadTail.String())
 	}
@@ -329,12 +674,17 @@ func (c *Cmd) handleError(err error) {
 }
 
 func (c *Cmd) isRunning() bool {
-	if !c.started {
-		return false
-	}
 	c.cond.L.Lock()
 	defer c.cond.L.Unlock()
-	return !c.exited
+	return c.started && !c.exited
+}
+
+// setStarted sets c.started under cond.L, so that isRunning may be called from
+// any goroutine.
+func (c *Cmd) setStarted() {
+	c.cond.L.Lock()
+	c.started = true
+	c.cond.L.Unlock()
 }
 
 // recvWriter listens for gosh vars from a child process.
@@ -384,10 +734,73 @@ func (w *recvWriter) Write(p []byte) (n int, err error) {
 	return len(p), nil
 }
 
+// tripwireWriter records whether anything other than gosh vars was written to
+// it. Like recvWriter, it recognizes gosh vars by their prefix and suffix; the
+// newline that follows each vars message is also ignored.
+type tripwireWriter struct {
+	matchedPrefix int
+	matchedSuffix int
+	inVars        bool // matched the prefix, looking for the suffix
+	afterVars     bool // just matched the suffix
+	wrote         bool
+}
+
+func (w *tripwireWriter) Write(p []byte) (n int, err error) {
+	for _, b := range p {
+		if w.wrote {
+			break
+		}
+		switch {
+		case w.inVars:
+			if b != varsSuffix[w.matchedSuffix] {
+				w.matchedSuffix = 0
+			}
+			if b == varsSuffix[w.matchedSuffix] {
+				w.matchedSuffix++
+			}
+			if w.matchedSuffix == len(varsSuffix) {
+				w.inVars, w.afterVars, w.matchedSuffix = false, true, 0
+			}
+		case w.afterVars && b == '\n':
+			w.afterVars = false
+		default:
+			w.afterVars = false
+			if b != varsPrefix[w.matchedPrefix] {
+				// Any partially matched prefix was ordinary output.
+				w.wrote = w.matchedPrefix > 0
+				w.matchedPrefix = 0
+			}
+			if b != varsPrefix[w.matchedPrefix] {
+				w.wrote = true
+				continue
+			}
+			w.matchedPrefix++
+			if w.matchedPrefix == len(varsPrefix) {
+				w.inVars, w.matchedPrefix = true, 0
+			}
+		}
+	}
+	return len(p), nil
+}
+
+// tripped returns true if anything other than complete gosh vars messages was
+// written. It must be called after all writes have completed.
+func (w *tripwireWriter) tripped() bool {
+	return w.wrote || w.matchedPrefix > 0 || w.inVars
+}
+
 func (c *Cmd) makeStdoutStderr() (io.Writer, io.Writer, error) {
 	c.stderrWriters = append(c.stderrWriters, &recvWriter{c: c})
-	c.stdoutWriters = append(c.stdoutWriters, c.stdoutHeadTail)
-	c.stderrWriters = append(c.stderrWriters, c.stderrHeadTail)
+	if c.FailOnStderr {
+		c.stderrTripwire = &tripwireWriter{}
+		c.stderrWriters = append(c.stderrWriters, c.stderrTripwire)
+	}
+	if c.stdoutHeadTail != nil {
+		c.stdoutWriters = append(c.stdoutWriters, c.stdoutHeadTail)
+	}
+	if c.stderrHeadTail != nil {
+		c.stderrWriters = append(c.stderrWriters, c.stderrHeadTail)
+	}
 	if c.PropagateOutput {
 		c.stdoutWriters = append(c.stdoutWriters, os.Stdout)
 		c.stderrWriters = append(c.stderrWriters, os.Stderr)
@@ -395,15 +808,14 @@ func (c *Cmd) makeStdoutStderr() (io.Writer, io.Writer, error) {
 	if c.OutputDir != "" {
 		t := time.Now().Format("20060102.150405.000000")
 		name := filepath.Join(c.OutputDir, filepath.Base(c.Path)+"."+t)
-		const flags = os.O_WRONLY | os.O_CREATE | os.O_EXCL
-		switch file, err := os.OpenFile(name+".stdout", flags, 0600); {
+		switch file, err := openOutputFile(name+".stdout", c.OutputMaxSize, c.OutputMaxFiles); {
 		case err != nil:
 			return nil, nil, err
 		default:
 			c.stdoutWriters = append(c.stdoutWriters, file)
 			c.afterWaitClosers = append(c.afterWaitClosers, file)
 		}
-		switch file, err := os.OpenFile(name+".stderr", flags, 0600); {
+		switch file, err := openOutputFile(name+".stderr", c.OutputMaxSize, c.OutputMaxFiles); {
 		case err != nil:
 			return nil, nil, err
 		default:
@@ -411,21 +823,63 @@ func (c *Cmd) makeStdoutStderr() (io.Writer, io.Writer, error) {
 			c.afterWaitClosers = append(c.afterWaitClosers, file)
 		}
 	}
+	var stdout, stderr io.Writer
 	switch hasOut, hasErr := len(c.stdoutWriters) > 0, len(c.stderrWriters) > 0; {
 	case hasOut && hasErr:
 		// Make writes synchronous between stdout and stderr. This ensures all
 		// writers that capture both will see the same ordering, and don't need to
 		// worry about concurrent writes.
 		sharedMu := &sync.Mutex{}
-		stdout := &sharedLockWriter{sharedMu, io.MultiWriter(c.stdoutWriters...)}
-		stderr := &sharedLockWriter{sharedMu, io.MultiWriter(c.stderrWriters...)}
-		return stdout, stderr, nil
+		stdout = &sharedLockWriter{sharedMu, io.MultiWriter(c.stdoutWriters...)}
+		stderr = &sharedLockWriter{sharedMu, io.MultiWriter(c.stderrWriters...)}
 	case hasOut:
-		return io.MultiWriter(c.stdoutWriters...), nil, nil
+		stdout = io.MultiWriter(c.stdoutWriters...)
 	case hasErr:
-		return nil, io.MultiWriter(c.stderrWriters...), nil
+		stderr = io.MultiWriter(c.stderrWriters...)
 	}
-	return nil, nil, nil
+	if c.outputDecoder != nil {
+		stdout, stderr = c.decodeOutput(stdout), c.decodeOutput(stderr)
+	}
+	if c.TimestampOutput {
+		stdout, stderr = c.timestampOutput(stdout, "stdout"), c.timestampOutput(stderr, "stderr")
+	}
+	return stdout, stderr, nil
+}
+
+// timestampOutput returns w wrapped to record each write as an OutputChunk, or
+// nil if w is nil.
+func (c *Cmd) timestampOutput(w io.Writer, stream string) io.Writer {
+	if w == nil {
+		return nil
+	}
+	return &chunkWriter{c, stream, w}
+}
+
+type chunkWriter struct {
+	c      *Cmd
+	stream string
+	w      io.Writer
+}
+
+func (w *chunkWriter) Write(p []byte) (int, error) {
+	chunk := OutputChunk{time.Now(), w.stream, append([]byte(nil), p...)}
+	w.c.chunksMu.Lock()
+	w.c.chunks = append(w.c.chunks, chunk)
+	w.c.chunksMu.Unlock()
+	return w.w.Write(p)
+}
+
+// decodeOutput returns w wrapped by the output decoder, or nil if w is nil. If
+// the decoder is an io.Closer, it is closed before the other afterWaitClosers.
+func (c *Cmd) decodeOutput(w io.Writer) io.Writer {
+	if w == nil {
+		return nil
+	}
+	dec := c.outputDecoder(w)
+	if closer, ok := dec.(io.Closer); ok {
+		c.afterWaitClosers = append([]io.Closer{closer}, c.afterWaitClosers...)
+	}
+	return dec
 }
 
 type sharedLockWriter struct {
@@ -447,12 +901,24 @@ func (c *Cmd) clone() (*Cmd, error) {
 	if err != nil {
 		return nil, err
 	}
+	res.baseDir = c.baseDir
+	res.Dir = c.Dir
 	res.IgnoreParentExit = c.IgnoreParentExit
 	res.ExitAfter = c.ExitAfter
+	res.SendReady = c.SendReady
+	res.rlimits = append([]rlimit(nil), c.rlimits...)
+	res.outputDecoder = c.outputDecoder
 	res.PropagateOutput = c.PropagateOutput
 	res.OutputDir = c.OutputDir
+	res.OutputMaxSize = c.OutputMaxSize
+	res.OutputMaxFiles = c.OutputMaxFiles
 	res.ExitErrorIsOk = c.ExitErrorIsOk
 	res.IgnoreClosedPipeError = c.IgnoreClosedPipeError
+	res.FailOnStderr = c.FailOnStderr
+	res.TimestampOutput = c.TimestampOutput
+	if c.stdoutHeadTail == nil {
+		res.stdoutHeadTail, res.stderrHeadTail = nil, nil
+	}
 	return res, nil
 }
 
@@ -482,11 +948,35 @@ func (c *Cmd) stdinPipe() (io.WriteCloser, error) {
 	c.afterStartClosers = append(c.afterStartClosers, pr)
 	bp := newBufferedPipe()
 	c.afterWaitClosers = append(c.afterWaitClosers, bp)
+	c.stdinPipeCloser = bp
 	c.stdinDoneChan = make(chan error, 1)
 	go c.stdinPipeCopier(pw, bp) // pw is closed by stdinPipeCopier
 	return bp, nil
 }
 
+func (c *Cmd) closeStdin() error {
+	if c.stdinPipeCloser == nil {
+		return errNoStdinPipe
+	}
+	return c.stdinPipeCloser.Close()
+}
+
+func (c *Cmd) setStdinChannel(ch <-chan []byte) error {
+	stdin, err := c.stdinPipe()
+	if err != nil {
+		return err
+	}
+	go func() {
+		for b := range ch {
+			// Writes only fail once the pipe has been closed after the process
+			// exited; keep draining ch regardless.
+			stdin.Write(b)
+		}
+		stdin.Close()
+	}()
+	return nil
+}
+
 func (c *Cmd) stdinPipeCopier(dst io.WriteCloser, src io.Reader) {
 	var firstErr error
 	if _, err := io.Copy(dst, src); err != nil && !isClosedPipeError(err) {
@@ -513,15 +1003,61 @@ func isClosedPipeError(err error) bool {
 
 	// Process exited due to a SIGPIPE signal.
 	if ee, ok := err.(*exec.ExitError); ok {
-		if ws, ok := ee.ProcessState.Sys().(syscall.WaitStatus); ok {
-			if ws.Signaled() && ws.Signal() == syscall.SIGPIPE {
-				return true
-			}
+		if sig, ok := exitSignal(ee.ProcessState); ok && sig == syscall.SIGPIPE {
+			return true
 		}
 	}
 	return false
 }
 
+// exitSignal returns the signal that terminated the process described by ps,
+// if any.
+func exitSignal(ps *os.ProcessState) (os.Signal, bool) {
+	if ps == nil {
+		return nil, false
+	}
+	if ws, ok := ps.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		return ws.Signal(), true
+	}
+	return nil, false
+}
+
+func (c *Cmd) discardOutput() error {
+	if c.calledStart {
+		return errAlreadyCalledStart
+	}
+	c.stdoutHeadTail, c.stderrHeadTail = nil, nil
+	return nil
+}
+
+func (c *Cmd) setCleanEnv(vars map[string]string) error {
+	if c.calledStart {
+		return errAlreadyCalledStart
+	}
+	res := copyMap(vars)
+	if v, ok := c.Vars[envInvocation]; ok {
+		res[envInvocation] = v
+	}
+	c.Vars = res
+	return nil
+}
+
+func (c *Cmd) appendArgs(args ...string) error {
+	if c.calledStart {
+		return errAlreadyCalledStart
+	}
+	c.Args = append(c.Args, args...)
+	return nil
+}
+
+func (c *Cmd) setOutputDecoder(f func(w io.Writer) io.Writer) error {
+	if c.calledStart {
+		return errAlreadyCalledStart
+	}
+	c.outputDecoder = f
+	return nil
+}
+
 func (c *Cmd) setStdinReader(r io.Reader) error {
 	switch {
 	case c.calledStart:
@@ -561,6 +1097,18 @@ func (c *Cmd) addStdoutWriter(w io.Writer) error {
 	return nil
 }
 
+func (c *Cmd) captureStdout() (*bytes.Buffer, error) {
+	if c.calledStart {
+		return nil, errAlreadyCalledStart
+	}
+	buf := &bytes.Buffer{}
+	c.stdoutWriters = append(c.stdoutWriters, buf)
+	if c.stdoutFull == nil {
+		c.stdoutFull = buf
+	}
+	return buf, nil
+}
+
 func (c *Cmd) addStderrWriter(w io.Writer) error {
 	if c.calledStart {
 		return errAlreadyCalledStart
@@ -574,8 +1122,22 @@ func (c *Cmd) addStderrWriter(w io.Writer) error {
 // ensures that the child process is reaped once it exits. Note, gosh.Cmd.wait
 // blocks on waitChan.
 func (c *Cmd) startExitWaiter() {
+	start := time.Now()
+	c.startHookDone = make(chan struct{})
 	go func() {
-		waitErr := c.c.Wait()
+		var waitErr error
+		if c.replayed != nil {
+			waitErr = c.replayOutput()
+		} else {
+			waitErr = c.c.Wait()
+		}
+		if c.ptyDoneChan != nil {
+			// Wait for the output written to the terminal to be copied, before the
+			// afterWaitClosers are closed.
+			if err := <-c.ptyDoneChan; waitErr == nil {
+				waitErr = err
+			}
+		}
 		c.cond.L.Lock()
 		c.exited = true
 		c.cond.Signal()
@@ -589,11 +1151,37 @@ func (c *Cmd) startExitWaiter() {
 				waitErr = err
 			}
 		}
+		if waitErr == nil && c.stderrTripwire != nil && c.stderrTripwire.tripped() {
+			waitErr = fmt.Errorf("gosh: process wrote to stderr:\n%s", c.stderrHeadTail)
+		}
+		c.finishRecording()
+		// Write the transcript entry before unblocking Cmd.Wait, so that the entry
+		// is available once Wait returns.
+		c.sh.writeTranscriptEntry(c, start, waitErr)
+		// Run the exit hook before unblocking Cmd.Wait, but never before the start
+		// hook has returned.
+		<-c.startHookDone
+		if f := c.sh.OnCmdExit; f != nil {
+			f(c, waitErr)
+		}
+		close(c.doneChan)
 		c.waitChan <- waitErr
 		c.cleanupProcessGroup()
 	}()
 }
 
+// runStartHook is deferred by Cmd.start, so that Shell.OnCmdStart runs once
+// start has released its locks. It does nothing if the command didn't start.
+func (c *Cmd) runStartHook() {
+	if !c.started {
+		return
+	}
+	if f := c.sh.OnCmdStart; f != nil {
+		f(c)
+	}
+	close(c.startHookDone)
+}
+
 func closeClosers(closers []io.Closer) error {
 	var firstErr error
 	for _, closer := range closers {
@@ -604,14 +1192,26 @@ func closeClosers(closers []io.Closer) error {
 	return firstErr
 }
 
-// TODO(sadovsky): Maybe add optional timeouts for Cmd.{awaitVars,wait}.
+// TODO(sadovsky): Maybe add an optional timeout for Cmd.wait.
 
 func (c *Cmd) awaitVars(keys ...string) (map[string]string, error) {
+	res, missing, err := c.awaitVarsTimeout(0, keys...)
+	if err != nil {
+		return nil, err
+	}
+	// With no timeout, missing keys mean the process exited.
+	if len(missing) > 0 {
+		return nil, errProcessExited
+	}
+	return res, nil
+}
+
+func (c *Cmd) awaitVarsTimeout(timeout time.Duration, keys ...string) (map[string]string, []string, error) {
 	switch {
 	case !c.started:
-		return nil, errDidNotCallStart
+		return nil, nil, errDidNotCallStart
 	case c.calledWait:
-		return nil, errAlreadyCalledWait
+		return nil, nil, errAlreadyCalledWait
 	}
 	wantKeys := map[string]bool{}
 	for _, key := range keys {
@@ -625,18 +1225,48 @@ func (c *Cmd) awaitVars(keys ...string) (map[string]string, error) {
 			}
 		}
 	}
+	timedOut := false // protected by cond.L
+	if timeout > 0 {
+		timer := time.AfterFunc(timeout, func() {
+			c.cond.L.Lock()
+			timedOut = true
+			c.cond.Broadcast()
+			c.cond.L.Unlock()
+		})
+		defer timer.Stop()
+	}
 	c.cond.L.Lock()
 	defer c.cond.L.Unlock()
 	updateRes()
-	for !c.exited && len(res) < len(wantKeys) {
+	for !c.exited && !timedOut && len(res) < len(wantKeys) {
 		c.cond.Wait()
 		updateRes()
 	}
-	// Return nil error if both conditions triggered simultaneously.
-	if len(res) < len(wantKeys) {
-		return nil, errProcessExited
+	var missing []string
+	for _, key := range keys {
+		if _, ok := res[key]; !ok && wantKeys[key] {
+			missing = append(missing, key)
+			// Avoid reporting duplicate keys more than once.
+			delete(wantKeys, key)
+		}
 	}
-	return res, nil
+	return res, missing, nil
+}
+
+func (c *Cmd) awaitReady(timeout time.Duration) error {
+	if !c.SendReady {
+		return errSendReadyNotSet
+	}
+	_, missing, err := c.awaitVarsTimeout(timeout, readyVar)
+	switch {
+	case err != nil:
+		return err
+	case len(missing) == 0:
+		return nil
+	case c.isRunning():
+		return errReadyTimeout
+	}
+	return errProcessExited
 }
 
 func (c *Cmd) wait() error {
@@ -657,10 +1287,7 @@ func (c *Cmd) wait() error {
 const errFinished = "os: process already finished"
 
 // NOTE(sadovsky): Technically speaking, Process.Signal(os.Kill) is different
-// from Process.Kill. Currently, gosh.Cmd does not provide a way to trigger
-// Process.Kill. If it proves necessary, we'll add a "gosh.Kill" implementation
-// of the os.Signal interface, and have the signal and terminate methods map
-// that to Process.Kill.
+// from Process.Kill. Use kill to trigger Process.Kill.
 func (c *Cmd) signal(sig os.Signal) error {
 	switch {
 	case !c.started:
@@ -668,7 +1295,7 @@ func (c *Cmd) signal(sig os.Signal) error {
 	case c.calledWait:
 		return errAlreadyCalledWait
 	}
-	if !c.isRunning() {
+	if !c.isRunning() || c.replayed != nil {
 		return nil
 	}
 	if err := c.c.Process.Signal(TranslateSignal(sig)); err != nil && err.Error() != errFinished {
@@ -678,17 +1305,75 @@ func (c *Cmd) signal(sig os.Signal) error {
 	return nil
 }
 
+func (c *Cmd) kill() error {
+	switch {
+	case !c.started:
+		return errDidNotCallStart
+	case c.calledWait:
+		return errAlreadyCalledWait
+	}
+	if !c.isRunning() || c.replayed != nil {
+		return nil
+	}
+	if err := c.c.Process.Kill(); err != nil && err.Error() != errFinished {
+		return err
+	}
+	return nil
+}
+
 func (c *Cmd) terminate(sig os.Signal) error {
 	if err := c.signal(sig); err != nil {
 		return err
 	}
-	if err := c.wait(); err != nil {
-		// Succeed as long as the process exited, regardless of the exit code.
-		if _, ok := err.(*exec.ExitError); !ok {
+	return c.waitForExit()
+}
+
+func (c *Cmd) copyOutputTo(w io.Writer, full *bytes.Buffer, ht *headTail) error {
+	switch {
+	case !c.calledWait:
+		return errDidNotCallWait
+	case full != nil:
+		_, err := w.Write(full.Bytes())
+		return err
+	case ht == nil:
+		return errOutputDiscarded
+	}
+	_, err := w.Write(ht.Bytes())
+	return err
+}
+
+func (c *Cmd) dumpStacks() (string, error) {
+	if err := c.terminate(syscall.SIGQUIT); err != nil {
+		return "", err
+	}
+	return c.stderrHeadTail.String(), nil
+}
+
+// waitForExit is like wait, but succeeds as long as the process exited,
+// regardless of the exit code.
+func (c *Cmd) waitForExit() error {
+	if err := c.wait(); err != nil && !isExitError(err) {
+		return err
+	}
+	return nil
+}
+
+func (c *Cmd) terminateGracefully(sig os.Signal, grace time.Duration) error {
+	if err := c.signal(sig); err != nil {
+		return err
+	}
+	timer := time.NewTimer(grace)
+	defer timer.Stop()
+	select {
+	case <-c.doneChan:
+		// The process exited within the grace period.
+		return c.waitForExit()
+	case <-timer.C:
+		if err := c.kill(); err != nil {
 			return err
 		}
+		return c.waitForExit()
 	}
-	return nil
 }
 
 func (c *Cmd) run() error {
@@ -704,6 +1389,7 @@ func (c *Cmd) stdout() (string, error) {
 	}
 	var stdout bytes.Buffer
 	c.stdoutWriters = append(c.stdoutWriters, &stdout)
+	c.stdoutFull = &stdout
 	err := c.run()
 	return stdout.String(), err
 }
@@ -715,6 +1401,7 @@ func (c *Cmd) stdoutStderr() (string, string, error) {
 	var stdout, stderr bytes.Buffer
 	c.stdoutWriters = append(c.stdoutWriters, &stdout)
 	c.stderrWriters = append(c.stderrWriters, &stderr)
+	c.stdoutFull, c.stderrFull = &stdout, &stderr
 	err := c.run()
 	return stdout.String(), stderr.String(), err
 }
@@ -766,18 +1453,28 @@ func (b *headTail) Write(p []byte) (int, error) {
 	return len(p), nil
 }
 
-// String returns the buffer as a string.
+// String returns the buffer as a string. A nil buffer indicates that the output
+// was discarded.
 func (b *headTail) String() string {
+	if b == nil {
+		return "[ discarded ]"
+	}
 	if b.nWritten == 0 {
 		return "[ empty ]"
 	}
+	return string(b.Bytes())
+}
+
+// Bytes returns the written bytes, with a marker in place of any bytes that
+// were skipped because they were neither in the head nor the tail.
+func (b *headTail) Bytes() []byte {
 	if b.tail == nil {
-		return string(b.head[:b.nWritten])
+		return b.head[:b.nWritten]
 	}
 	tail := b.tail.String()
 	skipped := b.nWritten - 2*len(b.head)
 	if skipped <= 0 {
-		return fmt.Sprintf("%s%s", b.head, tail)
+		return []byte(fmt.Sprintf("%s%s", b.head, tail))
 	}
-	return fmt.Sprintf("%s\n[ ... skipping %d bytes ... ]\n%s", b.head, skipped, tail)
+	return []byte(fmt.Sprintf("%s\n[ ... skipping %d bytes ... ]\n%s", b.head, skipped, tail))
 }
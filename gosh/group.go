@@ -0,0 +1,72 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gosh
+
+import (
+	"errors"
+)
+
+var errGroupOtherShell = errors.New("gosh: command was created from a different Shell")
+
+// Group represents a set of commands that are waited for together, separately
+// from the other commands started by the same Shell. For example, a test may
+// start a set of worker commands in a Group and wait for just those, while
+// background servers started by the Shell keep running. Not thread-safe.
+type Group struct {
+	sh   *Shell
+	cmds []*Cmd
+}
+
+// Group returns a new, empty Group of commands.
+func (sh *Shell) Group() *Group {
+	sh.Ok()
+	return &Group{sh: sh}
+}
+
+// Cmds returns the commands in the group.
+func (g *Group) Cmds() []*Cmd {
+	return g.cmds
+}
+
+// Start starts c and adds it to the group. The command must have been created
+// from the same Shell as the group.
+func (g *Group) Start(c *Cmd) {
+	g.sh.Ok()
+	if c.sh != g.sh {
+		g.sh.handleError(errGroupOtherShell)
+		return
+	}
+	c.handleError(g.start(c))
+}
+
+// Wait waits for all commands in the group to exit, skipping any that have
+// already been waited for. Commands are waited for even if an earlier one
+// failed; the last failure is reported.
+func (g *Group) Wait() {
+	g.sh.Ok()
+	g.sh.handleError(g.wait())
+}
+
+func (g *Group) start(c *Cmd) error {
+	if err := c.start(); err != nil {
+		return err
+	}
+	g.cmds = append(g.cmds, c)
+	return nil
+}
+
+func (g *Group) wait() error {
+	var res error
+	for _, c := range g.cmds {
+		if c.calledWait {
+			continue
+		}
+		if err := c.wait(); !c.errorIsOk(err) {
+			g.sh.tb.Logf("%s (PID %d) failed: %v\n", c.Path, c.Pid(), err)
+			res = err
+		}
+	}
+	return res
+}
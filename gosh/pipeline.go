@@ -9,6 +9,7 @@ import (
 	"errors"
 	"io"
 	"os"
+	"sync"
 )
 
 // Pipeline represents a pipeline of commands, where the stdout and/or stderr of
@@ -246,10 +247,23 @@ func (p *Pipeline) pipeTo(c *Cmd, mode pipeMode, clone bool) (e error) {
 		}
 	}
 	p.cmds = append(p.cmds, c)
-	p.state = append(p.state, pipeState{mode, pr, pw})
+	p.state = append(p.state, pipeState{mode, pr, &onceCloser{c: pw}})
 	return nil
 }
 
+// onceCloser wraps an io.Closer, such that only the first Close call closes the
+// underlying Closer. Subsequent calls return the result of the first call.
+type onceCloser struct {
+	c    io.Closer
+	once sync.Once
+	err  error
+}
+
+func (c *onceCloser) Close() error {
+	c.once.Do(func() { c.err = c.c.Close() })
+	return c.err
+}
+
 // TODO(toddw): Clean up resources in Shell.Cleanup. E.g. we'll currently leak
 // the os.Pipe fds if the user sets up a pipeline but never calls Start (or
 // Wait, Terminate).
@@ -276,6 +290,17 @@ func (p *Pipeline) start() error {
 		for _, state := range p.state {
 			state.stdinWrite.Close() // ignore error, since start or close failed.
 		}
+	} else {
+		// Close the write-side of the stdin pipe for each command once the
+		// previous command has exited and all of its output has been written,
+		// so that the command reads an EOF even if the user doesn't wait for the
+		// commands in order. The error, if any, is reported by wait.
+		for i, state := range p.state {
+			go func(c *Cmd, w io.Closer) {
+				<-c.WaitChan()
+				w.Close()
+			}(p.cmds[i], state.stdinWrite)
+		}
 	}
 	if shErr != nil {
 		p.sh.Err = shErr
@@ -54,6 +54,27 @@ func TestPipeline(t *testing.T) {
 	eq(t, p.Clone().Stdout(), "ZZ")
 }
 
+func TestPipelineStdinEOF(t *testing.T) {
+	sh := gosh.NewShell(t)
+	defer sh.Cleanup()
+
+	// Each command reads an EOF once the previous command exits, even if the
+	// commands aren't waited for in order.
+	echo := sh.FuncCmd(echoFunc)
+	echo.Args = append(echo.Args, "foo")
+	cat1, cat2 := sh.FuncCmd(catFunc), sh.FuncCmd(catFunc)
+	p := gosh.NewPipeline(echo, cat1, cat2)
+	stdout := cat2.StdoutPipe()
+	p.Start()
+	select {
+	case <-cat2.WaitChan():
+	case <-time.After(time.Minute):
+		t.Fatal("timed out waiting for the last command to exit")
+	}
+	p.Wait()
+	eq(t, toString(t, stdout), "foo\n")
+}
+
 func TestPipelineDifferentShells(t *testing.T) {
 	sh1 := gosh.NewShell(t)
 	defer sh1.Cleanup()
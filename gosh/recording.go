@@ -0,0 +1,218 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gosh
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+var (
+	errRecordAndReplay = errors.New("gosh: cannot record and replay at the same time")
+	errReplayExhausted = errors.New("gosh: no recorded commands left to replay")
+)
+
+// RecordedCmd is the record of a single command run by a Shell in record mode.
+type RecordedCmd struct {
+	// Args is the list of args for the command. Args[0] is the base name of the
+	// resolved path, so that recordings don't depend on the machine on which
+	// they were made.
+	Args []string
+	// Stdout and Stderr hold the full output of the command.
+	Stdout, Stderr string
+	// ExitCode is the exit code of the command, or -1 if it was terminated by a
+	// signal.
+	ExitCode int
+}
+
+// Recording is a sequence of commands recorded by a Shell in record mode (see
+// Shell.Record), in the order they were started. Its Cmds may be stored, e.g.
+// as JSON in a golden file, and later passed to Shell.Replay.
+type Recording struct {
+	// Cmds is the list of recorded commands.
+	Cmds []RecordedCmd
+	// Internal state.
+	mu   sync.Mutex // protects Cmds and next
+	next int        // index of the next command to replay
+}
+
+// Record configures this Shell to append a RecordedCmd to r for each command it
+// starts, once the command exits. Pass nil to stop recording. Cannot be
+// combined with Replay.
+func (sh *Shell) Record(r *Recording) {
+	sh.Ok()
+	sh.handleError(sh.record(r))
+}
+
+// Replay configures this Shell to replay the commands in r instead of executing
+// them. Each started command consumes the next RecordedCmd in r, and fails if
+// its args don't match the recorded args. Instead of running a process, the
+// command writes the recorded stdout and stderr to its configured destinations,
+// then exits with the recorded exit code. Since no process is executed, the
+// command's Pid is always -1, and signals have no effect. Pass nil to stop
+// replaying. Cannot be combined with Record.
+//
+// Replay is meant for unit-testing the logic that orchestrates commands, e.g.
+// with golden recordings made via Record, without running real processes.
+func (sh *Shell) Replay(r *Recording) {
+	sh.Ok()
+	sh.handleError(sh.replay(r))
+}
+
+// Internals
+// =========
+
+func (sh *Shell) record(r *Recording) error {
+	sh.cleanupMu.Lock()
+	defer sh.cleanupMu.Unlock()
+	if r != nil && sh.replaying != nil {
+		return errRecordAndReplay
+	}
+	sh.recording = r
+	return nil
+}
+
+func (sh *Shell) replay(r *Recording) error {
+	sh.cleanupMu.Lock()
+	defer sh.cleanupMu.Unlock()
+	if r != nil && sh.recording != nil {
+		return errRecordAndReplay
+	}
+	sh.replaying = r
+	return nil
+}
+
+// recordedArgs returns the given args, with args[0] replaced by its base name.
+func recordedArgs(args []string) []string {
+	res := append([]string(nil), args...)
+	if len(res) > 0 {
+		res[0] = filepath.Base(res[0])
+	}
+	return res
+}
+
+// add appends a RecordedCmd for the given args, and returns its index.
+func (r *Recording) add(args []string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Cmds = append(r.Cmds, RecordedCmd{Args: recordedArgs(args)})
+	return len(r.Cmds) - 1
+}
+
+// finish sets the output and exit code of the RecordedCmd at the given index.
+func (r *Recording) finish(index int, stdout, stderr string, exitCode int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rc := &r.Cmds[index]
+	rc.Stdout, rc.Stderr, rc.ExitCode = stdout, stderr, exitCode
+}
+
+// pop returns the next RecordedCmd to replay, checking that its args match.
+func (r *Recording) pop(args []string) (*RecordedCmd, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.next >= len(r.Cmds) {
+		return nil, errReplayExhausted
+	}
+	rc := r.Cmds[r.next]
+	got := strings.Join(recordedArgs(args), " ")
+	if want := strings.Join(rc.Args, " "); got != want {
+		return nil, fmt.Errorf("gosh: replayed command %q does not match recorded command %q", got, want)
+	}
+	r.next++
+	return &rc, nil
+}
+
+// replayExitError is returned by Cmd.wait for a replayed command that exited
+// with a non-zero exit code. It is treated like *exec.ExitError.
+type replayExitError struct {
+	code int
+}
+
+func (e *replayExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.code)
+}
+
+// startRecordOrReplay is called by Cmd.start once the command's stdout and
+// stderr have been configured. When recording, it reserves the command's entry
+// in the recording and arranges for its output to be captured. When replaying,
+// or in dry-run mode, it marks the command as started without executing it, and
+// returns true.
+func (c *Cmd) startRecordOrReplay() (bool, error) {
+	switch {
+	case c.sh.DryRun && !c.ignoreDryRun:
+		c.sh.tb.Logf("gosh: dry run: %s\n", c)
+		c.replayed = &RecordedCmd{Args: recordedArgs(c.Args)}
+		c.setStarted()
+		c.startExitWaiter()
+		return true, nil
+	case c.sh.recording != nil:
+		c.recording = c.sh.recording
+		c.recordingIndex = c.recording.add(c.Args)
+		c.recordStdout, c.recordStderr = &bytes.Buffer{}, &bytes.Buffer{}
+		c.c.Stdout = teeRecord(c.c.Stdout, c.recordStdout)
+		c.c.Stderr = teeRecord(c.c.Stderr, c.recordStderr)
+	case c.sh.replaying != nil:
+		rc, err := c.sh.replaying.pop(c.Args)
+		if err != nil {
+			return false, err
+		}
+		c.replayed = rc
+		c.setStarted()
+		c.startExitWaiter()
+		return true, nil
+	}
+	return false, nil
+}
+
+// teeRecord returns a Writer that writes to both w (which may be nil) and buf.
+// If w is a sharedLockWriter, the returned Writer shares its lock.
+func teeRecord(w io.Writer, buf *bytes.Buffer) io.Writer {
+	switch w := w.(type) {
+	case nil:
+		return buf
+	case *sharedLockWriter:
+		return &sharedLockWriter{w.mu, io.MultiWriter(w.w, buf)}
+	default:
+		return io.MultiWriter(w, buf)
+	}
+}
+
+// replayOutput writes the replayed command's output, and returns the error
+// that Cmd.wait should report.
+func (c *Cmd) replayOutput() error {
+	if c.c.Stdout != nil && c.replayed.Stdout != "" {
+		if _, err := io.WriteString(c.c.Stdout, c.replayed.Stdout); err != nil {
+			return err
+		}
+	}
+	if c.c.Stderr != nil && c.replayed.Stderr != "" {
+		if _, err := io.WriteString(c.c.Stderr, c.replayed.Stderr); err != nil {
+			return err
+		}
+	}
+	if c.replayed.ExitCode != 0 {
+		return &replayExitError{c.replayed.ExitCode}
+	}
+	return nil
+}
+
+// finishRecording records the output and exit code of an exited command, if
+// the command was started in record mode.
+func (c *Cmd) finishRecording() {
+	if c.recording == nil {
+		return
+	}
+	exitCode := 0
+	if ps := c.c.ProcessState; ps != nil {
+		exitCode = ps.ExitCode()
+	}
+	c.recording.finish(c.recordingIndex, c.recordStdout.String(), c.recordStderr.String(), exitCode)
+}
@@ -12,7 +12,9 @@ import (
 	"encoding/gob"
 	"errors"
 	"fmt"
+	"io"
 	"reflect"
+	"regexp"
 	"runtime"
 	"sync"
 )
@@ -63,13 +65,51 @@ func RegisterFunc(name string, fi interface{}) *Func {
 	return f
 }
 
+// RegisterGobType registers the concrete type of x with gob, so that values of
+// that type may be passed as FuncCmd arguments via interface parameters, e.g.
+// to a function that takes ...interface{}. Types of non-interface parameters
+// are registered automatically by RegisterFunc. Like RegisterFunc, it must be
+// called in both the parent and child processes, e.g. from an init function.
+func RegisterGobType(x interface{}) {
+	gob.Register(x)
+}
+
+// UnknownFuncError is the error returned when an invocation references a
+// function that was not registered, e.g. because the child process was built
+// from a different binary than the parent, or because RegisterFunc was called
+// conditionally. InitMain reports this error on the child's stderr before
+// exiting with a non-zero exit code.
+type UnknownFuncError struct {
+	// Handle is the handle of the missing function, of the form
+	// "file:line:name".
+	Handle string
+	// Name is the name that was passed to RegisterFunc, or the empty string if
+	// it could not be extracted from Handle.
+	Name string
+}
+
+// Error implements the error interface method.
+func (e *UnknownFuncError) Error() string {
+	return fmt.Sprintf("gosh: unknown function %q", e.Handle)
+}
+
+var handleRE = regexp.MustCompile(`^.*?:\d+:(.*)$`)
+
+func newUnknownFuncError(handle string) *UnknownFuncError {
+	e := &UnknownFuncError{Handle: handle}
+	if m := handleRE.FindStringSubmatch(handle); m != nil {
+		e.Name = m[1]
+	}
+	return e
+}
+
 // getFunc returns the referenced function.
 func getFunc(handle string) (*Func, error) {
 	funcsMu.RLock()
 	f, ok := funcs[handle]
 	funcsMu.RUnlock()
 	if !ok {
-		return nil, fmt.Errorf("gosh: unknown function %q", handle)
+		return nil, newUnknownFuncError(handle)
 	}
 	return f, nil
 }
@@ -158,6 +198,9 @@ func encodeInvocation(handle string, args ...interface{}) (string, error) {
 	inv := invocation{Handle: handle, Args: args}
 	buf := &bytes.Buffer{}
 	if err := gob.NewEncoder(buf).Encode(inv); err != nil {
+		if argErr := checkArgsEncodable(args); argErr != nil {
+			return "", argErr
+		}
 		return "", fmt.Errorf("gosh: failed to encode invocation: %v", err)
 	}
 	// Base64-encode the gob-encoded bytes so that the result can be used as an
@@ -165,6 +208,18 @@ func encodeInvocation(handle string, args ...interface{}) (string, error) {
 	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
 }
 
+// checkArgsEncodable returns an error describing the first argument that cannot
+// be gob-encoded, typically because its type was not registered.
+func checkArgsEncodable(args []interface{}) error {
+	for i, arg := range args {
+		single := invocation{Args: []interface{}{arg}}
+		if err := gob.NewEncoder(io.Discard).Encode(single); err != nil {
+			return fmt.Errorf("gosh: cannot encode argument %d of type %T (types passed via interface parameters must be registered with RegisterGobType): %v", i, arg, err)
+		}
+	}
+	return nil
+}
+
 // decodeInvocation decodes an invocation.
 func decodeInvocation(s string) (handle string, args []interface{}, err error) {
 	var inv invocation
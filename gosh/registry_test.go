@@ -0,0 +1,34 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gosh
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestUnknownFuncError(t *testing.T) {
+	tests := []struct {
+		handle, name string
+	}{
+		{"/src/foo_test.go:12:fooFunc", "fooFunc"},
+		{`C:\src\foo_test.go:12:fooFunc`, "fooFunc"},
+		{"/src/foo_test.go:12:foo:3:bar", "foo:3:bar"},
+		{"bad handle", ""},
+	}
+	for _, test := range tests {
+		err := callFunc(test.handle)
+		var ufe *UnknownFuncError
+		if !errors.As(err, &ufe) {
+			t.Fatalf("%q: got %v, want *UnknownFuncError", test.handle, err)
+		}
+		if got, want := ufe.Handle, test.handle; got != want {
+			t.Errorf("got handle %q, want %q", got, want)
+		}
+		if got, want := ufe.Name, test.name; got != want {
+			t.Errorf("%q: got name %q, want %q", test.handle, got, want)
+		}
+	}
+}
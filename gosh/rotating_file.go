@@ -0,0 +1,91 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gosh
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// defaultOutputMaxFiles is the default value for Cmd.OutputMaxFiles.
+const defaultOutputMaxFiles = 5
+
+// rotatingFile is an io.WriteCloser that writes to the file with the given
+// name, rotating it once it would exceed maxSize bytes. On rotation, name is
+// renamed to name.1, any existing name.1 is renamed to name.2, and so on, up to
+// name.<maxFiles>, which is deleted. A single write is never split across
+// files, so a file may exceed maxSize if a single write does. Not thread-safe.
+type rotatingFile struct {
+	name     string
+	maxSize  int64
+	maxFiles int
+	file     *os.File
+	size     int64
+}
+
+// openOutputFile creates the file with the given name, which must not already
+// exist. If maxSize is positive, the returned file is a rotatingFile.
+func openOutputFile(name string, maxSize int64, maxFiles int) (io.WriteCloser, error) {
+	file, err := createOutputFile(name)
+	switch {
+	case err != nil:
+		return nil, err
+	case maxSize <= 0:
+		return file, nil
+	}
+	if maxFiles <= 0 {
+		maxFiles = defaultOutputMaxFiles
+	}
+	return &rotatingFile{name: name, maxSize: maxSize, maxFiles: maxFiles, file: file}, nil
+}
+
+func createOutputFile(name string) (*os.File, error) {
+	return os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+}
+
+// Write writes p to the current file, first rotating it if necessary.
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	if r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// Close closes the current file.
+func (r *rotatingFile) Close() error {
+	return r.file.Close()
+}
+
+func (r *rotatingFile) rotate() error {
+	if err := r.file.Close(); err != nil {
+		return err
+	}
+	if err := os.Remove(r.rotatedName(r.maxFiles)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for i := r.maxFiles - 1; i >= 1; i-- {
+		if err := os.Rename(r.rotatedName(i), r.rotatedName(i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.Rename(r.name, r.rotatedName(1)); err != nil {
+		return err
+	}
+	file, err := createOutputFile(r.name)
+	if err != nil {
+		return err
+	}
+	r.file, r.size = file, 0
+	return nil
+}
+
+func (r *rotatingFile) rotatedName(i int) string {
+	return fmt.Sprintf("%s.%d", r.name, i)
+}
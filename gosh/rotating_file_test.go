@@ -0,0 +1,59 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gosh
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRotatingFile(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "foo.stdout")
+	w, err := openOutputFile(name, 4, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"a", "bc", "d", "efg", "hijkl", "m"} {
+		if _, err := w.Write([]byte(s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// Writes are "abcd", "efg", "hijkl" (a single write exceeding maxSize) and
+	// "m". Only the 2 most recent rotated files are kept.
+	for file, want := range map[string]string{
+		name:        "m",
+		name + ".1": "hijkl",
+		name + ".2": "efg",
+	} {
+		got, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("%s: got %q, want %q", file, got, want)
+		}
+	}
+	if _, err := os.Stat(name + ".3"); !os.IsNotExist(err) {
+		t.Errorf("got %v, want not exist", err)
+	}
+
+	// Without a maximum size, the file is never rotated.
+	name = filepath.Join(t.TempDir(), "bar.stdout")
+	if w, err = openOutputFile(name, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := w.(*os.File); !ok {
+		t.Errorf("got %T, want *os.File", w)
+	}
+	w.Close()
+	// The file must not already exist.
+	if _, err := openOutputFile(name, 4, 2); err == nil {
+		t.Errorf("expected an error")
+	}
+}
@@ -13,11 +13,13 @@
 package gosh
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
 	"log"
 	"math/rand"
+	"net"
 	"os"
 	"os/exec"
 	"os/signal"
@@ -31,8 +33,11 @@ import (
 )
 
 const (
+	envExecPath    = "GOSH_EXEC_PATH"
 	envExitAfter   = "GOSH_EXIT_AFTER"
 	envInvocation  = "GOSH_INVOCATION"
+	envRlimits     = "GOSH_RLIMITS"
+	envSendReady   = "GOSH_SEND_READY"
 	envWatchParent = "GOSH_WATCH_PARENT"
 )
 
@@ -70,16 +75,54 @@ type Shell struct {
 	Args []string
 	// Set the depth to use for runtime.Caller when generating error messages.
 	ErrorDepth int
+	// MoveRetries is the number of times Move retries a failed rename before
+	// falling back to copying the file. If zero, Move retries once.
+	MoveRetries int
+	// MoveBackoff is the maximum delay before Move's first rename retry. The
+	// maximum doubles for each subsequent retry, and the actual delay is chosen
+	// at random up to the maximum. If zero, it defaults to one second.
+	MoveBackoff time.Duration
+	// CleanupGracePeriod is how long Cleanup waits for a child's process group to
+	// exit after sending it SIGINT, before sending it SIGKILL. If zero, it
+	// defaults to one second. It has no effect on Windows, where children are
+	// killed immediately.
+	CleanupGracePeriod time.Duration
+	// TempDirRoot, if non-empty, is the directory in which MakeTempFile and
+	// MakeTempDir create temporary files and directories, instead of
+	// os.TempDir. The directory must already exist.
+	TempDirRoot string
+	// OnCmdStart, if non-nil, is called with each command started by this Shell,
+	// once it has started. It may be used to instrument commands, e.g. to start
+	// a tracing span, without modifying call sites.
+	OnCmdStart func(*Cmd)
+	// OnCmdExit, if non-nil, is called with each command started by this Shell,
+	// along with the error returned by its wait (nil on success), once it has
+	// exited. It is called before Cmd.Wait returns, and never before OnCmdStart
+	// has returned for the same command. Note that it may be called from an
+	// internal goroutine.
+	OnCmdExit func(*Cmd, error)
+	// DryRun, if true, makes commands log what they would run instead of running
+	// it, e.g. to preview what a script would do. Start logs the command via
+	// TB.Logf and returns immediately, and the command then exits successfully
+	// without any output. Since no process is executed, the command's Pid is
+	// always -1, signals have no effect, and commands never send vars. BuildGoPkg
+	// is unaffected, and still builds binaries.
+	DryRun bool
 	// Internal state.
 	calledNewShell  bool
 	tb              TB
 	cleanupDone     chan struct{}
+	transcriptMu    sync.Mutex // protects transcript
+	transcript      io.Writer
+	recording       *Recording // for Record; protected by cleanupMu
+	replaying       *Recording // for Replay; protected by cleanupMu
 	cleanupMu       sync.Mutex // protects the fields below; held during cleanup
 	calledCleanup   bool
 	cmds            []*Cmd
 	tempFiles       []*os.File
 	tempDirs        []string
-	dirStack        []string // for pushd/popd
+	dirStack        []string            // for pushd/popd
+	envStacks       map[string][]envVar // for pushEnv/popEnv
 	cleanupHandlers []func()
 }
 
@@ -161,8 +204,9 @@ func (sh *Shell) Move(oldpath, newpath string) {
 	sh.handleError(sh.move(oldpath, newpath))
 }
 
-// MakeTempFile creates a new temporary file in os.TempDir, opens the file for
-// reading and writing, and returns the resulting *os.File.
+// MakeTempFile creates a new temporary file in sh.TempDirRoot (or os.TempDir,
+// if TempDirRoot is empty), opens the file for reading and writing, and returns
+// the resulting *os.File.
 func (sh *Shell) MakeTempFile() *os.File {
 	sh.Ok()
 	res, err := sh.makeTempFile()
@@ -170,8 +214,9 @@ func (sh *Shell) MakeTempFile() *os.File {
 	return res
 }
 
-// MakeTempDir creates a new temporary directory in os.TempDir and returns the
-// path of the new directory.
+// MakeTempDir creates a new temporary directory in sh.TempDirRoot (or
+// os.TempDir, if TempDirRoot is empty) and returns the path of the new
+// directory.
 func (sh *Shell) MakeTempDir() string {
 	sh.Ok()
 	res, err := sh.makeTempDir()
@@ -191,6 +236,21 @@ func (sh *Shell) Popd() {
 	sh.handleError(sh.popd())
 }
 
+// PushEnv sets sh.Vars[key] to value, saving the previous value (or its
+// absence) so that it can be restored by PopEnv. Like Pushd, calls may be
+// nested; any values that haven't been popped are restored by Cleanup.
+func (sh *Shell) PushEnv(key, value string) {
+	sh.Ok()
+	sh.handleError(sh.pushEnv(key, value))
+}
+
+// PopEnv restores sh.Vars[key] to its value before the most recent PushEnv
+// call for key, deleting it if it wasn't previously set.
+func (sh *Shell) PopEnv(key string) {
+	sh.Ok()
+	sh.handleError(sh.popEnv(key))
+}
+
 // AddCleanupHandler registers the given function to be called during cleanup.
 // Cleanup handlers are called in LIFO order, possibly in a separate goroutine
 // spawned by gosh.
@@ -199,6 +259,18 @@ func (sh *Shell) AddCleanupHandler(f func()) {
 	sh.handleError(sh.addCleanupHandler(f))
 }
 
+// SetTranscript configures this Shell to append an entry to the given Writer
+// each time one of its commands exits. Each entry records the command's args,
+// PID, start time, duration and exit status, along with the head and tail of
+// its stdout and stderr. Pass nil to stop writing the transcript. Entries are
+// written from internal goroutines, but never concurrently with one another.
+func (sh *Shell) SetTranscript(w io.Writer) {
+	sh.Ok()
+	sh.transcriptMu.Lock()
+	defer sh.transcriptMu.Unlock()
+	sh.transcript = w
+}
+
 // Cleanup cleans up all resources (child processes, temporary files and
 // directories) associated with this Shell. It is safe (and recommended) to call
 // Cleanup after a Shell error. It is also safe to call Cleanup multiple times;
@@ -253,7 +325,7 @@ func newShell(tb TB) (*Shell, error) {
 	}
 	// Filter out any gosh env vars coming from outside.
 	shVars := sliceToMap(os.Environ())
-	for _, key := range []string{envExitAfter, envInvocation, envWatchParent} {
+	for _, key := range []string{envExecPath, envExitAfter, envInvocation, envRlimits, envWatchParent} {
 		delete(shVars, key)
 	}
 	sh := &Shell{
@@ -346,6 +418,31 @@ func (sh *Shell) wait() error {
 	return res
 }
 
+// writeTranscriptEntry appends an entry for the given exited command to the
+// transcript, if one was configured via SetTranscript.
+func (sh *Shell) writeTranscriptEntry(c *Cmd, start time.Time, waitErr error) {
+	sh.transcriptMu.Lock()
+	defer sh.transcriptMu.Unlock()
+	if sh.transcript == nil {
+		return
+	}
+	result := "exit status 0"
+	if waitErr != nil {
+		result = waitErr.Error()
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "=== %s\n", c)
+	fmt.Fprintf(&buf, "PID: %d\n", c.Pid())
+	fmt.Fprintf(&buf, "Start: %s\n", start.Format(time.RFC3339Nano))
+	fmt.Fprintf(&buf, "Duration: %v\n", time.Since(start))
+	fmt.Fprintf(&buf, "Result: %s\n", result)
+	fmt.Fprintf(&buf, "STDOUT\n%s\n%s\n", sep, c.stdoutHeadTail.String())
+	fmt.Fprintf(&buf, "STDERR\n%s\n%s\n", sep, c.stderrHeadTail.String())
+	if _, err := sh.transcript.Write(buf.Bytes()); err != nil {
+		sh.tb.Logf("gosh: failed to write transcript: %v\n", err)
+	}
+}
+
 func copyFile(to, from string) error {
 	fi, err := os.Stat(from)
 	if err != nil {
@@ -368,6 +465,9 @@ func copyFile(to, from string) error {
 	return cerr
 }
 
+// rename is os.Rename, overridden in tests to simulate rename failures.
+var rename = os.Rename
+
 func (sh *Shell) move(oldpath, newpath string) error {
 	fi, err := os.Stat(oldpath)
 	if err != nil {
@@ -385,14 +485,26 @@ func (sh *Shell) move(oldpath, newpath string) error {
 		}
 		return err
 	}
-	if err := os.Rename(oldpath, newpath); err == nil {
+	if err := rename(oldpath, newpath); err == nil {
 		return nil
 	}
 	// Concurrent, same-directory rename operations sometimes fail on certain
-	// systems, so we retry once after a random backoff.
-	time.Sleep(time.Duration(rand.Int63n(1000)) * time.Millisecond)
-	if err := os.Rename(oldpath, newpath); err == nil {
-		return nil
+	// systems, so we retry after a random, exponentially increasing backoff.
+	retries, backoff := sh.MoveRetries, sh.MoveBackoff
+	if retries <= 0 {
+		retries = 1
+	}
+	if backoff <= 0 {
+		backoff = time.Second
+	}
+	for i := 0; i < retries; i++ {
+		time.Sleep(time.Duration(rand.Int63n(int64(backoff))))
+		if err := rename(oldpath, newpath); err == nil {
+			return nil
+		}
+		if backoff < time.Minute {
+			backoff *= 2
+		}
 	}
 	// Try copying the file over.
 	if err := copyFile(newpath, oldpath); err != nil {
@@ -407,7 +519,7 @@ func (sh *Shell) makeTempFile() (*os.File, error) {
 	if sh.calledCleanup {
 		return nil, errAlreadyCalledCleanup
 	}
-	f, err := os.CreateTemp("", "")
+	f, err := os.CreateTemp(sh.TempDirRoot, "")
 	if err != nil {
 		return nil, err
 	}
@@ -421,7 +533,7 @@ func (sh *Shell) makeTempDir() (string, error) {
 	if sh.calledCleanup {
 		return "", errAlreadyCalledCleanup
 	}
-	name, err := os.MkdirTemp("", "")
+	name, err := os.MkdirTemp(sh.TempDirRoot, "")
 	if err != nil {
 		return "", err
 	}
@@ -463,6 +575,55 @@ func (sh *Shell) popd() error {
 	return nil
 }
 
+// envVar holds the value of an env var saved by pushEnv; ok is false if the
+// var was not set.
+type envVar struct {
+	value string
+	ok    bool
+}
+
+func (sh *Shell) pushEnv(key, value string) error {
+	sh.cleanupMu.Lock()
+	defer sh.cleanupMu.Unlock()
+	if sh.calledCleanup {
+		return errAlreadyCalledCleanup
+	}
+	if sh.envStacks == nil {
+		sh.envStacks = map[string][]envVar{}
+	}
+	prev, ok := sh.Vars[key]
+	sh.envStacks[key] = append(sh.envStacks[key], envVar{prev, ok})
+	sh.Vars[key] = value
+	return nil
+}
+
+func (sh *Shell) popEnv(key string) error {
+	sh.cleanupMu.Lock()
+	defer sh.cleanupMu.Unlock()
+	if sh.calledCleanup {
+		return errAlreadyCalledCleanup
+	}
+	stack := sh.envStacks[key]
+	if len(stack) == 0 {
+		return fmt.Errorf("gosh: env stack for %q is empty", key)
+	}
+	sh.restoreEnv(key, stack[len(stack)-1])
+	if len(stack) == 1 {
+		delete(sh.envStacks, key)
+	} else {
+		sh.envStacks[key] = stack[:len(stack)-1]
+	}
+	return nil
+}
+
+func (sh *Shell) restoreEnv(key string, v envVar) {
+	if v.ok {
+		sh.Vars[key] = v.value
+	} else {
+		delete(sh.Vars, key)
+	}
+}
+
 func (sh *Shell) addCleanupHandler(f func()) error {
 	sh.cleanupMu.Lock()
 	defer sh.cleanupMu.Unlock()
@@ -519,6 +680,11 @@ func (sh *Shell) cleanup() {
 			sh.tb.Logf("os.Chdir(%q) failed: %v\n", dir, err)
 		}
 	}
+	// Restore env vars to the bottom of their stacks.
+	for key, stack := range sh.envStacks {
+		sh.restoreEnv(key, stack[0])
+	}
+	sh.envStacks = nil
 	// Call cleanup handlers in LIFO order.
 	for i := len(sh.cleanupHandlers) - 1; i >= 0; i-- {
 		sh.cleanupHandlers[i]()
@@ -539,6 +705,7 @@ func InitMain() {
 		panic("gosh: already called gosh.InitMain")
 	}
 	calledInitMain = true
+	execWithRlimits()
 	s := os.Getenv(envInvocation)
 	if s == "" {
 		return
@@ -549,6 +716,7 @@ func InitMain() {
 	if err != nil {
 		log.Fatal(err)
 	}
+	sendReady()
 	if err := callFunc(name, args...); err != nil {
 		log.Fatal(err)
 	}
@@ -619,6 +787,7 @@ func buildGoPkg(sh *Shell, binDir, pkg string, flags ...string) (string, error)
 	if err != nil {
 		return "", err
 	}
+	c.ignoreDryRun = true
 	if err := c.run(); err != nil {
 		return "", err
 	}
@@ -632,3 +801,21 @@ func buildGoPkg(sh *Shell, binDir, pkg string, flags ...string) (string, error)
 	sh.tb.Logf("Built executable: %s\n", binPath)
 	return binPath, nil
 }
+
+// AwaitUnixListening waits until the Unix domain socket at the given path
+// accepts connections, dialing it repeatedly until it succeeds or until the
+// given timeout elapses. It is intended to avoid the common race between
+// starting a server and connecting to it.
+func AwaitUnixListening(path string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		conn, err := net.DialTimeout("unix", path, time.Until(deadline))
+		if err == nil {
+			return conn.Close()
+		}
+		if !time.Now().Before(deadline) {
+			return fmt.Errorf("gosh: timed out waiting for %s to accept connections: %v", path, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
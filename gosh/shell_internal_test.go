@@ -0,0 +1,59 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gosh
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMoveRetries(t *testing.T) {
+	defer func(orig func(string, string) error) { rename = orig }(rename)
+
+	sh := NewShell(t)
+	defer sh.Cleanup()
+	sh.MoveBackoff = time.Millisecond
+	dir := sh.MakeTempDir()
+
+	tests := []struct {
+		retries, failures, wantCalls int
+	}{
+		{0, 0, 1},
+		{0, 1, 2}, // default is a single retry
+		{3, 3, 4},
+		{3, 10, 4}, // falls back to copying the file
+	}
+	for i, test := range tests {
+		calls := 0
+		rename = func(oldpath, newpath string) error {
+			calls++
+			if calls <= test.failures {
+				return errors.New("transient failure")
+			}
+			return os.Rename(oldpath, newpath)
+		}
+		sh.MoveRetries = test.retries
+		src, dst := filepath.Join(dir, "src"), filepath.Join(dir, "dst")
+		if err := os.WriteFile(src, []byte("data"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		sh.Move(src, dst)
+		if got, want := calls, test.wantCalls; got != want {
+			t.Errorf("%d: got %d rename calls, want %d", i, got, want)
+		}
+		if _, err := os.Stat(src); !os.IsNotExist(err) {
+			t.Errorf("%d: got %v, want source to be removed", i, err)
+		}
+		if data, err := os.ReadFile(dst); err != nil || string(data) != "data" {
+			t.Errorf("%d: got %q, %v, want %q", i, data, err, "data")
+		}
+		if err := os.Remove(dst); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
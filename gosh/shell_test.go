@@ -23,8 +23,10 @@ import (
 	"reflect"
 	"runtime"
 	"runtime/debug"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -127,6 +129,9 @@ var (
 	printfFunc = gosh.RegisterFunc("printfFunc", func(format string, v ...interface{}) {
 		fmt.Printf(format, v...)
 	})
+	printEnvFunc = gosh.RegisterFunc("printEnvFunc", func(key string) {
+		fmt.Print(os.Getenv(key))
+	})
 )
 
 // Shell tests
@@ -204,6 +209,40 @@ func TestPushdPopd(t *testing.T) {
 	setsErr(t, sh, func() { sh.Popd() })
 }
 
+func TestPushEnvPopEnv(t *testing.T) {
+	sh := gosh.NewShell(t)
+	defer sh.Cleanup()
+
+	delete(sh.Vars, "A")
+	sh.Vars["B"] = "b0"
+	sh.PushEnv("A", "a1")
+	sh.PushEnv("A", "a2")
+	sh.PushEnv("B", "b1")
+	eq(t, sh.Vars["A"], "a2")
+	eq(t, sh.Vars["B"], "b1")
+	eq(t, sh.FuncCmd(printEnvFunc, "A").Stdout(), "a2")
+	sh.PopEnv("A")
+	eq(t, sh.Vars["A"], "a1")
+	sh.PopEnv("A")
+	_, ok := sh.Vars["A"]
+	eq(t, ok, false)
+	sh.PopEnv("B")
+	eq(t, sh.Vars["B"], "b0")
+	// The next sh.PopEnv("A") will fail.
+	setsErr(t, sh, func() { sh.PopEnv("A") })
+
+	// Values that haven't been popped are restored by Cleanup.
+	sh2 := gosh.NewShell(t)
+	sh2.Vars["B"] = "b0"
+	sh2.PushEnv("A", "a1")
+	sh2.PushEnv("B", "b1")
+	sh2.PushEnv("B", "b2")
+	sh2.Cleanup()
+	_, ok = sh2.Vars["A"]
+	eq(t, ok, false)
+	eq(t, sh2.Vars["B"], "b0")
+}
+
 func evalSymlinks(t *testing.T, dir string) string {
 	var err error
 	dir, err = filepath.EvalSymlinks(dir)
@@ -250,6 +289,24 @@ func TestMakeTempFile(t *testing.T) {
 	eq(t, fi.Mode().IsRegular(), true)
 }
 
+func TestTempDirRoot(t *testing.T) {
+	sh := gosh.NewShell(t)
+	defer sh.Cleanup()
+
+	root := t.TempDir()
+	sh.TempDirRoot = root
+	dir := sh.MakeTempDir()
+	file := sh.MakeTempFile()
+	eq(t, filepath.Dir(dir), root)
+	eq(t, filepath.Dir(file.Name()), root)
+
+	// Cleanup removes the temporary files and directories from the root.
+	sh.Cleanup()
+	entries, err := os.ReadDir(root)
+	ok(t, err)
+	eq(t, len(entries), 0)
+}
+
 func TestMove(t *testing.T) {
 	sh := gosh.NewShell(t)
 	defer sh.Cleanup()
@@ -332,6 +389,45 @@ func TestShellWait(t *testing.T) {
 	sh.Wait()
 }
 
+func TestGroup(t *testing.T) {
+	sh := gosh.NewShell(t)
+	defer sh.Cleanup()
+
+	// A long-running command outside the group isn't waited for.
+	server := sh.FuncCmd(sleepFunc, time.Hour, 0)
+	server.Start()
+
+	g := sh.Group()
+	c1 := sh.FuncCmd(sleepFunc, 100*time.Millisecond, 0)
+	c2 := sh.FuncCmd(sleepFunc, time.Duration(0), 0)
+	g.Start(c1)
+	g.Start(c2)
+	eq(t, len(g.Cmds()), 2)
+	c2.Wait()
+	g.Wait()
+	select {
+	case <-c1.WaitChan():
+	default:
+		t.Fatal("group command has not exited")
+	}
+	select {
+	case <-server.WaitChan():
+		t.Fatal("server has exited")
+	default:
+	}
+
+	// A failing command is reported by Wait.
+	g = sh.Group()
+	g.Start(sh.FuncCmd(sleepFunc, time.Duration(0), 1))
+	g.Start(sh.FuncCmd(sleepFunc, time.Duration(0), 0))
+	setsErr(t, sh, g.Wait)
+
+	// Commands from a different Shell are rejected.
+	sh2 := gosh.NewShell(t)
+	defer sh2.Cleanup()
+	setsErr(t, sh, func() { g.Start(sh2.FuncCmd(sleepFunc, time.Duration(0), 0)) })
+}
+
 // Tests that Shell.Ok panics under various conditions.
 func TestOkPanics(t *testing.T) {
 	func() { // errDidNotCallNewShell
@@ -583,6 +679,86 @@ func TestAwaitVarsProcessExit(t *testing.T) {
 	setsErr(t, sh, func() { c.AwaitVars("foo") })
 }
 
+// Tests that AwaitVarsTimeout returns partial results.
+func TestAwaitVarsTimeout(t *testing.T) {
+	sh := gosh.NewShell(t)
+	defer sh.Cleanup()
+
+	// All vars are received.
+	c := sh.FuncCmd(stderrFunc, `<goshVars{"a":"1","b":"2"}goshVars>`)
+	c.Start()
+	vars, missing := c.AwaitVarsTimeout(time.Minute, "a", "b")
+	eq(t, vars, map[string]string{"a": "1", "b": "2"})
+	eq(t, len(missing), 0)
+
+	// Some vars are never sent, so we time out.
+	c = sh.FuncCmd(sendVarsFunc, map[string]string{"a": "1"})
+	c.Start()
+	vars, missing = c.AwaitVarsTimeout(100*time.Millisecond, "a", "b", "c", "b")
+	eq(t, vars, map[string]string{"a": "1"})
+	eq(t, missing, []string{"b", "c"})
+
+	// The process exits before sending the vars.
+	c = sh.FuncCmd(exitFunc, 0)
+	c.Start()
+	vars, missing = c.AwaitVarsTimeout(time.Minute, "a")
+	eq(t, vars, map[string]string{})
+	eq(t, missing, []string{"a"})
+
+	// AwaitVarsTimeout should fail if Wait has been called.
+	c.Wait()
+	setsErr(t, sh, func() { c.AwaitVarsTimeout(time.Minute, "a") })
+}
+
+func TestIsRunning(t *testing.T) {
+	sh := gosh.NewShell(t)
+	defer sh.Cleanup()
+
+	c := sh.FuncCmd(sleepFunc, time.Minute, 0)
+	eq(t, c.IsRunning(), false)
+	c.Start()
+	eq(t, c.IsRunning(), true)
+	c.Terminate(os.Interrupt)
+	eq(t, c.IsRunning(), false)
+
+	// IsRunning becomes false once the process exits, without calling Wait.
+	c = sh.FuncCmd(exitFunc, 0)
+	c.Start()
+	<-c.WaitChan()
+	eq(t, c.IsRunning(), false)
+	c.Wait()
+}
+
+func TestAwaitReady(t *testing.T) {
+	sh := gosh.NewShell(t)
+	defer sh.Cleanup()
+
+	// The child confirms that the Func began executing.
+	c := sh.FuncCmd(sleepFunc, time.Minute, 0)
+	c.SendReady = true
+	c.Start()
+	c.AwaitReady(time.Minute)
+	c.Terminate(os.Interrupt)
+
+	// AwaitReady requires SendReady.
+	c = sh.FuncCmd(sleepFunc, time.Minute, 0)
+	c.Start()
+	setsErr(t, sh, func() { c.AwaitReady(time.Minute) })
+	c.Terminate(os.Interrupt)
+
+	// The process exits before the Func begins executing.
+	c = sh.FuncCmd(exitFunc, 0)
+	c.SendReady = true
+	c.Vars["GOSH_INVOCATION"] = "invalid"
+	c.ExitErrorIsOk = true
+	c.Start()
+	setsErr(t, sh, func() { c.AwaitReady(time.Minute) })
+
+	// AwaitReady should fail if Wait has been called.
+	c.Wait()
+	setsErr(t, sh, func() { c.AwaitReady(time.Minute) })
+}
+
 // Functions designed for TestRegistry.
 var (
 	printIntsFunc = gosh.RegisterFunc("printIntsFunc", func(v ...int) {
@@ -601,6 +777,14 @@ var (
 	})
 )
 
+type gobPoint struct{ X, Y int }
+
+type gobUnregistered struct{ X int }
+
+func init() {
+	gosh.RegisterGobType(gobPoint{})
+}
+
 // Tests function signature-checking and execution.
 func TestRegistry(t *testing.T) {
 	sh := gosh.NewShell(t)
@@ -642,6 +826,16 @@ func TestRegistry(t *testing.T) {
 	var p *int
 	setsErr(t, sh, func() { sh.FuncCmd(printFunc, p) })
 	setsErr(t, sh, func() { sh.FuncCmd(printfFunc, "%v", p) })
+
+	// Custom types passed via interface parameters must be registered.
+	eq(t, sh.FuncCmd(printFunc, gobPoint{1, 2}).Stdout(), "{1 2}")
+	setsErr(t, sh, func() { sh.FuncCmd(printFunc, gobUnregistered{1}) })
+	sh.ContinueOnError = true
+	sh.FuncCmd(printFunc, 0, gobUnregistered{1})
+	sh.ContinueOnError = false
+	neq(t, sh.Err, nil)
+	eq(t, strings.Contains(sh.Err.Error(), "argument 1 of type gosh_test.gobUnregistered"), true)
+	sh.Err = nil
 }
 
 func TestStdin(t *testing.T) {
@@ -688,6 +882,89 @@ func TestStdin(t *testing.T) {
 	c = sh.FuncCmd(catFunc)
 	c.SetStdinReader(strings.NewReader(""))
 	setsErr(t, sh, func() { c.SetStdinReader(strings.NewReader("")) })
+
+	// It's an error to combine InheritStdin with StdinPipe or SetStdinReader.
+	c = sh.FuncCmd(catFunc)
+	c.InheritStdin()
+	setsErr(t, sh, func() { c.StdinPipe() })
+
+	c = sh.FuncCmd(catFunc)
+	c.SetStdinReader(strings.NewReader(""))
+	setsErr(t, sh, func() { c.InheritStdin() })
+}
+
+func TestStdinChannel(t *testing.T) {
+	sh := gosh.NewShell(t)
+	defer sh.Cleanup()
+
+	// The "cat" command exits after stdin is closed, which happens once the
+	// channel is closed.
+	ch := make(chan []byte)
+	c := sh.FuncCmd(catFunc)
+	c.SetStdinChannel(ch)
+	go func() {
+		for _, s := range []string{"foo", "bar", "\n"} {
+			ch <- []byte(s)
+		}
+		close(ch)
+	}()
+	eq(t, c.Stdout(), "foobar\n")
+
+	// The "read" command exits when it sees a newline; subsequent sends must not
+	// block even though the process has exited.
+	ch = make(chan []byte)
+	c = sh.FuncCmd(readFunc)
+	c.SetStdinChannel(ch)
+	c.Start()
+	ch <- []byte("foo\n")
+	c.Wait()
+	ch <- []byte("bar\n")
+	close(ch)
+
+	// It's an error to call both SetStdinChannel and StdinPipe.
+	ch = make(chan []byte)
+	c = sh.FuncCmd(catFunc)
+	c.SetStdinChannel(ch)
+	setsErr(t, sh, func() { c.StdinPipe() })
+	close(ch)
+}
+
+func TestCloseStdin(t *testing.T) {
+	sh := gosh.NewShell(t)
+	defer sh.Cleanup()
+
+	c := sh.FuncCmd(catFunc)
+	stdin := c.StdinPipe()
+	stdout := c.StdoutPipe()
+	c.Start()
+	stdin.Write([]byte("foo"))
+	c.CloseStdin()
+	c.CloseStdin()
+	c.Wait()
+	eq(t, toString(t, stdout), "foo")
+	_, err := stdin.Write([]byte("bar"))
+	nok(t, err)
+
+	// CloseStdin requires a stdin pipe.
+	c = sh.FuncCmd(catFunc)
+	setsErr(t, sh, c.CloseStdin)
+}
+
+func TestInheritStdin(t *testing.T) {
+	sh := gosh.NewShell(t)
+	defer sh.Cleanup()
+
+	f := sh.MakeTempFile()
+	_, err := f.WriteString("foo\n")
+	ok(t, err)
+	_, err = f.Seek(0, 0)
+	ok(t, err)
+	defer func(orig *os.File) { os.Stdin = orig }(os.Stdin)
+	os.Stdin = f
+
+	c := sh.FuncCmd(catFunc)
+	c.InheritStdin()
+	eq(t, c.Stdout(), "foo\n")
 }
 
 func TestStdinPipeWriteUntilExit(t *testing.T) {
@@ -767,6 +1044,22 @@ func TestStdoutStderr(t *testing.T) {
 	eq(t, toString(t, stderrPipe), "BB")
 }
 
+func TestCaptureStdout(t *testing.T) {
+	sh := gosh.NewShell(t)
+	defer sh.Cleanup()
+
+	c := sh.FuncCmd(writeFunc, true, true)
+	buf := c.CaptureStdout()
+	c.Start()
+	c.Wait()
+	eq(t, buf.String(), "AA")
+
+	// CaptureStdout must be called before Start.
+	c = sh.FuncCmd(writeFunc, true, false)
+	c.Run()
+	setsErr(t, sh, func() { c.CaptureStdout() })
+}
+
 var writeMoreFunc = gosh.RegisterFunc("writeMoreFunc", func() {
 	sh := gosh.NewShell(nil)
 	defer sh.Cleanup()
@@ -915,6 +1208,85 @@ func TestTerminate(t *testing.T) {
 	setsErr(t, sh, func() { c.Terminate(os.Interrupt) })
 }
 
+var ignoreInterruptFunc = gosh.RegisterFunc("ignoreInterruptFunc", func() {
+	// For TestTerminateGracefully.
+	signal.Ignore(os.Interrupt)
+	gosh.SendVars(map[string]string{"ready": ""})
+	time.Sleep(time.Hour)
+})
+
+func TestTerminateGracefully(t *testing.T) {
+	sh := gosh.NewShell(t)
+	defer sh.Cleanup()
+
+	// The process exits on its own within the grace period.
+	c := sh.FuncCmd(sleepFunc, time.Hour, 0)
+	c.Start()
+	c.AwaitVars("ready")
+	c.TerminateGracefully(os.Interrupt, time.Minute)
+
+	// The process ignores the signal, so it gets killed once the grace period
+	// has elapsed.
+	c = sh.FuncCmd(ignoreInterruptFunc)
+	c.Start()
+	c.AwaitVars("ready")
+	start := time.Now()
+	c.TerminateGracefully(os.Interrupt, 100*time.Millisecond)
+	if d := time.Since(start); d > time.Minute {
+		fatalf(t, "took too long to terminate: %v", d)
+	}
+
+	// TerminateGracefully should fail if Wait has been called.
+	c = sh.FuncCmd(sleepFunc, time.Duration(0), 0)
+	c.Run()
+	setsErr(t, sh, func() { c.TerminateGracefully(os.Interrupt, time.Second) })
+}
+
+func TestKill(t *testing.T) {
+	sh := gosh.NewShell(t)
+	defer sh.Cleanup()
+
+	// Kill should fail if Start has not been called.
+	c := sh.FuncCmd(ignoreInterruptFunc)
+	setsErr(t, sh, func() { c.Kill() })
+
+	// Kill works even if the process ignores os.Interrupt.
+	c.Start()
+	c.AwaitVars("ready")
+	c.Kill()
+	c.ExitErrorIsOk = true
+	c.Wait()
+	nok(t, c.Err)
+	ok(t, sh.Err)
+
+	// Kill should fail if Wait has been called.
+	setsErr(t, sh, func() { c.Kill() })
+}
+
+func TestWaitChan(t *testing.T) {
+	sh := gosh.NewShell(t)
+	defer sh.Cleanup()
+
+	c := sh.FuncCmd(sleepFunc, time.Hour, 0)
+	done := c.WaitChan()
+	c.Start()
+	c.AwaitVars("ready")
+	select {
+	case <-done:
+		fatalf(t, "WaitChan closed before the process exited")
+	case <-time.After(100 * time.Millisecond):
+	}
+	c.Signal(os.Interrupt)
+	select {
+	case <-done:
+	case <-time.After(time.Minute):
+		fatalf(t, "WaitChan not closed after the process exited")
+	}
+	// WaitChan doesn't consume the result of Wait, and may be called again.
+	c.Wait()
+	<-c.WaitChan()
+}
+
 func TestExitErrorIsOk(t *testing.T) {
 	sh := gosh.NewShell(t)
 	defer sh.Cleanup()
@@ -1034,6 +1406,41 @@ func TestCmdFailureLoggingEnabled(t *testing.T) {
 	}
 }
 
+// Tests that when a command that discards its output fails, we log neither its
+// stdout nor its stderr.
+func TestCmdFailureLoggingDiscardOutput(t *testing.T) {
+	tb := &customTB{t: t, buf: &bytes.Buffer{}}
+	sh := gosh.NewShell(tb)
+	defer sh.Cleanup()
+
+	c := sh.FuncCmd(cmdFailureFunc, 1, 1)
+	c.DiscardOutput()
+	c.Run()
+	eq(t, tb.calledFailNow, true)
+	got := tb.buf.String()
+	sep := strings.Repeat("-", 40)
+	for _, want := range []string{
+		fmt.Sprintf("\nSTDOUT\n%s\n[ discarded ]\n", sep),
+		fmt.Sprintf("\nSTDERR\n%s\n[ discarded ]\n", sep),
+	} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("got %v, want substring %v", got, want)
+		}
+	}
+	sh.Err = nil
+
+	// Output sent to other destinations is unaffected.
+	c = sh.FuncCmd(echoFunc)
+	c.Args = append(c.Args, "foo")
+	c.DiscardOutput()
+	eq(t, c.Stdout(), "foo\n")
+
+	// DiscardOutput must be called before Start.
+	c = sh.FuncCmd(exitFunc, 0)
+	c.Run()
+	setsErr(t, sh, func() { c.DiscardOutput() })
+}
+
 // Tests that we don't log command failures when ExitErrorIsOk or
 // ContinueOnError is set.
 func TestCmdFailureLoggingDisabled(t *testing.T) {
@@ -1065,6 +1472,368 @@ func TestCmdFailureLoggingDisabled(t *testing.T) {
 	}
 }
 
+func TestTranscript(t *testing.T) {
+	sh := gosh.NewShell(t)
+	defer sh.Cleanup()
+
+	var buf bytes.Buffer
+	sh.SetTranscript(&buf)
+	c := sh.FuncCmd(echoFunc)
+	c.Args = append(c.Args, "foo")
+	c.Run()
+	wantHeader := "=== " + c.String() + "\n"
+	c = sh.FuncCmd(exitFunc, 1)
+	c.ExitErrorIsOk = true
+	c.Run()
+	// Commands that exit after the transcript is unset are not recorded.
+	sh.SetTranscript(nil)
+	c = sh.FuncCmd(exitFunc, 2)
+	c.ExitErrorIsOk = true
+	c.Run()
+
+	got := buf.String()
+	sep := strings.Repeat("-", 40)
+	for _, want := range []string{
+		wantHeader,
+		"Result: exit status 0\n",
+		fmt.Sprintf("STDOUT\n%s\nfoo\n\n", sep),
+		"Result: exit status 1\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("got %v, want substring %v", got, want)
+		}
+	}
+	if strings.Contains(got, "exit status 2") {
+		t.Fatalf("got %v, want no entry for exit status 2", got)
+	}
+	eq(t, strings.Count(got, "=== "), 2)
+}
+
+func TestAppendArgs(t *testing.T) {
+	sh := gosh.NewShell(t)
+	defer sh.Cleanup()
+
+	c := sh.Cmd("echo", "a")
+	c.AppendArgs()
+	c.AppendArgs("b", "c")
+	c.AppendArgs("d")
+	eq(t, c.Args[1:], []string{"a", "b", "c", "d"})
+	eq(t, c.Stdout(), "a b c d\n")
+
+	// AppendArgs fails after Start.
+	setsErr(t, sh, func() { c.AppendArgs("e") })
+	eq(t, c.Args[1:], []string{"a", "b", "c", "d"})
+}
+
+func TestDryRun(t *testing.T) {
+	tb := &customTB{t: t, buf: &bytes.Buffer{}}
+	sh := gosh.NewShell(tb)
+	defer sh.Cleanup()
+	sh.DryRun = true
+
+	dir := sh.MakeTempDir()
+	file := filepath.Join(dir, "file")
+	c := sh.Cmd("touch", file)
+	c.Run()
+	eq(t, c.Pid(), -1)
+	eq(t, strings.Contains(tb.buf.String(), "gosh: dry run: "+c.String()), true)
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		fatalf(t, "got %v, want file not to exist", err)
+	}
+	// Commands that would fail appear to succeed, without output.
+	c = sh.Cmd("sh", "-c", "echo foo; exit 1")
+	eq(t, c.Stdout(), "")
+	ok(t, c.Err)
+
+	// Commands run normally once DryRun is reset.
+	sh.DryRun = false
+	sh.Cmd("touch", file).Run()
+	if _, err := os.Stat(file); err != nil {
+		fatalf(t, "got %v, want file to exist", err)
+	}
+}
+
+func TestSetCleanEnv(t *testing.T) {
+	sh := gosh.NewShell(t)
+	defer sh.Cleanup()
+	sh.Vars["FOO"] = "foo"
+
+	c := sh.Cmd("env")
+	c.IgnoreParentExit = true
+	c.SetCleanEnv(map[string]string{"A": "1"})
+	eq(t, c.Vars, map[string]string{"A": "1"})
+	eq(t, c.Stdout(), "A=1\n")
+
+	// The Func to run is preserved for FuncCmd.
+	c = sh.FuncCmd(printEnvFunc, "FOO")
+	c.SetCleanEnv(nil)
+	eq(t, c.Stdout(), "")
+	c = sh.FuncCmd(printEnvFunc, "FOO")
+	eq(t, c.Stdout(), "foo")
+
+	// SetCleanEnv fails after Start.
+	setsErr(t, sh, func() { c.SetCleanEnv(nil) })
+}
+
+// latin1Writer transcodes Latin-1 to UTF-8, and records whether it was closed.
+type latin1Writer struct {
+	w      io.Writer
+	closed *bool
+}
+
+func (w latin1Writer) Write(p []byte) (int, error) {
+	runes := make([]rune, len(p))
+	for i, b := range p {
+		runes[i] = rune(b)
+	}
+	if _, err := io.WriteString(w.w, string(runes)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (w latin1Writer) Close() error {
+	*w.closed = true
+	return nil
+}
+
+func TestOutputDecoder(t *testing.T) {
+	sh := gosh.NewShell(t)
+	defer sh.Cleanup()
+
+	var closed bool
+	decoder := func(w io.Writer) io.Writer { return latin1Writer{w, &closed} }
+	c := sh.Cmd("sh", "-c", `printf 'caf\351'; printf '\374ber' 1>&2`)
+	c.SetOutputDecoder(decoder)
+	var stderr bytes.Buffer
+	c.AddStderrWriter(&stderr)
+	eq(t, c.Stdout(), "café")
+	eq(t, stderr.String(), "über")
+	eq(t, closed, true)
+
+	// Clones share the decoder.
+	eq(t, c.Clone().Stdout(), "café")
+
+	// SetOutputDecoder fails after Start.
+	setsErr(t, sh, func() { c.SetOutputDecoder(decoder) })
+}
+
+func TestTimestampOutput(t *testing.T) {
+	sh := gosh.NewShell(t)
+	defer sh.Cleanup()
+
+	const script = `printf a; sleep 0.1; printf b 1>&2; sleep 0.1; printf c`
+	c := sh.Cmd("sh", "-c", script)
+	c.TimestampOutput = true
+	start := time.Now()
+	stdout, stderr := c.StdoutStderr()
+	eq(t, stdout, "ac")
+	eq(t, stderr, "b")
+	chunks := c.OutputChunks()
+	var got []string
+	for _, chunk := range chunks {
+		got = append(got, chunk.Stream+":"+string(chunk.Data))
+	}
+	eq(t, got, []string{"stdout:a", "stderr:b", "stdout:c"})
+	prev := start
+	for _, chunk := range chunks {
+		if chunk.Time.Before(prev) {
+			fatalf(t, "chunk %v is out of order", chunk)
+		}
+		prev = chunk.Time
+	}
+	if d := chunks[2].Time.Sub(chunks[0].Time); d < 200*time.Millisecond {
+		fatalf(t, "got %v between chunks, want at least 200ms", d)
+	}
+
+	// Clones also timestamp output; nothing is recorded by default.
+	c = c.Clone()
+	c.Run()
+	eq(t, len(c.OutputChunks()), 3)
+	c = sh.Cmd("sh", "-c", script)
+	c.Run()
+	eq(t, len(c.OutputChunks()), 0)
+}
+
+func TestCopyOutputTo(t *testing.T) {
+	sh := gosh.NewShell(t)
+	defer sh.Cleanup()
+
+	// Without a full capture, the head and tail are copied.
+	c := sh.Cmd("sh", "-c", "printf out; printf err 1>&2")
+	var stdout, stderr bytes.Buffer
+	setsErr(t, sh, func() { c.CopyStdoutTo(&stdout) })
+	c.Run()
+	c.CopyStdoutTo(&stdout)
+	c.CopyStderrTo(&stderr)
+	eq(t, stdout.String(), "out")
+	eq(t, stderr.String(), "err")
+
+	// The head and tail of large output are copied, with a marker in between.
+	c = sh.Cmd("sh", "-c", "head -c 100000 /dev/zero | tr '\\0' a")
+	c.Run()
+	stdout.Reset()
+	c.CopyStdoutTo(&stdout)
+	eq(t, strings.Contains(stdout.String(), "[ ... skipping 34464 bytes ... ]"), true)
+
+	// With a full capture, all output is copied.
+	c = c.Clone()
+	buf := c.CaptureStdout()
+	c.Run()
+	stdout.Reset()
+	c.CopyStdoutTo(&stdout)
+	eq(t, stdout.Len(), 100000)
+	eq(t, stdout.String(), buf.String())
+
+	// Nothing can be copied if the output was discarded.
+	c = sh.Cmd("sh", "-c", "printf out")
+	c.DiscardOutput()
+	c.Run()
+	setsErr(t, sh, func() { c.CopyStdoutTo(&stdout) })
+}
+
+func TestEnviron(t *testing.T) {
+	sh := gosh.NewShell(t)
+	defer sh.Cleanup()
+
+	// The child process sees exactly the vars returned by Environ.
+	c := sh.Cmd("env")
+	c.Vars["FOO"] = "bar"
+	c.ExitAfter = time.Minute
+	environ := c.Environ()
+	eq(t, sort.StringsAreSorted(environ), true)
+	var found bool
+	for _, kv := range environ {
+		found = found || kv == "FOO=bar"
+	}
+	eq(t, found, true)
+	eq(t, strings.Split(strings.TrimSpace(c.Stdout()), "\n"), environ)
+
+	// FuncCmd invocations are passed via a reserved var.
+	c = sh.FuncCmd(printFunc, "foo")
+	found = false
+	for _, kv := range c.Environ() {
+		found = found || strings.HasPrefix(kv, "GOSH_INVOCATION=")
+	}
+	eq(t, found, true)
+}
+
+func TestFailOnStderr(t *testing.T) {
+	sh := gosh.NewShell(t)
+	defer sh.Cleanup()
+
+	// Output on stdout and gosh vars on stderr are fine.
+	c := sh.FuncCmd(printFunc, "foo")
+	c.SendReady = true
+	c.FailOnStderr = true
+	eq(t, c.Stdout(), "foo")
+	c = sh.Cmd("sh", "-c", `printf '<goshVars{"a":"1"}goshVars>\n' 1>&2`)
+	c.FailOnStderr = true
+	c.Run()
+
+	// Anything else on stderr is an error, which includes the output.
+	for _, out := range []string{"oops", "<gosh", `<goshVars{"a":"1"}goshVars>x`, "<goshVars{"} {
+		c = sh.Cmd("sh", "-c", `printf '`+out+`' 1>&2`)
+		c.FailOnStderr = true
+		setsErr(t, sh, func() { c.Run() })
+		eq(t, strings.Contains(c.Err.Error(), out), true)
+		c = c.Clone()
+		setsErr(t, sh, func() { c.Run() })
+	}
+}
+
+func TestCmdHooks(t *testing.T) {
+	sh := gosh.NewShell(t)
+	defer sh.Cleanup()
+
+	var mu sync.Mutex
+	var events []string
+	sh.OnCmdStart = func(c *gosh.Cmd) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, "start "+c.Args[len(c.Args)-1])
+	}
+	sh.OnCmdExit = func(c *gosh.Cmd, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, fmt.Sprintf("exit %s %v", c.Args[len(c.Args)-1], err))
+	}
+	c := sh.FuncCmd(echoFunc)
+	c.Args = append(c.Args, "foo")
+	c.Run()
+	c = sh.FuncCmd(exitFunc, 1)
+	c.Args = append(c.Args, "bar")
+	c.ExitErrorIsOk = true
+	c.Run()
+	// Commands that fail to start don't invoke either hook.
+	sh.ContinueOnError = true
+	sh.Cmd("/does/not/exist").Run()
+	nok(t, sh.Err)
+	sh.Err = nil
+	sh.ContinueOnError = false
+	// Nil hooks are skipped.
+	sh.OnCmdStart, sh.OnCmdExit = nil, nil
+	c = sh.FuncCmd(echoFunc)
+	c.Args = append(c.Args, "baz")
+	c.Run()
+
+	mu.Lock()
+	defer mu.Unlock()
+	eq(t, events, []string{"start foo", "exit foo <nil>", "start bar", "exit bar exit status 1"})
+}
+
+func TestRecordReplay(t *testing.T) {
+	sh := gosh.NewShell(t)
+	defer sh.Cleanup()
+
+	// Record some commands.
+	var r gosh.Recording
+	sh.Record(&r)
+	c := sh.FuncCmd(echoFunc)
+	c.Args = append(c.Args, "foo")
+	eq(t, c.Stdout(), "foo\n")
+	c = sh.FuncCmd(exitFunc, 3)
+	c.ExitErrorIsOk = true
+	c.Run()
+	// Can't replay while recording.
+	setsErr(t, sh, func() { sh.Replay(&r) })
+	sh.Record(nil)
+	// Commands started after recording stops are not recorded.
+	sh.FuncCmd(exitFunc, 0).Run()
+	eq(t, len(r.Cmds), 2)
+	eq(t, r.Cmds[0].Args[1:], []string{"foo"})
+	eq(t, r.Cmds[0].Stdout, "foo\n")
+	eq(t, r.Cmds[0].ExitCode, 0)
+	eq(t, r.Cmds[1].ExitCode, 3)
+
+	// Replay the recorded commands.
+	sh2 := gosh.NewShell(t)
+	defer sh2.Cleanup()
+	sh2.Replay(&r)
+	c = sh2.FuncCmd(echoFunc)
+	c.Args = append(c.Args, "foo")
+	stdout := c.StdoutPipe()
+	c.Start()
+	eq(t, c.Pid(), -1)
+	c.Wait()
+	eq(t, toString(t, stdout), "foo\n")
+	c = sh2.FuncCmd(exitFunc, 3)
+	setsErr(t, sh2, c.Run)
+	eq(t, c.Err.Error(), "exit status 3")
+	// All recorded commands have been replayed.
+	setsErr(t, sh2, func() { sh2.FuncCmd(exitFunc, 0).Start() })
+
+	// Replayed commands need not exist, but must match the recording.
+	sh2.Replay(&gosh.Recording{Cmds: []gosh.RecordedCmd{
+		{Args: []string{"no-such-binary", "a"}, Stdout: "out", Stderr: "err"},
+		{Args: []string{"no-such-binary", "b"}},
+	}})
+	stdout2, stderr2 := sh2.Cmd("no-such-binary", "a").StdoutStderr()
+	eq(t, stdout2, "out")
+	eq(t, stderr2, "err")
+	setsErr(t, sh2, func() { sh2.Cmd("no-such-binary", "c").Run() })
+}
+
 func TestMain(m *testing.M) {
 	gosh.InitMain()
 	os.Exit(m.Run())
@@ -8,7 +8,10 @@
 package gosh_test
 
 import (
+	"fmt"
+	"net"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"syscall"
@@ -36,3 +39,188 @@ func TestCleanupProcessGroup(t *testing.T) {
 		eq(t, syscall.Kill(p, 0), syscall.ESRCH)
 	}
 }
+
+func TestAwaitUnixListening(t *testing.T) {
+	sh := gosh.NewShell(t)
+	defer sh.Cleanup()
+
+	path := filepath.Join(sh.MakeTempDir(), "sock")
+	// Nothing is listening yet, so waiting should time out.
+	nok(t, gosh.AwaitUnixListening(path, 50*time.Millisecond))
+
+	errc := make(chan error, 1)
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		ln, err := net.Listen("unix", path)
+		if err == nil {
+			defer ln.Close()
+			var conn net.Conn
+			if conn, err = ln.Accept(); err == nil {
+				conn.Close()
+			}
+		}
+		errc <- err
+	}()
+	ok(t, gosh.AwaitUnixListening(path, time.Minute))
+	ok(t, <-errc)
+}
+
+func TestCleanupGracePeriod(t *testing.T) {
+	for _, grace := range []time.Duration{200 * time.Millisecond, 1500 * time.Millisecond} {
+		sh := gosh.NewShell(t)
+		sh.CleanupGracePeriod = grace
+		// ignoreInterruptFunc ignores SIGINT, so it's only killed by SIGKILL once
+		// the grace period has elapsed.
+		c := sh.FuncCmd(ignoreInterruptFunc)
+		c.Start()
+		c.AwaitVars("ready")
+		start := time.Now()
+		sh.Cleanup()
+		if d := time.Since(start); d < grace || d > grace+time.Minute {
+			fatalf(t, "cleanup took %v, want about %v", d, grace)
+		}
+	}
+}
+
+var printRlimitFunc = gosh.RegisterFunc("printRlimitFunc", func(resource int) error {
+	var lim syscall.Rlimit
+	if err := syscall.Getrlimit(resource, &lim); err != nil {
+		return err
+	}
+	fmt.Printf("%d %d", lim.Cur, lim.Max)
+	return nil
+})
+
+func TestSetRlimit(t *testing.T) {
+	sh := gosh.NewShell(t)
+	defer sh.Cleanup()
+
+	// Limits are applied to FuncCmds.
+	c := sh.FuncCmd(printRlimitFunc, syscall.RLIMIT_NOFILE)
+	c.SetRlimit(syscall.RLIMIT_NOFILE, 100, 100)
+	eq(t, c.Stdout(), "100 100")
+	// Limits are applied to arbitrary executables, and are preserved by Clone.
+	c = sh.Cmd("sh", "-c", "ulimit -n; ulimit -Hn")
+	c.SetRlimit(syscall.RLIMIT_NOFILE, 50, 60)
+	eq(t, c.Clone().Stdout(), "50\n60\n")
+	// The child's env doesn't contain the internal vars used to apply limits.
+	c = sh.Cmd("env")
+	c.SetRlimit(syscall.RLIMIT_NOFILE, 100, 100)
+	if out := c.Stdout(); strings.Contains(out, "GOSH_EXEC_PATH") || strings.Contains(out, "GOSH_RLIMITS") {
+		fatalf(t, "got env %v, want no rlimit vars", out)
+	}
+
+	// Setting limits after Start fails.
+	sh.ContinueOnError = true
+	c = sh.FuncCmd(printRlimitFunc, syscall.RLIMIT_NOFILE)
+	c.Run()
+	c.SetRlimit(syscall.RLIMIT_NOFILE, 100, 100)
+	nok(t, sh.Err)
+}
+
+func TestDumpStacks(t *testing.T) {
+	sh := gosh.NewShell(t)
+	defer sh.Cleanup()
+
+	c := sh.FuncCmd(sleepFunc, time.Minute, 0)
+	c.SendReady = true
+	c.Start()
+	c.AwaitReady(time.Minute)
+	stacks := c.DumpStacks()
+	for _, want := range []string{"SIGQUIT", "goroutine 1 ", "gosh.InitMain"} {
+		if !strings.Contains(stacks, want) {
+			fatalf(t, "got stacks %q, want substring %q", stacks, want)
+		}
+	}
+	// DumpStacks fails if the command hasn't been started.
+	sh.ContinueOnError = true
+	c = sh.FuncCmd(sleepFunc, time.Minute, 0)
+	c.DumpStacks()
+	nok(t, sh.Err)
+}
+
+func TestAllocatePTY(t *testing.T) {
+	sh := gosh.NewShell(t)
+	defer sh.Cleanup()
+
+	const script = `[ -t 0 ] && [ -t 1 ] && echo tty || echo notty; [ -t 2 ] || echo notty 1>&2`
+	c := sh.Cmd("sh", "-c", script)
+	c.AllocatePTY()
+	stdout, stderr := c.StdoutStderr()
+	eq(t, stdout, "tty\n")
+	eq(t, stderr, "notty\n")
+	eq(t, sh.Cmd("sh", "-c", script).Stdout(), "notty\n")
+
+	// All of the output is captured, even if it's large.
+	c = sh.Cmd("sh", "-c", "yes | head -100000")
+	c.AllocatePTY()
+	eq(t, c.Stdout(), strings.Repeat("y\n", 100000))
+
+	// The stdin can't be set along with a terminal.
+	sh.ContinueOnError = true
+	c = sh.Cmd("sh", "-c", script)
+	c.AllocatePTY()
+	c.SetStdinReader(strings.NewReader(""))
+	nok(t, sh.Err)
+}
+
+func TestRelativePath(t *testing.T) {
+	sh := gosh.NewShell(t)
+	defer sh.Cleanup()
+
+	tmpDir, err := filepath.EvalSymlinks(sh.MakeTempDir())
+	ok(t, err)
+	for _, name := range []string{"a", "b"} {
+		dir := filepath.Join(tmpDir, name, "bin")
+		ok(t, os.MkdirAll(dir, 0755))
+		script := fmt.Sprintf("#!/bin/sh\necho %s $(pwd -P)\n", name)
+		ok(t, os.WriteFile(filepath.Join(dir, "tool"), []byte(script), 0755))
+	}
+	dirA, dirB := filepath.Join(tmpDir, "a"), filepath.Join(tmpDir, "b")
+
+	// Relative paths are resolved against the working directory when each Cmd
+	// is created, not when it's started.
+	sh.Pushd(dirA)
+	c1 := sh.Cmd("./bin/tool")
+	sh.Popd()
+	sh.Pushd(dirB)
+	defer sh.Popd()
+	c2 := sh.Cmd("./bin/tool")
+	eq(t, c1.Stdout(), "a "+dirB+"\n")
+	eq(t, c2.Stdout(), "b "+dirB+"\n")
+
+	// Relative paths are resolved against Dir, which may itself be relative.
+	c := sh.Cmd("./bin/tool")
+	c.Dir = dirA
+	eq(t, c.Stdout(), "a "+dirA+"\n")
+	c = sh.Cmd("./bin/tool")
+	c.Dir = "../a"
+	eq(t, c.Clone().Stdout(), "a "+dirA+"\n")
+	eq(t, c.Stdout(), "a "+dirA+"\n")
+}
+
+func TestExitSignal(t *testing.T) {
+	sh := gosh.NewShell(t)
+	defer sh.Cleanup()
+
+	// The process is killed by a signal.
+	c := sh.Cmd("sleep", "100")
+	c.Start()
+	if _, ok := c.ExitSignal(); ok {
+		t.Fatal("got exit signal before Wait")
+	}
+	c.Terminate(syscall.SIGTERM)
+	if sig, ok := c.ExitSignal(); !ok || sig != syscall.SIGTERM {
+		t.Fatalf("got %v, %v, want %v, true", sig, ok, syscall.SIGTERM)
+	}
+
+	// The process exits normally, with or without an error.
+	for _, script := range []string{"exit 0", "exit 3"} {
+		c = sh.Cmd("sh", "-c", script)
+		c.ExitErrorIsOk = true
+		c.Run()
+		if sig, ok := c.ExitSignal(); ok {
+			t.Fatalf("%q: got exit signal %v", script, sig)
+		}
+	}
+}
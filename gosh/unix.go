@@ -8,15 +8,24 @@
 package gosh
 
 import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
 	"os"
+	"strings"
 	"syscall"
 	"time"
+
+	"golang.org/x/sys/unix"
 )
 
 // TODO(sadovsky): Maybe wrap every child process with a "supervisor" process
 // that calls InitChildMain.
 
 func (c *Cmd) start() (e error) {
+	// Deferred first, so that it runs last.
+	defer c.runStartHook()
 	defer func() {
 		// Always close afterStartClosers upon return. Only close afterWaitClosers
 		// if start failed; if start succeeds, they're closed in the startExitWaiter
@@ -29,6 +38,9 @@ func (c *Cmd) start() (e error) {
 				e = err
 			}
 		}
+		if c.ptyMaster != nil && (!c.started || c.replayed != nil) {
+			c.ptyMaster.Close()
+		}
 	}()
 	if c.calledStart {
 		return errAlreadyCalledStart
@@ -42,42 +54,197 @@ func (c *Cmd) start() (e error) {
 		return errAlreadyCalledCleanup
 	}
 	// Configure the command.
-	c.c.Path = c.Path
-	vars := copyMap(c.Vars)
-	if c.IgnoreParentExit {
-		delete(vars, envWatchParent)
-	} else {
-		vars[envWatchParent] = "1"
-	}
-	if c.ExitAfter == 0 {
-		delete(vars, envExitAfter)
-	} else {
-		vars[envExitAfter] = c.ExitAfter.String()
+	c.c.Path = c.path()
+	c.c.Dir = c.dir()
+	if len(c.rlimits) > 0 {
+		// Re-execute the current binary, which applies the limits in InitMain
+		// before exec'ing c.Path. Safeguard against the developer forgetting to
+		// call InitMain, which could lead to infinite recursion.
+		if !calledInitMain {
+			return errDidNotCallInitMain
+		}
+		exe, err := os.Executable()
+		if err != nil {
+			return err
+		}
+		c.c.Path = exe
 	}
-	c.c.Env = mapToSlice(vars)
+	c.c.Env = c.Environ()
 	c.c.Args = c.Args
 	var err error
 	if c.c.Stdout, c.c.Stderr, err = c.makeStdoutStderr(); err != nil {
 		return err
 	}
+	if replayed, err := c.startRecordOrReplay(); err != nil || replayed {
+		return err
+	}
 	c.c.ExtraFiles = c.ExtraFiles
-	// Create a new process group for the child.
 	if c.c.SysProcAttr == nil {
 		c.c.SysProcAttr = &syscall.SysProcAttr{}
 	}
-	c.c.SysProcAttr.Setpgid = true
-	c.c.SysProcAttr.Pgid = 0
+	var ptyStdout io.Writer
+	if c.ptyMaster != nil {
+		// Create a new session for the child, with the terminal as its controlling
+		// terminal. This also creates a new process group for the child.
+		ptyStdout, c.c.Stdout = c.c.Stdout, c.c.Stdin.(*os.File)
+		c.c.SysProcAttr.Setsid = true
+		c.c.SysProcAttr.Setctty = true
+		c.c.SysProcAttr.Ctty = 0
+	} else {
+		// Create a new process group for the child.
+		c.c.SysProcAttr.Setpgid = true
+		c.c.SysProcAttr.Pgid = 0
+	}
 	// Start the command.
 	if err = c.c.Start(); err != nil {
 		return err
 	}
-	c.started = true
+	c.setStarted()
+	if c.ptyMaster != nil {
+		c.ptyDoneChan = make(chan error, 1)
+		go copyPTYOutput(ptyStdout, c.ptyMaster, c.ptyDoneChan)
+	}
 	c.startExitWaiter()
 	return nil
 }
 
+// SetRlimit limits the given resource for the command's process, as per
+// setrlimit(2), e.g. syscall.RLIMIT_AS to cap its address space, or
+// syscall.RLIMIT_CPU to cap its CPU time. Must be called before Start.
+//
+// The limits are applied in the child process before the command's executable
+// is exec'd. To do so, the command is started by re-executing the current
+// binary, which applies the limits in InitMain, then execs the actual executable
+// with the original args and env. Thus the current binary must call InitMain
+// early on in main(), as is required by NewShell.
+func (c *Cmd) SetRlimit(resource int, cur, max uint64) {
+	c.sh.Ok()
+	c.handleError(c.setRlimit(resource, cur, max))
+}
+
+func (c *Cmd) setRlimit(resource int, cur, max uint64) error {
+	if c.calledStart {
+		return errAlreadyCalledStart
+	}
+	c.rlimits = append(c.rlimits, rlimit{resource, cur, max})
+	return nil
+}
+
+// AllocatePTY configures this Cmd to run attached to a new pseudo-terminal, so
+// that the child sees a terminal on stdin and stdout, e.g. to test colored
+// output or progress bars. The terminal becomes the child's controlling
+// terminal. Output the child writes to the terminal is passed through the usual
+// stdout writers; stderr is unaffected. Since the terminal is the child's
+// stdin, the parent can't provide stdin. The terminal doesn't translate "\n" to
+// "\r\n" in output. Must be called before Start. Only one call may be made to
+// AllocatePTY, StdinPipe, SetStdinReader, SetStdinChannel or InheritStdin;
+// subsequent calls will fail.
+func (c *Cmd) AllocatePTY() {
+	c.sh.Ok()
+	c.handleError(c.allocatePTY())
+}
+
+func (c *Cmd) allocatePTY() error {
+	switch {
+	case c.calledStart:
+		return errAlreadyCalledStart
+	case c.c.Stdin != nil:
+		return errAlreadySetStdin
+	}
+	master, slave, err := openPTY()
+	if err != nil {
+		return err
+	}
+	termios, err := unix.IoctlGetTermios(int(slave.Fd()), ioctlGetTermios)
+	if err == nil {
+		termios.Oflag &^= unix.ONLCR
+		err = unix.IoctlSetTermios(int(slave.Fd()), ioctlSetTermios, termios)
+	}
+	if err != nil {
+		master.Close()
+		slave.Close()
+		return err
+	}
+	c.ptyMaster = master
+	c.c.Stdin = slave
+	c.afterStartClosers = append(c.afterStartClosers, slave)
+	return nil
+}
+
+// copyPTYOutput copies the output from the master side of a pseudo-terminal to
+// w until all copies of the slave side have been closed, then sends the result
+// on done.
+func copyPTYOutput(w io.Writer, master *os.File, done chan<- error) {
+	if w == nil {
+		w = io.Discard
+	}
+	_, err := io.Copy(w, master)
+	if errors.Is(err, syscall.EIO) {
+		// Reads on the master return EIO once the slave side has been closed.
+		err = nil
+	}
+	if err2 := master.Close(); err == nil {
+		err = err2
+	}
+	done <- err
+}
+
+// setPlatformVars updates vars with the reserved vars that are specific to this
+// platform.
+func (c *Cmd) setPlatformVars(vars map[string]string) {
+	if len(c.rlimits) == 0 {
+		delete(vars, envExecPath)
+		delete(vars, envRlimits)
+	} else {
+		vars[envExecPath] = c.path()
+		vars[envRlimits] = encodeRlimits(c.rlimits)
+	}
+}
+
+func encodeRlimits(limits []rlimit) string {
+	strs := make([]string, len(limits))
+	for i, l := range limits {
+		strs[i] = fmt.Sprintf("%d:%d:%d", l.resource, l.cur, l.max)
+	}
+	return strings.Join(strs, ",")
+}
+
+func decodeRlimits(s string) ([]rlimit, error) {
+	var limits []rlimit
+	for _, str := range strings.Split(s, ",") {
+		var l rlimit
+		if _, err := fmt.Sscanf(str, "%d:%d:%d", &l.resource, &l.cur, &l.max); err != nil {
+			return nil, fmt.Errorf("gosh: invalid rlimit %q: %v", str, err)
+		}
+		limits = append(limits, l)
+	}
+	return limits, nil
+}
+
+// execWithRlimits is called by InitMain. If the current process was started by
+// a Cmd with resource limits, it applies the limits and execs the command's
+// actual executable, and never returns. Otherwise it returns immediately.
+func execWithRlimits() {
+	path := os.Getenv(envExecPath)
+	if path == "" {
+		return
+	}
+	limits, err := decodeRlimits(os.Getenv(envRlimits))
+	os.Unsetenv(envExecPath)
+	os.Unsetenv(envRlimits)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, l := range limits {
+		if err := syscall.Setrlimit(l.resource, &syscall.Rlimit{Cur: l.cur, Max: l.max}); err != nil {
+			log.Fatalf("gosh: setrlimit(%d, %d, %d) failed: %v", l.resource, l.cur, l.max, err)
+		}
+	}
+	log.Fatal(syscall.Exec(path, os.Args, os.Environ()))
+}
+
 func (c *Cmd) cleanupProcessGroup() {
-	if !c.started {
+	if !c.started || c.replayed != nil {
 		return
 	}
 	c.cleanupMu.Lock()
@@ -93,7 +260,11 @@ func (c *Cmd) cleanupProcessGroup() {
 	if err := syscall.Kill(-c.Pid(), syscall.SIGINT); err == syscall.ESRCH {
 		return
 	}
-	for i := 0; i < 10; i++ {
+	grace := c.sh.CleanupGracePeriod
+	if grace <= 0 {
+		grace = time.Second
+	}
+	for deadline := time.Now().Add(grace); time.Now().Before(deadline); {
 		time.Sleep(100 * time.Millisecond)
 		if err := syscall.Kill(-c.Pid(), 0); err == syscall.ESRCH {
 			return
@@ -2,4 +2,29 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
+//go:build linux || darwin
+// +build linux darwin
+
 package gosh
+
+import (
+	"syscall"
+	"testing"
+)
+
+func TestSetRlimitRequiresInitMain(t *testing.T) {
+	defer func(orig bool) { calledInitMain = orig }(calledInitMain)
+	calledInitMain = false
+
+	sh := NewShell(t)
+	defer sh.Cleanup()
+	sh.ContinueOnError = true
+	// Without InitMain, re-executing the current binary to apply the limits
+	// would run main again, rather than the command.
+	c := sh.Cmd("true")
+	c.SetRlimit(syscall.RLIMIT_NOFILE, 100, 100)
+	c.Run()
+	if got, want := sh.Err, errDidNotCallInitMain; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
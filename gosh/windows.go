@@ -17,6 +17,8 @@ import (
 // that calls InitChildMain.
 
 func (c *Cmd) start() (e error) {
+	// Deferred first, so that it runs last.
+	defer c.runStartHook()
 	defer func() {
 		// Always close afterStartClosers upon return. Only close afterWaitClosers
 		// if start failed; if start succeeds, they're closed in the startExitWaiter
@@ -42,36 +44,37 @@ func (c *Cmd) start() (e error) {
 		return errAlreadyCalledCleanup
 	}
 	// Configure the command.
-	c.c.Path = c.Path
-	vars := copyMap(c.Vars)
-	if c.IgnoreParentExit {
-		delete(vars, envWatchParent)
-	} else {
-		vars[envWatchParent] = "1"
-	}
-	if c.ExitAfter == 0 {
-		delete(vars, envExitAfter)
-	} else {
-		vars[envExitAfter] = c.ExitAfter.String()
-	}
-	c.c.Env = mapToSlice(vars)
+	c.c.Path = c.path()
+	c.c.Dir = c.dir()
+	c.c.Env = c.Environ()
 	c.c.Args = c.Args
 	var err error
 	if c.c.Stdout, c.c.Stderr, err = c.makeStdoutStderr(); err != nil {
 		return err
 	}
+	if replayed, err := c.startRecordOrReplay(); err != nil || replayed {
+		return err
+	}
 	c.c.ExtraFiles = c.ExtraFiles
 	// Start the command.
 	if err = c.c.Start(); err != nil {
 		return err
 	}
-	c.started = true
+	c.setStarted()
 	c.startExitWaiter()
 	return nil
 }
 
+// execWithRlimits is called by InitMain. Resource limits aren't supported on
+// Windows, so it does nothing.
+func execWithRlimits() {}
+
+// setPlatformVars updates vars with the reserved vars that are specific to this
+// platform, of which there are none.
+func (c *Cmd) setPlatformVars(vars map[string]string) {}
+
 func (c *Cmd) cleanupProcessGroup() {
-	if !c.started {
+	if !c.started || c.replayed != nil {
 		return
 	}
 	c.cleanupMu.Lock()
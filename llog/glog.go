@@ -475,6 +475,11 @@ type Log struct {
 
 	// Level flag. Handled atomically.
 	stderrThreshold Severity // The -stderrthreshold flag.
+	minSeverity     Severity // Logs below this severity are discarded.
+
+	// goroutineID is non-zero if headers include the goroutine ID. Handled
+	// atomically.
+	goroutineID int32
 
 	// freeList is a list of byte buffers, maintained under freeListMu.
 	freeList *buffer
@@ -590,6 +595,32 @@ func (l *Log) SetStderrThreshold(s Severity) {
 	l.stderrThreshold.set(s)
 }
 
+// SetMinSeverity sets the severity below which logs are discarded, before
+// any formatting takes place. It is independent of V-levels; e.g. setting it
+// to WarningLog discards all Info logs, including those guarded by V. Fatal
+// logs are never discarded.
+func (l *Log) SetMinSeverity(s Severity) {
+	l.minSeverity.set(s)
+}
+
+// discard reports whether logs of severity s are below the minimum severity.
+func (l *Log) discard(s Severity) bool {
+	return s < l.minSeverity.get() && s < FatalLog
+}
+
+// SetGoroutineID sets the flag that, if true, includes the ID of the logging
+// goroutine in the header of each log line, immediately after the thread id,
+// e.g. "I0102 15:04:05.067890    1234 g17 file.go:10] msg". This helps to
+// correlate the logs of concurrent goroutines, at the cost of a call to
+// runtime.Stack per log line.
+func (l *Log) SetGoroutineID(f bool) {
+	var v int32
+	if f {
+		v = 1
+	}
+	atomic.StoreInt32(&l.goroutineID, v)
+}
+
 // SetVModule sets the comma-separated list of pattern=N settings for
 // file-filtered logging
 func (l *Log) SetVModule(spec ModuleSpec) {
@@ -750,6 +781,12 @@ func (l *Log) headerFileLine(s Severity, file string, line int) (*buffer, string
 	buf.nDigits(7, 22, pid, ' ') // TODO: should be TID
 	buf.tmp[29] = ' '
 	buf.Write(buf.tmp[:30])
+	if atomic.LoadInt32(&l.goroutineID) != 0 {
+		buf.tmp[0] = 'g'
+		n := buf.someDigits(1, goroutineID())
+		buf.tmp[n+1] = ' '
+		buf.Write(buf.tmp[:n+2])
+	}
 	buf.WriteString(file)
 	buf.tmp[0] = ':'
 	n := buf.someDigits(1, line)
@@ -759,6 +796,21 @@ func (l *Log) headerFileLine(s Severity, file string, line int) (*buffer, string
 	return buf, file, line
 }
 
+// goroutineID returns the ID of the calling goroutine, parsed from the first
+// line of its stack trace, e.g. "goroutine 17 [running]:".
+func goroutineID() int {
+	var b [64]byte
+	stack := bytes.TrimPrefix(b[:runtime.Stack(b[:], false)], []byte("goroutine "))
+	id := 0
+	for _, c := range stack {
+		if c < '0' || c > '9' {
+			break
+		}
+		id = id*10 + int(c-'0')
+	}
+	return id
+}
+
 // Some custom tiny helper functions to print the log header efficiently.
 
 const digits = "0123456789"
@@ -813,12 +865,18 @@ func (l *Log) Printf(s Severity, format string, args ...interface{}) {
 }
 
 func (l *Log) PrintlnDepth(s Severity, depth int, args ...interface{}) {
+	if l.discard(s) {
+		return
+	}
 	buf, file, line := l.header(s, depth)
 	fmt.Fprintln(buf, args...)
 	l.output(s, buf, file, line)
 }
 
 func (l *Log) PrintDepth(s Severity, depth int, args ...interface{}) {
+	if l.discard(s) {
+		return
+	}
 	buf, file, line := l.header(s, depth)
 	fmt.Fprint(buf, args...)
 	if buf.Bytes()[buf.Len()-1] != '\n' {
@@ -828,6 +886,9 @@ func (l *Log) PrintDepth(s Severity, depth int, args ...interface{}) {
 }
 
 func (l *Log) PrintfDepth(s Severity, depth int, format string, args ...interface{}) {
+	if l.discard(s) {
+		return
+	}
 	buf, file, line := l.header(s, depth)
 	fmt.Fprintf(buf, format, args...)
 	if buf.Bytes()[buf.Len()-1] != '\n' {
@@ -837,6 +898,9 @@ func (l *Log) PrintfDepth(s Severity, depth int, format string, args ...interfac
 }
 
 func (l *Log) PrintFileLine(s Severity, file string, line int, args ...interface{}) {
+	if l.discard(s) {
+		return
+	}
 	buf, file, line := l.headerFileLine(s, file, line)
 	fmt.Fprint(buf, args...)
 	if buf.Bytes()[buf.Len()-1] != '\n' {
@@ -1060,6 +1124,9 @@ func (l *Log) lockAndFlushAll() {
 	l.mu.Unlock()
 }
 
+// Flush flushes all pending log I/O for every severity and attempts to sync
+// it to disk.  Programs should call Flush before exiting, e.g. before os.Exit,
+// to guarantee that all log output is written.
 func (l *Log) Flush() {
 	l.lockAndFlushAll()
 }
@@ -1205,6 +1272,9 @@ type logBridge struct {
 // Write parses the standard logging line and passes its components to the
 // logger for severity(lb).
 func (lb logBridge) Write(b []byte) (n int, err error) {
+	if lb.log.discard(lb.severity) {
+		return len(b), nil
+	}
 	var (
 		file = "???"
 		line = 1
@@ -0,0 +1,64 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// In-memory capture of log output, for tests.
+
+package llog
+
+import (
+	"bytes"
+)
+
+// captureBuffer wraps a bytes.Buffer to satisfy flushSyncWriter.
+type captureBuffer struct {
+	bytes.Buffer
+}
+
+func (b *captureBuffer) Flush() error {
+	return nil
+}
+
+func (b *captureBuffer) Sync() error {
+	return nil
+}
+
+// CaptureLog is a Log whose output is written to in-memory buffers, one per
+// severity, rather than to files.  It allows tests to assert on the output
+// of code that logs via a Log.
+type CaptureLog struct {
+	*Log
+	bufs [numSeverity]*captureBuffer
+}
+
+// NewCaptureLogger creates a new logger whose output is captured in memory.
+// The name and skip arguments are as for NewLogger.  As with any Log, output
+// at or above the stderr threshold is also written to stderr, and no output
+// is captured if SetLogToStderr(true) is called.
+func NewCaptureLogger(name string, skip int) *CaptureLog {
+	c := &CaptureLog{Log: NewLogger(name, skip)}
+	c.reset()
+	return c
+}
+
+// Contents returns the output captured for severity s.  As with log files, the
+// output for a severity includes the output for all higher severities.
+func (c *CaptureLog) Contents(s Severity) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.bufs[s].String()
+}
+
+// Reset discards all of the captured output.
+func (c *CaptureLog) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.reset()
+}
+
+func (c *CaptureLog) reset() {
+	for s := range c.bufs {
+		c.bufs[s] = new(captureBuffer)
+		c.file[s] = c.bufs[s]
+	}
+}
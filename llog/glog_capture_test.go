@@ -0,0 +1,39 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package llog_test
+
+import (
+	"strings"
+	"testing"
+
+	"v.io/x/lib/llog"
+)
+
+func TestCaptureLogger(t *testing.T) {
+	l := llog.NewCaptureLogger("test", 0)
+	l.SetStderrThreshold(llog.FatalLog)
+	l.Print(llog.InfoLog, "info message")
+	l.Print(llog.WarningLog, "warning message")
+	for _, tc := range []struct {
+		s             llog.Severity
+		info, warning bool
+	}{
+		{llog.InfoLog, true, true},
+		{llog.WarningLog, false, true},
+		{llog.ErrorLog, false, false},
+	} {
+		got := l.Contents(tc.s)
+		if strings.Contains(got, "info message") != tc.info || strings.Contains(got, "warning message") != tc.warning {
+			t.Errorf("%v: unexpected contents %q", tc.s, got)
+		}
+	}
+	if got := l.Contents(llog.InfoLog); !strings.HasPrefix(got, "I") {
+		t.Errorf("got %q, want a line starting with I", got)
+	}
+	l.Reset()
+	if got := l.Contents(llog.InfoLog); got != "" {
+		t.Errorf("got %q, want empty", got)
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Context-bound fields for logs.
+
+package llog
+
+import (
+	"context"
+	"fmt"
+)
+
+// Field is a key/value pair that is attached to a context.Context using
+// WithFields and appended to every record logged with that context.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+type fieldsKey struct{}
+
+// RequestIDKey is the key used by WithRequestID.
+const RequestIDKey = "request_id"
+
+// WithFields returns a copy of ctx with the given fields appended to any
+// fields already attached to ctx.
+func WithFields(ctx context.Context, fields ...Field) context.Context {
+	if len(fields) == 0 {
+		return ctx
+	}
+	prev := Fields(ctx)
+	all := make([]Field, 0, len(prev)+len(fields))
+	all = append(all, prev...)
+	all = append(all, fields...)
+	return context.WithValue(ctx, fieldsKey{}, all)
+}
+
+// WithRequestID returns a copy of ctx with a RequestIDKey field set to id, so
+// that all records logged with the returned context can be correlated.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return WithFields(ctx, Field{RequestIDKey, id})
+}
+
+// Fields returns the fields attached to ctx, in the order that they were
+// attached. The returned slice must not be modified.
+func Fields(ctx context.Context) []Field {
+	fields, _ := ctx.Value(fieldsKey{}).([]Field)
+	return fields
+}
+
+// InfoContext logs args to the INFO log, followed by the fields attached to
+// ctx.
+func (l *Log) InfoContext(ctx context.Context, args ...interface{}) {
+	l.PrintContextDepth(ctx, InfoLog, 1, args...)
+}
+
+func (l *Log) PrintContext(ctx context.Context, s Severity, args ...interface{}) {
+	l.PrintContextDepth(ctx, s, 1, args...)
+}
+
+func (l *Log) PrintfContext(ctx context.Context, s Severity, format string, args ...interface{}) {
+	l.PrintfContextDepth(ctx, s, 1, format, args...)
+}
+
+// PrintContextDepth behaves like PrintDepth, but appends the fields attached
+// to ctx to the record, as space separated key=value pairs.
+func (l *Log) PrintContextDepth(ctx context.Context, s Severity, depth int, args ...interface{}) {
+	if l.discard(s) {
+		return
+	}
+	buf, file, line := l.header(s, depth)
+	fmt.Fprint(buf, args...)
+	writeFields(buf, Fields(ctx))
+	l.output(s, buf, file, line)
+}
+
+// PrintfContextDepth behaves like PrintfDepth, but appends the fields attached
+// to ctx to the record, as space separated key=value pairs.
+func (l *Log) PrintfContextDepth(ctx context.Context, s Severity, depth int, format string, args ...interface{}) {
+	if l.discard(s) {
+		return
+	}
+	buf, file, line := l.header(s, depth)
+	fmt.Fprintf(buf, format, args...)
+	writeFields(buf, Fields(ctx))
+	l.output(s, buf, file, line)
+}
+
+// writeFields appends fields to the message in buf, followed by a newline.
+func writeFields(buf *buffer, fields []Field) {
+	if n := buf.Len(); buf.Bytes()[n-1] == '\n' {
+		buf.Truncate(n - 1)
+	}
+	for _, f := range fields {
+		fmt.Fprintf(buf, " %s=%v", f.Key, f.Value)
+	}
+	buf.WriteByte('\n')
+}
@@ -17,10 +17,11 @@
 package llog
 
 import (
-	"bytes"
+	"context"
 	"fmt"
 	"log"
 	"path/filepath"
+	"reflect"
 	"runtime"
 	"strconv"
 	"strings"
@@ -41,19 +42,6 @@ func TestShortHostname(t *testing.T) {
 	}
 }
 
-// flushBuffer wraps a bytes.Buffer to satisfy flushSyncWriter.
-type flushBuffer struct {
-	bytes.Buffer
-}
-
-func (f *flushBuffer) Flush() error {
-	return nil
-}
-
-func (f *flushBuffer) Sync() error {
-	return nil
-}
-
 // swap sets the log writers and returns the old array.
 func (l *Log) swap(writers [numSeverity]flushSyncWriter) (old [numSeverity]flushSyncWriter) {
 	l.mu.Lock()
@@ -65,12 +53,12 @@ func (l *Log) swap(writers [numSeverity]flushSyncWriter) (old [numSeverity]flush
 
 // newBuffers sets the log writers to all new byte buffers and returns the old array.
 func (l *Log) newBuffers() [numSeverity]flushSyncWriter {
-	return l.swap([numSeverity]flushSyncWriter{new(flushBuffer), new(flushBuffer), new(flushBuffer), new(flushBuffer)})
+	return l.swap([numSeverity]flushSyncWriter{new(captureBuffer), new(captureBuffer), new(captureBuffer), new(captureBuffer)})
 }
 
 // contents returns the specified log value as a string.
 func (l *Log) contents(s Severity) string {
-	return l.file[s].(*flushBuffer).String()
+	return l.file[s].(*captureBuffer).String()
 }
 
 // contains reports whether the string is contained in the log.
@@ -104,6 +92,33 @@ func TestInfo(t *testing.T) {
 	}
 }
 
+func TestInfoContext(t *testing.T) {
+	l := newLogger(t)
+	ctx := context.Background()
+	l.InfoContext(ctx, "no fields")
+	ctx = WithRequestID(ctx, "r1")
+	l.InfoContext(ctx, "one field\n")
+	l.PrintfContext(WithFields(ctx, Field{"user", "bob"}, Field{"n", 3}), WarningLog, "%d fields", 3)
+
+	msgs := strings.Split(strings.TrimSuffix(l.contents(InfoLog), "\n"), "\n")
+	want := []string{
+		"no fields",
+		"one field request_id=r1",
+		"3 fields request_id=r1 user=bob n=3",
+	}
+	if got, want := len(msgs), len(want); got != want {
+		t.Fatalf("got %d lines, want %d: %q", got, want, msgs)
+	}
+	for i, m := range msgs {
+		if !strings.HasSuffix(m, "] "+want[i]) {
+			t.Errorf("got %q, want suffix %q", m, want[i])
+		}
+	}
+	if got, want := Fields(ctx), []Field{{RequestIDKey, "r1"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
 func TestInfoDepth(t *testing.T) {
 	l := newLogger(t)
 
@@ -170,6 +185,34 @@ func TestHeader(t *testing.T) {
 	}
 }
 
+func TestHeaderGoroutineID(t *testing.T) {
+	l := newLogger(t)
+	defer func(previous func() time.Time) { timeNow = previous }(timeNow)
+	timeNow = func() time.Time {
+		return time.Date(2006, 1, 2, 15, 4, 5, .067890e9, time.Local)
+	}
+	pid = 1234
+	l.SetGoroutineID(true)
+	done := make(chan int)
+	go func() {
+		l.Print(InfoLog, "test")
+		done <- goroutineID()
+	}()
+	id := <-done
+	if id == 0 {
+		t.Fatal("goroutineID returned 0")
+	}
+	var gotID, line int
+	format := "I0102 15:04:05.067890    1234 g%d glog_test.go:%d] test\n"
+	if _, err := fmt.Sscanf(l.contents(InfoLog), format, &gotID, &line); err != nil {
+		t.Fatalf("log format error: %v:\n%s", err, l.contents(InfoLog))
+	}
+	want := fmt.Sprintf(format, id, line)
+	if got := l.contents(InfoLog); got != want {
+		t.Errorf("log format error: got:\n\t%q\nwant:\t%q", got, want)
+	}
+}
+
 // Test that an Error log goes to Warning and Info.
 // Even in the Info log, the source character will be E, so the data should
 // all be identical.
@@ -209,6 +252,26 @@ func TestWarning(t *testing.T) {
 	}
 }
 
+// Test that logs below the minimum severity are discarded.
+func TestMinSeverity(t *testing.T) {
+	l := newLogger(t)
+	l.SetMinSeverity(WarningLog)
+	l.Print(InfoLog, "info")
+	l.InfoContext(context.Background(), "info context")
+	l.Print(WarningLog, "warning")
+	if l.contains(InfoLog, "info", t) {
+		t.Errorf("Info not discarded: %q", l.contents(InfoLog))
+	}
+	if !l.contains(WarningLog, "warning", t) {
+		t.Error("Warning failed")
+	}
+	l.SetMinSeverity(InfoLog)
+	l.Print(InfoLog, "info")
+	if !l.contains(InfoLog, "info", t) {
+		t.Error("Info failed")
+	}
+}
+
 // Test that a V log goes to Info.
 func TestV(t *testing.T) {
 	l := newLogger(t)
@@ -455,3 +518,36 @@ func TestCopyStandardLogTo(t *testing.T) {
 		}
 	}
 }
+
+// flushCounter is a flushSyncWriter that counts calls to Flush and Sync.
+type flushCounter struct {
+	captureBuffer
+	flushes, syncs int
+}
+
+func (f *flushCounter) Flush() error {
+	f.flushes++
+	return nil
+}
+
+func (f *flushCounter) Sync() error {
+	f.syncs++
+	return nil
+}
+
+func TestFlush(t *testing.T) {
+	l := newLogger(t)
+	var writers [numSeverity]flushSyncWriter
+	counters := make([]*flushCounter, numSeverity)
+	for s := range writers {
+		counters[s] = new(flushCounter)
+		writers[s] = counters[s]
+	}
+	l.swap(writers)
+	l.Flush()
+	for s, c := range counters {
+		if c.flushes != 1 || c.syncs != 1 {
+			t.Errorf("%v: got %d flushes and %d syncs, want 1 of each", Severity(s), c.flushes, c.syncs)
+		}
+	}
+}
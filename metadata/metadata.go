@@ -40,7 +40,8 @@
 //
 // This package registers a flag -metadata via an init function.  Setting
 // -metadata on the command-line causes the program to dump metadata in the
-// XML format and exit.
+// XML format and exit.  RegisterFlag registers the same flag on other flag
+// sets.
 package metadata
 
 import (
@@ -308,7 +309,19 @@ metadata: built-in initialization failed (%v) from base64 data: %v
 	BuiltIn.Insert("go.OS", runtime.GOOS)
 	BuiltIn.Insert("go.Version", runtime.Version())
 
-	flag.Var(metadataFlag{}, "metadata", "Displays metadata for the program and exits.")
+	RegisterFlag(flag.CommandLine)
+}
+
+// FlagName is the name of the flag registered by RegisterFlag.
+const FlagName = "metadata"
+
+// RegisterFlag registers the -metadata flag on fs, unless fs already has a flag
+// with that name.  Setting the flag dumps the built-in metadata to stdout in the
+// XML format, and exits the program.
+func RegisterFlag(fs *flag.FlagSet) {
+	if fs.Lookup(FlagName) == nil {
+		fs.Var(metadataFlag{}, FlagName, "Displays metadata for the program and exits.")
+	}
 }
 
 // metadataFlag implements a flag that dumps the default metadata and exits the
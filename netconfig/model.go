@@ -14,6 +14,7 @@ package netconfig
 //          network configuration.
 
 import (
+	"net"
 	"sync"
 
 	"v.io/x/lib/netconfig/route"
@@ -48,6 +49,36 @@ type Notifier interface {
 	Shutdown()
 }
 
+// AddressFlags represents the kernel's flags for an IP address.  Only the
+// flags that are relevant to choosing a source address are represented.
+type AddressFlags uint32
+
+const (
+	// AddressTentative is set for an IPv6 address that is still undergoing
+	// duplicate address detection and hence can't be used yet.
+	AddressTentative AddressFlags = 1 << iota
+	// AddressDeprecated is set for an IPv6 address whose preferred lifetime has
+	// expired; it remains valid for existing connections, but shouldn't be
+	// used for new ones.
+	AddressDeprecated
+)
+
+// IPAddressFlags represents the flags for an IP address hosted by the network
+// interface with the given index.
+type IPAddressFlags struct {
+	IfcIndex int
+	IP       net.IP
+	Flags    AddressFlags
+}
+
+// AddressFlagsNotifier may be implemented by a Notifier that can obtain the
+// flags for the IPv6 addresses on the device.
+type AddressFlagsNotifier interface {
+	// GetIPv6AddressFlags returns the flags of all the IPv6 addresses on the
+	// device.
+	GetIPv6AddressFlags() []IPAddressFlags
+}
+
 // NullNotifier represents a null implementation of Notifier that will
 // never return any notifications or routes. It is provided as a default.
 type NullNotifier struct {
@@ -102,6 +133,16 @@ func GetIPRoutes(defaultOnly bool) []route.IPRoute {
 	return globalNotifier.GetIPRoutes(defaultOnly)
 }
 
+// GetIPv6AddressFlags returns the flags of all the IPv6 addresses on the
+// device. It returns nil if the Notifier set via SetOSNotifier doesn't
+// implement AddressFlagsNotifier.
+func GetIPv6AddressFlags() []IPAddressFlags {
+	if n, ok := globalNotifier.(AddressFlagsNotifier); ok {
+		return n.GetIPv6AddressFlags()
+	}
+	return nil
+}
+
 // SetOSNotifier sets a the internal notifier to the one supplied. An
 // existing Notifier will be shutdown.
 func SetOSNotifier(n Notifier) {
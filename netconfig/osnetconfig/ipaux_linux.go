@@ -18,6 +18,7 @@ import (
 	"syscall"
 	"unsafe"
 
+	"v.io/x/lib/netconfig"
 	"v.io/x/lib/netconfig/route"
 	"v.io/x/lib/vlog"
 )
@@ -403,3 +404,47 @@ L:
 	}
 	return iproutes
 }
+
+// GetIPv6AddressFlags implements netconfig.AddressFlagsNotifier.
+func (n *Notifier) GetIPv6AddressFlags() []netconfig.IPAddressFlags {
+	var flags []netconfig.IPAddressFlags
+	rib, err := syscall.NetlinkRIB(syscall.RTM_GETADDR, syscall.AF_INET6)
+	if err != nil {
+		vlog.Infof("Couldn't read: %s", err)
+		return flags
+	}
+	msgs, err := syscall.ParseNetlinkMessage(rib)
+	if err != nil {
+		vlog.Infof("Couldn't parse: %s", err)
+		return flags
+	}
+	for _, m := range msgs {
+		if m.Header.Type != syscall.RTM_NEWADDR || len(m.Data) < syscall.SizeofIfAddrmsg {
+			continue
+		}
+		tmp := m
+		attrs, err := syscall.ParseNetlinkRouteAttr(&tmp)
+		if err != nil {
+			continue
+		}
+		hdr := (*syscall.IfAddrmsg)(unsafe.Pointer(&m.Data[0]))
+		f := netconfig.IPAddressFlags{IfcIndex: int(hdr.Index)}
+		if hdr.Flags&syscall.IFA_F_TENTATIVE != 0 {
+			f.Flags |= netconfig.AddressTentative
+		}
+		if hdr.Flags&syscall.IFA_F_DEPRECATED != 0 {
+			f.Flags |= netconfig.AddressDeprecated
+		}
+		for _, a := range attrs {
+			if a.Attr.Type == syscall.IFA_ADDRESS {
+				if f.IP, err = toIP(a.Value); err != nil {
+					f.IP = nil
+				}
+			}
+		}
+		if f.IP != nil {
+			flags = append(flags, f)
+		}
+	}
+	return flags
+}
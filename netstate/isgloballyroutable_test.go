@@ -20,6 +20,7 @@ func TestIsGloballyRoutable(t *testing.T) {
 		{"172.17.100.255", false},
 		{"172.32.0.1", true},
 		{"255.255.255.255", false},
+		{"169.254.1.1", false},
 		{"127.0.0.1", false},
 		{"224.0.0.1", false},
 		{"FF02::FB", false},
@@ -0,0 +1,71 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netstate
+
+import (
+	"net"
+)
+
+// Scope labels returned by MulticastScope.
+const (
+	MulticastInterfaceLocal    = "interface-local"    // IPv6 ff01::/16
+	MulticastLinkLocal         = "link-local"         // 224.0.0.0/24, IPv6 ff02::/16
+	MulticastAdminLocal        = "admin-local"        // IPv6 ff04::/16
+	MulticastSiteLocal         = "site-local"         // IPv6 ff05::/16
+	MulticastOrganizationLocal = "organization-local" // 239.0.0.0/8, IPv6 ff08::/16
+	MulticastSourceSpecific    = "source-specific"    // 232.0.0.0/8
+	MulticastGlobal            = "global"             // rest of 224.0.0.0/4, IPv6 ff0e::/16
+	MulticastReserved          = "reserved"           // other IPv6 scopes
+)
+
+var (
+	ipv4LinkLocalMulticast      = net.IPNet{IP: net.IPv4(224, 0, 0, 0), Mask: net.IPv4Mask(0xff, 0xff, 0xff, 0)}
+	ipv4SourceSpecificMulticast = net.IPNet{IP: net.IPv4(232, 0, 0, 0), Mask: net.IPv4Mask(0xff, 0, 0, 0)}
+	ipv4AdminScopedMulticast    = net.IPNet{IP: net.IPv4(239, 0, 0, 0), Mask: net.IPv4Mask(0xff, 0, 0, 0)}
+)
+
+// MulticastScope returns a label for the well-known scope of its argument if
+// it is a multicast IP address, or the empty string otherwise. IPv4 addresses
+// are classified by range (RFC 5771, RFC 4607 and RFC 2365), and IPv6
+// addresses by the scope field of the address (RFC 4291). The IPv4
+// administratively scoped range, 239.0.0.0/8, is reported as
+// MulticastOrganizationLocal.
+func MulticastScope(a Address) string {
+	ip := AsIP(a)
+	if ip == nil || !ip.IsMulticast() {
+		return ""
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		switch {
+		case ipv4LinkLocalMulticast.Contains(ip4):
+			return MulticastLinkLocal
+		case ipv4SourceSpecificMulticast.Contains(ip4):
+			return MulticastSourceSpecific
+		case ipv4AdminScopedMulticast.Contains(ip4):
+			return MulticastOrganizationLocal
+		}
+		return MulticastGlobal
+	}
+	switch ip[1] & 0x0f {
+	case 0x1:
+		return MulticastInterfaceLocal
+	case 0x2:
+		return MulticastLinkLocal
+	case 0x4:
+		return MulticastAdminLocal
+	case 0x5:
+		return MulticastSiteLocal
+	case 0x8:
+		return MulticastOrganizationLocal
+	case 0xe:
+		return MulticastGlobal
+	}
+	return MulticastReserved
+}
+
+// IsMulticastIP returns true if its argument is a multicast IP address.
+func IsMulticastIP(a Address) bool {
+	return MulticastScope(a) != ""
+}
@@ -65,6 +65,7 @@ import (
 	"net"
 	"strings"
 	"sync"
+	"time"
 
 	"v.io/x/lib/netconfig"
 )
@@ -74,6 +75,8 @@ var (
 	ErrFailedToParseIPAddr   = errors.New("failed to parse IP address")
 	ErrUnspecifiedIPAddr     = errors.New("unspecified (i.e. zero) IP address")
 	ErrFailedToFindInterface = errors.New("failed to find a network interface")
+	ErrNoAccessibleIPs       = errors.New("timed out waiting for an accessible IP address")
+	ErrStatsNotSupported     = errors.New("interface statistics are not supported on this platform")
 )
 
 type netAddr struct {
@@ -135,6 +138,10 @@ type ipifc struct {
 	// The IPRoutes of the network interface this address is hosted on,
 	// nil if this information is not available.
 	ipRoutes IPRouteList
+	// The flags of the IPv6 addresses hosted on this interface, keyed by
+	// the string form of the IP address, nil if this information is not
+	// available.
+	ipv6Flags map[string]netconfig.AddressFlags
 }
 
 // return a comma separated string of network addresses
@@ -152,11 +159,7 @@ func (ifc ipifc) String() string {
 	if len(ifc.ipRoutes) > 0 {
 		r += " ["
 		for _, rt := range ifc.ipRoutes {
-			src := ""
-			if rt.PreferredSource != nil {
-				src = ", src: " + rt.PreferredSource.String()
-			}
-			r += fmt.Sprintf("{%d: net: %s, gw: %s%s}, ", rt.IfcIndex, rt.Net, rt.Gateway, src)
+			r += "{" + routeString(rt) + "}, "
 		}
 		r = strings.TrimSuffix(r, ", ")
 		r += "]"
@@ -212,6 +215,16 @@ func (ifc ipifc) IPRoutes() IPRouteList {
 	return routes
 }
 
+// Implements InterfaceStatser
+func (ifc ipifc) Stats() (rx, tx uint64, err error) {
+	return interfaceStats(ifc.name, "bytes")
+}
+
+// Implements InterfaceStatser
+func (ifc ipifc) PacketStats() (rx, tx uint64, err error) {
+	return interfaceStats(ifc.name, "packets")
+}
+
 // Network interface represents a network interface.
 type NetworkInterface interface {
 	// Addrs returns the addresses hosted by this interface.
@@ -238,6 +251,19 @@ type IPNetworkInterface interface {
 	IPRoutes() IPRouteList
 }
 
+// InterfaceStatser is an optional interface implemented by the
+// NetworkInterfaces returned by this package that provides the traffic
+// counters of the interface, as read from the operating system at the time
+// of the call. Callers should type-assert a NetworkInterface to
+// InterfaceStatser. The methods return ErrStatsNotSupported on platforms other
+// than Linux.
+type InterfaceStatser interface {
+	// Stats returns the number of bytes received and transmitted.
+	Stats() (rx, tx uint64, err error)
+	// PacketStats returns the number of packets received and transmitted.
+	PacketStats() (rx, tx uint64, err error)
+}
+
 // Address represents a network address and the interface that hosts it.
 type Address interface {
 	// Address returns the network address this instance represents.
@@ -257,17 +283,17 @@ func (al AddrList) String() string {
 	return strings.TrimRight(r, " ")
 }
 
-// RouteTable represents the set of currently available network interfaces
-// and the routes on each such interface. It is index by the index number
-// of each interface.
-type RouteTable map[int]IPRouteList
-
 type netstateCache struct {
 	mu         sync.RWMutex
 	current    bool
 	interfaces []NetworkInterface
 	routes     RouteTable
 	valid      chan struct{}
+
+	// accessible caches the result of GetAccessibleIPs for the state that
+	// accessibleValid is the valid channel for.
+	accessible      AddrList
+	accessibleValid chan struct{}
 }
 
 func (cache *netstateCache) invalidate() {
@@ -294,6 +320,13 @@ func (cache *netstateCache) refresh() error {
 		return err
 	}
 	routes := netconfig.GetIPRoutes(false)
+	ipv6Flags := map[int]map[string]netconfig.AddressFlags{}
+	for _, f := range netconfig.GetIPv6AddressFlags() {
+		if ipv6Flags[f.IfcIndex] == nil {
+			ipv6Flags[f.IfcIndex] = map[string]netconfig.AddressFlags{}
+		}
+		ipv6Flags[f.IfcIndex][f.IP.String()] = f.Flags
+	}
 
 	cache.interfaces = make([]NetworkInterface, len(interfaces))
 	for i, ifc := range interfaces {
@@ -308,6 +341,7 @@ func (cache *netstateCache) refresh() error {
 			flags:        ifc.Flags,
 			hardwareAddr: ifc.HardwareAddr,
 			addrs:        addrs,
+			ipv6Flags:    ipv6Flags[ifc.Index],
 		}
 	}
 
@@ -359,7 +393,11 @@ func InvalidateCache() {
 // may have changed (e.g. following a dhcp change).
 // The returned chan is closed when the returned AddrList has become stale.
 func GetAllAddresses() (AddrList, <-chan struct{}, error) {
-	interfaces, routeTable, valid, err := internalCache.getNetState()
+	return internalCache.getAllAddresses()
+}
+
+func (cache *netstateCache) getAllAddresses() (AddrList, <-chan struct{}, error) {
+	interfaces, routeTable, valid, err := cache.getNetState()
 	if err != nil {
 		return nil, nil, err
 	}
@@ -377,6 +415,29 @@ func GetAllAddresses() (AddrList, <-chan struct{}, error) {
 	return all, valid, nil
 }
 
+// AddressesByInterface returns all of the addresses on the device, grouped by
+// the name of the interface hosting them. Every interface has an entry, even
+// if it has no addresses. As with GetAllAddresses, each Address has its
+// hosting interface filled in.
+func AddressesByInterface() (map[string]AddrList, error) {
+	interfaces, routeTable, _, err := internalCache.getNetState()
+	if err != nil {
+		return nil, err
+	}
+	byName := make(map[string]AddrList, len(interfaces))
+	for _, ifc := range interfaces {
+		al := AddrList{}
+		for _, a := range ifc.Addrs() {
+			al = append(al, &address{
+				addr: a,
+				ifc:  fillInterfaceInfo(ifc, routeTable[ifc.Index()]),
+			})
+		}
+		byName[ifc.Name()] = al
+	}
+	return byName, nil
+}
+
 // InterfaceList represents a list of network interfaces.
 type InterfaceList []NetworkInterface
 
@@ -388,6 +449,7 @@ func fillInterfaceInfo(ifc NetworkInterface, rl IPRouteList) ipifc {
 		flags:        ifc.Flags(),
 		hardwareAddr: ifc.HardwareAddr(),
 		addrs:        ifc.Addrs(),
+		ipv6Flags:    ipv6FlagsOf(ifc),
 	}
 	if rl != nil {
 		n.ipRoutes = rl
@@ -426,7 +488,10 @@ func GetAccessibleIPs() (AddrList, error) {
 	if err != nil {
 		return nil, err
 	}
+	return accessibleIPs(all), nil
+}
 
+func accessibleIPs(all AddrList) AddrList {
 	convertAccessible := func(a Address) Address {
 		ah := WithIPHost(a)
 		if !IsAccessibleIP(ah) {
@@ -434,8 +499,130 @@ func GetAccessibleIPs() (AddrList, error) {
 		}
 		return WithIPHost(ah)
 	}
+	return all.Map(convertAccessible)
+}
 
-	return all.Map(convertAccessible), nil
+// HasNonLoopbackAddress returns true if any interface on the device hosts an
+// accessible address, i.e. one that is neither loopback nor unspecified. It
+// is intended for bootstrap checks of whether the device has any network
+// connectivity beyond itself.
+func HasNonLoopbackAddress() (bool, error) {
+	al, err := GetAccessibleIPs()
+	if err != nil {
+		return false, err
+	}
+	return len(al) > 0, nil
+}
+
+// AddressesInCIDR returns the accessible IP addresses (see GetAccessibleIPs)
+// that are contained in the given CIDR block, e.g. "10.0.0.0/8". It is
+// intended for selecting the addresses on a particular network, such as a
+// management network, to bind to.
+func AddressesInCIDR(cidr string) (AddrList, error) {
+	_, ipnet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, err
+	}
+	al, err := GetAccessibleIPs()
+	if err != nil {
+		return nil, err
+	}
+	return al.Filter(func(a Address) bool {
+		ip := AsIP(a)
+		return ip != nil && ipnet.Contains(ip)
+	}), nil
+}
+
+// GetAccessibleIPsCached is like GetAccessibleIPs, except that it reuses the
+// previously computed result until the cached network state is invalidated
+// (see InvalidateCache). The returned chan is closed when the returned AddrList
+// has become stale. The returned AddrList is a copy, but the Addresses within
+// it are shared with other callers and must not be modified.
+func GetAccessibleIPsCached() (AddrList, <-chan struct{}, error) {
+	return internalCache.getAccessibleIPs()
+}
+
+func (cache *netstateCache) getAccessibleIPs() (AddrList, <-chan struct{}, error) {
+	if err := cache.refresh(); err != nil {
+		return nil, nil, err
+	}
+	cache.mu.RLock()
+	if cache.accessibleValid != nil && cache.accessibleValid == cache.valid {
+		al, valid := make(AddrList, len(cache.accessible)), cache.accessibleValid
+		copy(al, cache.accessible)
+		cache.mu.RUnlock()
+		return al, valid, nil
+	}
+	cache.mu.RUnlock()
+
+	all, valid, err := cache.getAllAddresses()
+	if err != nil {
+		return nil, nil, err
+	}
+	accessible := accessibleIPs(all)
+	cache.mu.Lock()
+	// Only cache the result if the state it was computed from is still current.
+	if valid == (<-chan struct{})(cache.valid) {
+		cache.accessible, cache.accessibleValid = accessible, cache.valid
+	}
+	cache.mu.Unlock()
+	al := make(AddrList, len(accessible))
+	copy(al, accessible)
+	return al, valid, nil
+}
+
+// waitForAccessibleIPPoll is how often WaitForAccessibleIP polls the network
+// state to look for new addresses, in case no network change is reported.
+const waitForAccessibleIPPoll = time.Second
+
+// WaitForAccessibleIP waits until at least one accessible IP address is
+// available, e.g. once DHCP has assigned an address at boot, and returns the
+// accessible addresses as per GetAccessibleIPsCached. The cached network state
+// is re-fetched whenever it is invalidated, and whenever netconfig reports a
+// network change. The network state is also polled periodically in case no
+// change is reported, e.g. because the OS change notifier couldn't be
+// initialized; the cache is only invalidated if polling finds an accessible
+// address. Returns ErrNoAccessibleIPs if no address is available once the
+// timeout elapses.
+func WaitForAccessibleIP(timeout time.Duration) (AddrList, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	ticker := time.NewTicker(waitForAccessibleIPPoll)
+	defer ticker.Stop()
+	// The channel returned by NotifyChange is closed on the next change, so it
+	// is only re-requested after a change. If there are no change notifications,
+	// changed is nil, and we rely on the cache invalidation and the ticker.
+	notifyChange := func() <-chan struct{} {
+		changed, err := netconfig.NotifyChange()
+		if err != nil {
+			return nil
+		}
+		return changed
+	}
+	changed := notifyChange()
+	for {
+		al, valid, err := GetAccessibleIPsCached()
+		if err != nil {
+			return nil, err
+		}
+		if len(al) > 0 {
+			return al, nil
+		}
+		select {
+		case <-valid:
+		case <-changed:
+			InvalidateCache()
+			changed = notifyChange()
+		case <-ticker.C:
+			// Poll a private copy of the network state, so that the shared cache
+			// and its watchers are only disturbed if the state has changed.
+			if polled, _, err := (&netstateCache{}).getAccessibleIPs(); err == nil && len(polled) > 0 {
+				InvalidateCache()
+			}
+		case <-timer.C:
+			return nil, ErrNoAccessibleIPs
+		}
+	}
 }
 
 // AsNetAddrs returns al as a slice of net.Addrs by changing the type
@@ -539,9 +726,22 @@ func ipifcFromNetIfc(ifc IPNetworkInterface) ipifc {
 		hardwareAddr: ifc.HardwareAddr(),
 		addrs:        ifc.Addrs(),
 		ipRoutes:     ifc.IPRoutes(),
+		ipv6Flags:    ipv6FlagsOf(ifc),
 	}
 }
 
+// ipv6FlagsOf returns the flags of the IPv6 addresses hosted on ifc, or nil
+// if they're not available.
+func ipv6FlagsOf(ifc NetworkInterface) map[string]netconfig.AddressFlags {
+	switch v := ifc.(type) {
+	case ipifc:
+		return v.ipv6Flags
+	case *ipifc:
+		return v.ipv6Flags
+	}
+	return nil
+}
+
 // AddressFromAddr creates an instance of Address given the suppied
 // net.Addr.  It will search through the available network interfaces
 // to find the interface that hosts this address.
@@ -676,6 +876,16 @@ func IsUnicastIPv4(a Address) bool {
 	return false
 }
 
+// IsLinkLocalUnicastIPv4 returns true if its argument is an IPv4 link-local
+// unicast address, i.e. in 169.254.0.0/16 (RFC 3927). Such addresses are
+// typically self-assigned when DHCP fails and are never globally routable.
+func IsLinkLocalUnicastIPv4(a Address) bool {
+	if ip := AsIP(a); ip != nil && ip.To4() != nil {
+		return ip.IsLinkLocalUnicast()
+	}
+	return false
+}
+
 // IsPublicUnicastIPv4 returns true if its argument is a globally routable,
 // public IPv4 unicast address.
 func IsPublicUnicastIPv4(a Address) bool {
@@ -695,6 +905,23 @@ func IsUnicastIPv6(a Address) bool {
 	return false
 }
 
+// IsPreferredIPv6 returns true if its argument is a unicast IPv6 address that
+// is neither tentative nor deprecated, and hence may be used for new
+// connections. The flags are only known for addresses obtained via
+// GetAllAddresses and related functions, and only on systems whose
+// netconfig.Notifier implements netconfig.AddressFlagsNotifier; other IPv6
+// addresses are assumed to be preferred.
+func IsPreferredIPv6(a Address) bool {
+	if !IsUnicastIPv6(a) {
+		return false
+	}
+	var flags netconfig.AddressFlags
+	if ifc := a.Interface(); ifc != nil {
+		flags = ipv6FlagsOf(ifc)[AsIP(a).String()]
+	}
+	return flags&(netconfig.AddressTentative|netconfig.AddressDeprecated) == 0
+}
+
 // IsUnicastIPv6 returns true if its argument is a globally routable IP6
 // address
 func IsPublicUnicastIPv6(a Address) bool {
@@ -721,23 +948,29 @@ func IsPublicUnicastIP(a Address) bool {
 }
 
 func diffAB(a, b AddrList) AddrList {
+	inB := make(map[addrKey]struct{}, len(b))
+	for _, bv := range b {
+		inB[keyOf(bv)] = struct{}{}
+	}
 	diff := AddrList{}
 	for _, av := range a {
-		found := false
-		for _, bv := range b {
-			if av.Network() == bv.Network() &&
-				av.String() == bv.String() {
-				found = true
-				break
-			}
-		}
-		if !found {
+		if _, found := inB[keyOf(av)]; !found {
 			diff = append(diff, av)
 		}
 	}
 	return diff
 }
 
+// addrKey identifies an Address by its network and string form; two Addresses
+// with the same key are considered equivalent.
+type addrKey struct {
+	network, addr string
+}
+
+func keyOf(a Address) addrKey {
+	return addrKey{a.Network(), a.String()}
+}
+
 // FindAdded returns the set addresses that are present in b, but not
 // in a - i.e. have been added.
 func FindAdded(a, b AddrList) AddrList {
@@ -8,8 +8,12 @@ import (
 	"fmt"
 	"net"
 	"reflect"
+	"sort"
 	"testing"
+	"time"
 
+	"v.io/x/lib/netconfig"
+	"v.io/x/lib/netconfig/osnetconfig"
 	"v.io/x/lib/netstate"
 )
 
@@ -37,6 +41,241 @@ func TestGet(t *testing.T) {
 	}
 }
 
+func TestGetAccessibleIPsCached(t *testing.T) {
+	_, ifcs, rt := mockInterfacesAndRouteTable()
+	cleanup := netstate.CreateAndUseMockCache(ifcs, rt)
+	defer cleanup()
+
+	want, err := netstate.GetAccessibleIPs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	al1, valid1, err := netstate.GetAccessibleIPsCached()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := al1; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	al2, valid2, err := netstate.GetAccessibleIPsCached()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if valid1 != valid2 {
+		t.Errorf("expected the same valid channel")
+	}
+	if got, want := len(al2), len(al1); got != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range al1 {
+		if al1[i] != al2[i] {
+			t.Errorf("%d: expected cached address %v to be reused", i, al1[i])
+		}
+	}
+
+	netstate.InvalidateCache()
+	select {
+	case <-valid2:
+	default:
+		t.Fatalf("expected valid channel to be closed")
+	}
+	al3, _, err := netstate.GetAccessibleIPsCached()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range al3 {
+		if i < len(al1) && al1[i] == al3[i] {
+			t.Errorf("%d: expected %v to be recomputed", i, al3[i])
+		}
+	}
+}
+
+func TestWaitForAccessibleIP(t *testing.T) {
+	_, ifcs, rt := mockInterfacesAndRouteTable()
+	cleanup := netstate.CreateAndUseMockCache(ifcs, rt)
+	want, err := netstate.GetAccessibleIPs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := netstate.WaitForAccessibleIP(time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	cleanup()
+
+	lo := netstate.NewInterface("lo", 1, []net.Addr{&net.IPNet{IP: net.IPv4(127, 0, 0, 1), Mask: net.CIDRMask(8, 32)}}, nil)
+	cleanup = netstate.CreateAndUseMockCache([]netstate.NetworkInterface{lo}, nil)
+	defer cleanup()
+	if _, err := netstate.WaitForAccessibleIP(10 * time.Millisecond); err != netstate.ErrNoAccessibleIPs {
+		t.Errorf("got %v, want %v", err, netstate.ErrNoAccessibleIPs)
+	}
+	// A change to the mock cache is picked up.
+	if got, err := waitForMockChange(ifcs, rt); err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, %v, want %v, nil", got, err, want)
+	}
+}
+
+// waitForMockChange calls WaitForAccessibleIP, and changes the mock cache to
+// the given interfaces and routes while it waits.
+func waitForMockChange(ifcs []netstate.NetworkInterface, rt netstate.RouteTable) (netstate.AddrList, error) {
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		netstate.ChangeMockCache(ifcs, rt)
+	}()
+	return netstate.WaitForAccessibleIP(time.Minute)
+}
+
+// failingNotifier is a netconfig.Notifier that can't report changes.
+type failingNotifier struct {
+	netconfig.NullNotifier
+}
+
+func (*failingNotifier) NotifyChange() (<-chan struct{}, error) {
+	return nil, fmt.Errorf("no change notifications")
+}
+
+func TestWaitForAccessibleIPNoNotifier(t *testing.T) {
+	netconfig.SetOSNotifier(&failingNotifier{})
+	// Restore the notifier installed by init in route_test.go.
+	defer netconfig.SetOSNotifier(osnetconfig.NewNotifier(0))
+	lo := netstate.NewInterface("lo", 1, []net.Addr{&net.IPNet{IP: net.IPv4(127, 0, 0, 1), Mask: net.CIDRMask(8, 32)}}, nil)
+	cleanup := netstate.CreateAndUseMockCache([]netstate.NetworkInterface{lo}, nil)
+	defer cleanup()
+	// Without change notifications, WaitForAccessibleIP still waits, and picks up
+	// the new network state once the cache is invalidated.
+	if _, err := netstate.WaitForAccessibleIP(10 * time.Millisecond); err != netstate.ErrNoAccessibleIPs {
+		t.Errorf("got %v, want %v", err, netstate.ErrNoAccessibleIPs)
+	}
+	_, ifcs, rt := mockInterfacesAndRouteTable()
+	if got, err := waitForMockChange(ifcs, rt); err != nil || len(got) == 0 {
+		t.Errorf("got %v, %v, want some addresses", got, err)
+	}
+}
+
+func TestAddressesByInterface(t *testing.T) {
+	_, ifcs, rt := mockInterfacesAndRouteTable()
+	cleanup := netstate.CreateAndUseMockCache(ifcs, rt)
+	defer cleanup()
+
+	byName, err := netstate.AddressesByInterface()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(byName), len(ifcs); got != want {
+		t.Fatalf("got %v interfaces, want %v", got, want)
+	}
+	for _, ifc := range ifcs {
+		al := byName[ifc.Name()]
+		if got, want := len(al), len(ifc.Addrs()); got != want {
+			t.Errorf("%v: got %v addresses, want %v", ifc.Name(), got, want)
+			continue
+		}
+		for i, a := range al {
+			if got, want := a.String(), ifc.Addrs()[i].String(); got != want {
+				t.Errorf("%v: got %v, want %v", ifc.Name(), got, want)
+			}
+			if got, want := a.Interface().Name(), ifc.Name(); got != want {
+				t.Errorf("%v: got interface %v, want %v", a, got, want)
+			}
+		}
+	}
+}
+
+func TestIsPreferredIPv6(t *testing.T) {
+	var addrs []net.Addr
+	for _, cidr := range []string{"2001:db8::1/64", "2001:db8::2/64", "2001:db8::3/64", "fe80::4/64", "192.168.1.1/24"} {
+		ip, ipnet, _ := net.ParseCIDR(cidr)
+		ipnet.IP = ip
+		addrs = append(addrs, ipnet)
+	}
+	ifc := netstate.NewInterface("eth0", 1, addrs, nil)
+	netstate.SetIPv6Flags(ifc, "2001:db8::2", netconfig.AddressDeprecated)
+	netstate.SetIPv6Flags(ifc, "2001:db8::3", netconfig.AddressTentative)
+	netstate.SetIPv6Flags(ifc, "fe80::4", 0)
+	cleanup := netstate.CreateAndUseMockCache([]netstate.NetworkInterface{ifc}, nil)
+	defer cleanup()
+
+	all, _, err := netstate.GetAllAddresses()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := all.Filter(netstate.IsPreferredIPv6).String(), "(2001:db8::1/64) (fe80::4/64)"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	// The flags survive conversion to a host address.
+	if got, want := all.Map(netstate.WithIPHost).Filter(netstate.IsPreferredIPv6).String(), "(2001:db8::1) (fe80::4)"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	// Addresses without interface information are assumed to be preferred.
+	if !netstate.IsPreferredIPv6(netstate.NewIPAddr("ip", "2001:db8::2")) {
+		t.Errorf("expected address without flags to be preferred")
+	}
+}
+
+func TestHasNonLoopbackAddress(t *testing.T) {
+	_, ifcs, rt := mockInterfacesAndRouteTable()
+	cleanup := netstate.CreateAndUseMockCache(ifcs, rt)
+	ok, err := netstate.HasNonLoopbackAddress()
+	cleanup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Errorf("got false, want true")
+	}
+
+	lo := netstate.NewInterface("lo", 1, []net.Addr{
+		netstate.MkAddr("ip", "127.0.0.1/8"),
+		netstate.MkAddr("ip6", "::1/128"),
+	}, nil)
+	cleanup = netstate.CreateAndUseMockCache([]netstate.NetworkInterface{lo}, netstate.RouteTable{})
+	defer cleanup()
+	ok, err = netstate.HasNonLoopbackAddress()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok {
+		t.Errorf("got true, want false")
+	}
+}
+
+func TestAddressesInCIDR(t *testing.T) {
+	_, ifcs, rt := mockInterfacesAndRouteTable()
+	cleanup := netstate.CreateAndUseMockCache(ifcs, rt)
+	defer cleanup()
+	for _, tc := range []struct {
+		cidr string
+		want []string
+	}{
+		{"192.168.0.0/16", []string{"192.168.1.10", "192.168.1.20"}},
+		{"172.16.0.0/12", []string{"172.16.1.11", "172.16.2.12", "172.19.39.142"}},
+		{"172.16.2.0/24", []string{"172.16.2.12"}},
+		{"2620::/16", []string{"2620:0:1000:5e01:56e4:3aff:fef1:1383"}},
+		{"10.0.0.0/8", nil},
+		// Loopback addresses are never accessible.
+		{"127.0.0.0/8", nil},
+	} {
+		al, err := netstate.AddressesInCIDR(tc.cidr)
+		if err != nil {
+			t.Fatalf("%v: %v", tc.cidr, err)
+		}
+		var got []string
+		for _, a := range al {
+			got = append(got, netstate.AsIP(a).String())
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%v: got %v, want %v", tc.cidr, got, tc.want)
+		}
+	}
+	if _, err := netstate.AddressesInCIDR("10.0.0.0"); err == nil {
+		t.Errorf("expected an error")
+	}
+}
+
 type ma struct {
 	n, a string
 }
@@ -193,6 +432,18 @@ func TestPredicates(t *testing.T) {
 		{netstate.IsPublicUnicastIP, "ff01::01", false},
 		{netstate.IsPublicUnicastIP, "2001:4860:0:2001::69", true},
 
+		{netstate.IsLinkLocalUnicastIPv4, "0.0.0.0", false},
+		{netstate.IsLinkLocalUnicastIPv4, "127.0.0.1", false},
+		{netstate.IsLinkLocalUnicastIPv4, "169.254.0.1", true},
+		{netstate.IsLinkLocalUnicastIPv4, "169.254.255.254", true},
+		{netstate.IsLinkLocalUnicastIPv4, "169.255.0.1", false},
+		{netstate.IsLinkLocalUnicastIPv4, "192.168.1.3", false},
+		{netstate.IsLinkLocalUnicastIPv4, "224.0.0.2", false},
+		{netstate.IsLinkLocalUnicastIPv4, "fe80::1", false},
+		{netstate.IsLinkLocalUnicastIPv4, "2001:4860:0:2001::6a", false},
+
+		{netstate.IsPublicUnicastIPv4, "169.254.10.20", false},
+		{netstate.IsPublicUnicastIP, "169.254.10.20", false},
 		{netstate.IsPublicUnicastIPv4, "0.0.0.0", false},
 		{netstate.IsPublicUnicastIPv4, "::", false},
 		{netstate.IsPublicUnicastIPv4, "127.0.0.1", false},
@@ -216,6 +467,13 @@ func TestPredicates(t *testing.T) {
 		{netstate.IsPublicUnicastIPv6, "fc00:123a::", true},
 		{netstate.IsPublicUnicastIPv6, "ff01::03", false},
 		{netstate.IsPublicUnicastIPv6, "2607:f8b0:4003:c00::6b", true},
+
+		{netstate.IsMulticastIP, "0.0.0.0", false},
+		{netstate.IsMulticastIP, "192.168.1.4", false},
+		{netstate.IsMulticastIP, "224.0.0.2", true},
+		{netstate.IsMulticastIP, "239.255.255.250", true},
+		{netstate.IsMulticastIP, "2607:f8b0:4003:c00::6b", false},
+		{netstate.IsMulticastIP, "ff02::fb", true},
 	}
 	for i, c := range cases {
 		net := "tcp"
@@ -225,6 +483,38 @@ func TestPredicates(t *testing.T) {
 	}
 }
 
+func TestMulticastScope(t *testing.T) {
+	cases := []struct {
+		a, scope string
+	}{
+		{"0.0.0.0", ""},
+		{"192.168.1.1", ""},
+		{"::1", ""},
+		{"2001:4860:0:2001::68", ""},
+		{"224.0.0.251", netstate.MulticastLinkLocal},
+		{"224.0.1.1", netstate.MulticastGlobal},
+		{"233.252.0.1", netstate.MulticastGlobal},
+		{"232.1.2.3", netstate.MulticastSourceSpecific},
+		{"239.255.255.250", netstate.MulticastOrganizationLocal},
+		{"ff01::1", netstate.MulticastInterfaceLocal},
+		{"ff02::fb", netstate.MulticastLinkLocal},
+		{"ff04::1", netstate.MulticastAdminLocal},
+		{"ff05::1:3", netstate.MulticastSiteLocal},
+		{"ff08::1", netstate.MulticastOrganizationLocal},
+		{"ff0e::101", netstate.MulticastGlobal},
+		{"ff3e::8000:1", netstate.MulticastGlobal},
+		{"ff03::1", netstate.MulticastReserved},
+	}
+	for _, c := range cases {
+		if got, want := netstate.MulticastScope(netstate.NewIPAddr("udp", c.a)), c.scope; got != want {
+			t.Errorf("%s: got %q, want %q", c.a, got, want)
+		}
+	}
+	if got, want := netstate.MulticastScope(netstate.NewAddr("tcp", "not-an-ip")), ""; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
 var (
 	a  = netstate.NewIPAddr("tcp4", "1.2.3.4")
 	b  = netstate.NewIPAddr("tcp4", "1.2.3.5")
@@ -313,6 +603,33 @@ func TestAdded(t *testing.T) {
 	}
 }
 
+// Duplicate addresses are preserved, in input order.
+func TestFindDuplicates(t *testing.T) {
+	al := netstate.AddrList{a, c, a, b, c}
+	bl := netstate.AddrList{b, b}
+	if got, want := netstate.FindRemoved(al, bl), (netstate.AddrList{a, c, a, c}); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	if got, want := netstate.FindAdded(bl, al), (netstate.AddrList{a, c, a, c}); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func BenchmarkFindRemoved(b *testing.B) {
+	var al, bl netstate.AddrList
+	for i := 0; i < 300; i++ {
+		addr := netstate.NewIPAddr("tcp", fmt.Sprintf("10.0.%d.%d", i/256, i%256))
+		al = append(al, addr)
+		if i%2 == 0 {
+			bl = append(bl, addr)
+		}
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		netstate.FindRemoved(al, bl)
+	}
+}
+
 // buildNonLocalhostTestAddress constructs a selection of test addresses
 // that are local.
 func buildNonLocalhostTestAddress(t *testing.T) []string {
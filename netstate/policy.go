@@ -0,0 +1,69 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netstate
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// policyPredicates maps the names accepted by ParsePolicy to predicates.
+var policyPredicates = map[string]AddressPredicate{
+	"unspecified":     IsUnspecifiedIP,
+	"loopback":        IsLoopbackIP,
+	"accessible":      IsAccessibleIP,
+	"unicast":         IsUnicastIP,
+	"unicast-ipv4":    IsUnicastIPv4,
+	"link-local-ipv4": IsLinkLocalUnicastIPv4,
+	"public-ipv4":     IsPublicUnicastIPv4,
+	"unicast-ipv6":    IsUnicastIPv6,
+	"preferred-ipv6":  IsPreferredIPv6,
+	"public-ipv6":     IsPublicUnicastIPv6,
+	"public":          IsPublicUnicastIP,
+	"multicast":       IsMulticastIP,
+	"default-route":   IsOnDefaultRoute,
+}
+
+// PolicyNames returns the sorted names of the predicates accepted by
+// ParsePolicy.
+func PolicyNames() []string {
+	names := make([]string, 0, len(policyPredicates))
+	for name := range policyPredicates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ParsePolicy parses a comma-separated list of predicate names, e.g.
+// "public-ipv4,unicast-ipv6", into the corresponding predicates, in order.
+// This allows policies such as 'find the first public IPv4 address, failing
+// that an IPv6 address' to be specified as configuration data rather than
+// code; see PolicyNames for the supported names and ApplyPolicy for applying
+// the result.
+func ParsePolicy(spec string) ([]AddressPredicate, error) {
+	var policy []AddressPredicate
+	for _, name := range strings.Split(spec, ",") {
+		name = strings.TrimSpace(name)
+		predicate, ok := policyPredicates[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown address predicate %q in policy %q, want one of %s", name, spec, strings.Join(PolicyNames(), ", "))
+		}
+		policy = append(policy, predicate)
+	}
+	return policy, nil
+}
+
+// ApplyPolicy returns the addresses in al that match the first predicate in
+// policy that matches any of them, or nil if none match.
+func (al AddrList) ApplyPolicy(policy []AddressPredicate) AddrList {
+	for _, predicate := range policy {
+		if matched := al.Filter(predicate); len(matched) > 0 {
+			return matched
+		}
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netstate_test
+
+import (
+	"strings"
+	"testing"
+
+	"v.io/x/lib/netstate"
+)
+
+func TestParsePolicy(t *testing.T) {
+	al := netstate.AddrList{
+		netstate.NewIPAddr("ip", "127.0.0.1"),
+		netstate.NewIPAddr("ip", "192.168.1.1"),
+		netstate.NewIPAddr("ip", "8.8.8.8"),
+		netstate.NewIPAddr("ip", "2001:4860:0:2001::68"),
+	}
+	tests := []struct {
+		spec, want string
+	}{
+		{"public-ipv4", "(8.8.8.8)"},
+		{"public-ipv6, public-ipv4", "(2001:4860:0:2001::68)"},
+		{"multicast,unicast-ipv4", "(127.0.0.1) (192.168.1.1) (8.8.8.8)"},
+		{"loopback", "(127.0.0.1)"},
+		{"multicast", ""},
+	}
+	for _, test := range tests {
+		policy, err := netstate.ParsePolicy(test.spec)
+		if err != nil {
+			t.Errorf("%q: %v", test.spec, err)
+			continue
+		}
+		if got, want := al.ApplyPolicy(policy).String(), test.want; got != want {
+			t.Errorf("%q: got %v, want %v", test.spec, got, want)
+		}
+	}
+	for _, spec := range []string{"", "public-ipv4,", "private-ipv6", "public-ipv4,foo"} {
+		if _, err := netstate.ParsePolicy(spec); err == nil || !strings.Contains(err.Error(), "unknown address predicate") {
+			t.Errorf("%q: got %v, want an error", spec, err)
+		}
+	}
+	for _, name := range netstate.PolicyNames() {
+		if _, err := netstate.ParsePolicy(name); err != nil {
+			t.Errorf("%q: %v", name, err)
+		}
+	}
+}
@@ -6,7 +6,10 @@ package netstate
 
 import (
 	"fmt"
+	"net"
+	"sort"
 	"strings"
+	"text/tabwriter"
 
 	"v.io/x/lib/netconfig/route"
 )
@@ -17,15 +20,85 @@ type IPRouteList []route.IPRoute
 func (rl IPRouteList) String() string {
 	r := ""
 	for _, rt := range rl {
-		src := ""
-		if len(rt.PreferredSource) > 0 {
-			src = ", src: " + rt.PreferredSource.String()
-		}
-		r += fmt.Sprintf("(%d: net: %s, gw: %s%s) ", rt.IfcIndex, rt.Net, rt.Gateway, src)
+		r += "(" + routeString(rt) + ") "
 	}
 	return strings.TrimRight(r, " ")
 }
 
+// Lookup returns the route in rl that best matches the destination dst, i.e.
+// the route whose network contains dst with the longest prefix. If several
+// routes have the longest prefix, the first one is returned. Returns false if
+// no route matches.
+func (rl IPRouteList) Lookup(dst net.IP) (route.IPRoute, bool) {
+	best, bestOnes := -1, -1
+	for i, r := range rl {
+		if !r.Net.Contains(dst) {
+			continue
+		}
+		if ones, _ := r.Net.Mask.Size(); ones > bestOnes {
+			best, bestOnes = i, ones
+		}
+	}
+	if best < 0 {
+		return route.IPRoute{}, false
+	}
+	return rl[best], true
+}
+
+// LookupSource returns the preferred source address for the destination dst,
+// as specified by the route returned by Lookup. Returns nil if no route
+// matches, or if the matching route has no preferred source.
+func (rl IPRouteList) LookupSource(dst net.IP) net.IP {
+	r, ok := rl.Lookup(dst)
+	if !ok {
+		return nil
+	}
+	return r.PreferredSource
+}
+
+// routeString returns a one line description of the supplied route.
+func routeString(rt route.IPRoute) string {
+	src := ""
+	if len(rt.PreferredSource) > 0 {
+		src = ", src: " + rt.PreferredSource.String()
+	}
+	return fmt.Sprintf("%d: net: %s, gw: %s%s", rt.IfcIndex, rt.Net, rt.Gateway, src)
+}
+
+// RouteTable represents the set of currently available network interfaces
+// and the routes on each such interface. It is index by the index number
+// of each interface.
+type RouteTable map[int]IPRouteList
+
+// String returns a table of the routes in rt, one route per line, ordered
+// by interface index. Each line contains the interface index, the
+// destination network, the gateway and the preferred source address; a
+// gateway or source that is not set is displayed as "-".
+func (rt RouteTable) String() string {
+	indices := make([]int, 0, len(rt))
+	for idx := range rt {
+		indices = append(indices, idx)
+	}
+	sort.Ints(indices)
+	out := &strings.Builder{}
+	tw := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "IFC\tNET\tGATEWAY\tSOURCE")
+	for _, idx := range indices {
+		for _, r := range rt[idx] {
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", idx, r.Net.String(), ipOrDash(r.Gateway), ipOrDash(r.PreferredSource))
+		}
+	}
+	tw.Flush()
+	return out.String()
+}
+
+func ipOrDash(ip net.IP) string {
+	if len(ip) == 0 {
+		return "-"
+	}
+	return ip.String()
+}
+
 // RoutePredicate defines the function signature for predicate functions
 // to be used with RouteList
 type RoutePredicate func(r *route.IPRoute) bool
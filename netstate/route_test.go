@@ -261,3 +261,79 @@ func TestRoutePredicate(t *testing.T) {
 	cleanup()
 
 }
+
+func TestRouteTableString(t *testing.T) {
+	_, net1, _ := net.ParseCIDR("192.168.1.0/24")
+	_, def, _ := net.ParseCIDR("0.0.0.0/0")
+	rt := netstate.RouteTable{
+		3: {{
+			Net:             *def,
+			Gateway:         net.ParseIP("172.16.2.12"),
+			PreferredSource: net.ParseIP("172.16.2.1"),
+			IfcIndex:        3,
+		}},
+		1: {{
+			Net:      *net1,
+			IfcIndex: 1,
+		}},
+	}
+	want := `IFC  NET             GATEWAY      SOURCE
+1    192.168.1.0/24  -            -
+3    0.0.0.0/0       172.16.2.12  172.16.2.1
+`
+	if got := rt.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got, want := (netstate.RouteTable{}).String(), "IFC  NET  GATEWAY  SOURCE\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestRouteLookup(t *testing.T) {
+	mkRoute := func(cidr, src string, ifc int) route.IPRoute {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return route.IPRoute{Net: *n, PreferredSource: net.ParseIP(src), IfcIndex: ifc}
+	}
+	rl := netstate.IPRouteList{
+		mkRoute("0.0.0.0/0", "192.168.1.2", 1),
+		mkRoute("10.0.0.0/8", "10.0.0.2", 2),
+		mkRoute("10.1.0.0/16", "10.1.0.2", 3),
+		mkRoute("172.16.0.0/12", "", 4),
+		mkRoute("2001:db8::/32", "2001:db8::2", 5),
+	}
+	for _, tc := range []struct {
+		dst     string
+		wantIfc int
+		wantSrc string
+	}{
+		{"8.8.8.8", 1, "192.168.1.2"},
+		{"10.2.3.4", 2, "10.0.0.2"},
+		{"10.1.3.4", 3, "10.1.0.2"},
+		{"172.16.1.1", 4, ""},
+		{"2001:db8::1", 5, "2001:db8::2"},
+		{"2001:db9::1", 0, ""},
+	} {
+		dst := net.ParseIP(tc.dst)
+		r, ok := rl.Lookup(dst)
+		if got, want := ok, tc.wantIfc != 0; got != want {
+			t.Errorf("%v: got %v, want %v", tc.dst, got, want)
+		}
+		if got, want := r.IfcIndex, tc.wantIfc; got != want {
+			t.Errorf("%v: got interface %v, want %v", tc.dst, got, want)
+		}
+		src := rl.LookupSource(dst)
+		if got, want := ipString(src), tc.wantSrc; got != want {
+			t.Errorf("%v: got source %q, want %q", tc.dst, got, want)
+		}
+	}
+}
+
+func ipString(ip net.IP) string {
+	if ip == nil {
+		return ""
+	}
+	return ip.String()
+}
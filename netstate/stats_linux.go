@@ -0,0 +1,39 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build linux
+// +build linux
+
+package netstate
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// sysClassNet is the directory that contains the per-interface statistics,
+// it is a variable so that it can be overridden by tests.
+var sysClassNet = "/sys/class/net"
+
+// interfaceStats returns the rx and tx counters of the given kind, e.g.
+// "bytes" or "packets", for the named interface.
+func interfaceStats(name, kind string) (rx, tx uint64, err error) {
+	if rx, err = readStat(name, "rx_"+kind); err != nil {
+		return 0, 0, err
+	}
+	if tx, err = readStat(name, "tx_"+kind); err != nil {
+		return 0, 0, err
+	}
+	return rx, tx, nil
+}
+
+func readStat(name, stat string) (uint64, error) {
+	buf, err := os.ReadFile(filepath.Join(sysClassNet, name, "statistics", stat))
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(buf)), 10, 64)
+}
@@ -0,0 +1,54 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build linux
+// +build linux
+
+package netstate
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	defer func(dir string) { sysClassNet = dir }(sysClassNet)
+	sysClassNet = t.TempDir()
+	dir := filepath.Join(sysClassNet, "eth0", "statistics")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for stat, value := range map[string]string{
+		"rx_bytes":   "1234\n",
+		"tx_bytes":   "18446744073709551615\n",
+		"rx_packets": "12\n",
+		"tx_packets": "34\n",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, stat), []byte(value), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var ifc NetworkInterface = &ipifc{name: "eth0"}
+	statser, ok := ifc.(InterfaceStatser)
+	if !ok {
+		t.Fatalf("%T doesn't implement InterfaceStatser", ifc)
+	}
+	rx, tx, err := statser.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := rx, uint64(1234); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := tx, uint64(18446744073709551615); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if rx, tx, err = statser.PacketStats(); err != nil || rx != 12 || tx != 34 {
+		t.Errorf("got %v, %v, %v, want 12, 34, nil", rx, tx, err)
+	}
+	if _, _, err := (&ipifc{name: "eth1"}).Stats(); err == nil {
+		t.Errorf("expected an error for an unknown interface")
+	}
+}
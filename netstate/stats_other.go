@@ -0,0 +1,12 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !linux
+// +build !linux
+
+package netstate
+
+func interfaceStats(name, kind string) (rx, tx uint64, err error) {
+	return 0, 0, ErrStatsNotSupported
+}
@@ -7,6 +7,7 @@ package netstate
 import (
 	"net"
 
+	"v.io/x/lib/netconfig"
 	"v.io/x/lib/netconfig/route"
 )
 
@@ -65,6 +66,14 @@ func SetRoutes(ifc NetworkInterface, rt ...route.IPRoute) {
 	ii.ipRoutes = rt
 }
 
+func SetIPv6Flags(ifc NetworkInterface, ip string, flags netconfig.AddressFlags) {
+	ii := ifc.(*ipifc)
+	if ii.ipv6Flags == nil {
+		ii.ipv6Flags = map[string]netconfig.AddressFlags{}
+	}
+	ii.ipv6Flags[ip] = flags
+}
+
 func CreateAndUseMockCache(ifcs []NetworkInterface, routetable RouteTable) func() {
 	prev := internalCache
 	internalCache = &netstateCache{
@@ -78,3 +87,17 @@ func CreateAndUseMockCache(ifcs []NetworkInterface, routetable RouteTable) func(
 		InvalidateCache()
 	}
 }
+
+// ChangeMockCache replaces the interfaces and routes of the cache installed by
+// CreateAndUseMockCache, and notifies its watchers of the change.
+func ChangeMockCache(ifcs []NetworkInterface, routetable RouteTable) {
+	cache := internalCache
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if cache.current {
+		close(cache.valid)
+	}
+	cache.current = true
+	cache.interfaces, cache.routes = ifcs, routetable
+	cache.valid = make(chan struct{})
+}
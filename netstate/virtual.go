@@ -0,0 +1,39 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netstate
+
+import (
+	"net"
+	"path"
+)
+
+// VirtualInterfacePatterns lists the patterns, as per path.Match, of the names
+// of network interfaces that IsVirtualInterface considers to be virtual, e.g.
+// container bridges and tunnels.  Sites may append their own patterns.
+var VirtualInterfacePatterns = []string{
+	"lo", "lo[0-9]*", // loopback
+	"docker*", "br-*", "veth*", "cni*", "flannel*", "cali*", "weave*", // containers
+	"virbr*", "vmnet*", "vboxnet*", // virtual machines
+	"tun*", "tap*", "utun*", "wg*", "zt*", "gif*", "stf*", "ipsec*", // tunnels
+	"bridge*", "awdl*", "llw*", "anpi*", // macOS
+}
+
+// IsVirtualInterface returns true if the interface appears to be a virtual
+// device, such as a loopback, container bridge or tunnel, rather than a
+// physical NIC.  It is a heuristic based on the interface's flags and on
+// matching its name against VirtualInterfacePatterns.  Callers may use it to
+// prefer physical interfaces when selecting addresses to advertise.
+func IsVirtualInterface(ifc NetworkInterface) bool {
+	if ifc.Flags()&(net.FlagLoopback|net.FlagPointToPoint) != 0 {
+		return true
+	}
+	name := ifc.Name()
+	for _, pattern := range VirtualInterfacePatterns {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
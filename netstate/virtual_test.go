@@ -0,0 +1,51 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netstate
+
+import (
+	"net"
+	"testing"
+)
+
+func TestIsVirtualInterface(t *testing.T) {
+	tests := []struct {
+		name  string
+		flags net.Flags
+		want  bool
+	}{
+		{"eth0", net.FlagUp | net.FlagBroadcast, false},
+		{"en0", net.FlagUp | net.FlagBroadcast, false},
+		{"wlp3s0", net.FlagUp, false},
+		{"eth0.100", net.FlagUp, false},
+		{"lo", net.FlagUp, true},
+		{"lo0", net.FlagUp, true},
+		{"local", net.FlagUp, false},
+		{"docker0", net.FlagUp, true},
+		{"br-3f2a1b", net.FlagUp, true},
+		{"veth12ab34", net.FlagUp, true},
+		{"virbr0", net.FlagUp, true},
+		{"tun0", net.FlagUp, true},
+		{"tap1", net.FlagUp, true},
+		{"utun3", net.FlagUp, true},
+		{"myloop", net.FlagUp | net.FlagLoopback, true},
+		{"ppp0", net.FlagUp | net.FlagPointToPoint, true},
+	}
+	for _, test := range tests {
+		ifc := &ipifc{name: test.name, flags: test.flags}
+		if got := IsVirtualInterface(ifc); got != test.want {
+			t.Errorf("%s (%v): got %v, want %v", test.name, test.flags, got, test.want)
+		}
+	}
+
+	defer func(orig []string) { VirtualInterfacePatterns = orig }(VirtualInterfacePatterns)
+	ifc := &ipifc{name: "podman0"}
+	if IsVirtualInterface(ifc) {
+		t.Errorf("%s: got true before extending VirtualInterfacePatterns", ifc.name)
+	}
+	VirtualInterfacePatterns = append(VirtualInterfacePatterns, "podman*")
+	if !IsVirtualInterface(ifc) {
+		t.Errorf("%s: got false after extending VirtualInterfacePatterns", ifc.name)
+	}
+}
@@ -0,0 +1,154 @@
+// Copyright 2016 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nsync
+
+import (
+	"time"
+)
+
+// A Map is a map from keys to values that is safe for concurrent use, built on
+// Mu and CV.  In addition to the usual Load, Store and Delete operations, it
+// offers LoadOrStoreWithDeadline(), which computes the value for a missing key
+// at most once at a time: while one thread computes the value for a key, other
+// threads requesting the same key block until the value is available, or until
+// their deadline expires or they are cancelled.  Threads operating on other
+// keys are not blocked by the computation, and the waiters for a key are woken
+// only by changes to that key.
+//
+// A zero-valued Map is a valid, empty Map.
+type Map struct {
+	mu      Mu                        // protects entries, and the mapEntry fields
+	entries map[interface{}]*mapEntry // keys are added lazily
+}
+
+// A mapEntry holds the value for a single key in a Map.  An entry is replaced,
+// rather than modified, by Store() and Delete(), so that a computation that
+// completes after its entry was replaced does not overwrite the newer value.
+type mapEntry struct {
+	value     interface{}
+	computing bool // value is being computed by a call to LoadOrStoreWithDeadline()
+	done      CV   // broadcast when the computation completes, or the entry is replaced
+	waits     int  // number of times a thread has waited on done; for tests
+}
+
+// wake() wakes the threads waiting for the value of e to be computed, if any.
+// e may be nil.  Requires that the Map's mu be held.
+func (e *mapEntry) wake() {
+	if e != nil && e.computing {
+		e.done.Broadcast()
+	}
+}
+
+// Load() returns the value stored in *m for key, and whether the key was
+// present.  A key whose value is still being computed is considered absent.
+func (m *Map) Load(key interface{}) (value interface{}, ok bool) {
+	m.mu.Lock()
+	if e := m.entries[key]; e != nil && !e.computing {
+		value, ok = e.value, true
+	}
+	m.mu.Unlock()
+	return value, ok
+}
+
+// Store() sets the value for key in *m to value.  Threads waiting in
+// LoadOrStoreWithDeadline() for the same key are woken and return value.
+func (m *Map) Store(key interface{}, value interface{}) {
+	m.mu.Lock()
+	if m.entries == nil {
+		m.entries = make(map[interface{}]*mapEntry)
+	}
+	old := m.entries[key]
+	m.entries[key] = &mapEntry{value: value}
+	old.wake()
+	m.mu.Unlock()
+}
+
+// Delete() removes key from *m.  If the value for key is being computed, the
+// result of the computation is discarded.
+func (m *Map) Delete(key interface{}) {
+	m.mu.Lock()
+	if e, ok := m.entries[key]; ok {
+		delete(m.entries, key)
+		e.wake()
+	}
+	m.mu.Unlock()
+}
+
+// Len() returns the number of keys in *m whose values are not being computed.
+func (m *Map) Len() (n int) {
+	m.mu.Lock()
+	for _, e := range m.entries {
+		if !e.computing {
+			n++
+		}
+	}
+	m.mu.Unlock()
+	return n
+}
+
+// LoadOrStoreWithDeadline() returns the value stored in *m for key, with
+// loaded==true and outcome==OK, if present.  Otherwise, if no other thread is
+// computing the value for key, it calls compute() without holding any lock,
+// stores the result, and returns it with loaded==false and outcome==OK.  If
+// another thread is computing the value for key, LoadOrStoreWithDeadline()
+// blocks until that computation completes, the time reaches absDeadline, or
+// cancelChan is closed; in the latter two cases it returns a nil value and
+// outcome Expired or Cancelled respectively.  Use absDeadline==nsync.NoDeadline
+// for no deadline, and cancelChan==nil for no cancellation.  The deadline does
+// not limit the time taken by this thread's own call to compute().
+//
+// If compute() panics, the key is left absent, and a thread waiting for the
+// key may start its own computation.
+func (m *Map) LoadOrStoreWithDeadline(key interface{}, compute func() interface{},
+	absDeadline time.Time, cancelChan <-chan struct{}) (value interface{}, loaded bool, outcome int) {
+	m.mu.Lock()
+	if m.entries == nil {
+		m.entries = make(map[interface{}]*mapEntry)
+	}
+	var e *mapEntry
+	for outcome = OK; ; {
+		if e = m.entries[key]; e == nil || !e.computing || outcome != OK {
+			break
+		}
+		// Wait on the entry being computed, so that only changes to key wake us.
+		e.waits++
+		outcome = e.done.WaitWithDeadline(&m.mu, absDeadline, cancelChan)
+	}
+	switch {
+	case e != nil && !e.computing:
+		value, loaded, outcome = e.value, true, OK
+		m.mu.Unlock()
+	case e != nil: // Expired or Cancelled while another thread computes the value.
+		m.mu.Unlock()
+	default:
+		e = &mapEntry{computing: true}
+		m.entries[key] = e
+		m.mu.Unlock()
+		value, outcome = m.compute(key, e, compute), OK
+	}
+	return value, loaded, outcome
+}
+
+// compute() calls f() to compute the value for key, and stores the result in
+// entry e of *m, unless e was replaced in the meantime.  Waiters are woken
+// even if f() panics.
+func (m *Map) compute(key interface{}, e *mapEntry, f func() interface{}) (value interface{}) {
+	completed := false
+	defer func() {
+		m.mu.Lock()
+		if m.entries[key] == e {
+			if completed {
+				e.value, e.computing = value, false
+			} else {
+				delete(m.entries, key)
+			}
+		}
+		e.done.Broadcast()
+		m.mu.Unlock()
+	}()
+	value = f()
+	completed = true
+	return value
+}
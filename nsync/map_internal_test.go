@@ -0,0 +1,55 @@
+// Copyright 2016 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nsync
+
+import (
+	"testing"
+	"time"
+)
+
+// waits() returns the number of times threads have waited for the value of key
+// in *m to be computed, or -1 if key is absent.
+func (m *Map) waits(key interface{}) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if e := m.entries[key]; e != nil {
+		return e.waits
+	}
+	return -1
+}
+
+// TestMapWakesOnlyKeyWaiters() checks that changes to one key don't wake the
+// threads waiting for the value of another key to be computed.
+func TestMapWakesOnlyKeyWaiters(t *testing.T) {
+	var m Map
+	started := make(chan struct{})
+	release := make(chan struct{})
+	go m.LoadOrStoreWithDeadline("b", func() interface{} {
+		close(started)
+		<-release
+		return "b"
+	}, NoDeadline, nil)
+	<-started
+	result := make(chan interface{})
+	go func() {
+		v, _, _ := m.LoadOrStoreWithDeadline("b", func() interface{} { return "unused" }, NoDeadline, nil)
+		result <- v
+	}()
+	for m.waits("b") != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	// Store, Delete, and a completed computation on key "a".
+	m.Store("a", 1)
+	m.Delete("a")
+	m.LoadOrStoreWithDeadline("a", func() interface{} { return 2 }, NoDeadline, nil)
+	time.Sleep(20 * time.Millisecond)
+	if got, want := m.waits("b"), 1; got != want {
+		t.Errorf("waiter for b waited %d times, want %d", got, want)
+	}
+	close(release)
+	if v := <-result; v != "b" {
+		t.Errorf("waiter for b got %v, want b", v)
+	}
+}
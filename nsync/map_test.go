@@ -0,0 +1,143 @@
+// Copyright 2016 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nsync_test
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"v.io/x/lib/nsync"
+)
+
+// TestMapLoadStoreDelete() checks the basic operations of Map.
+func TestMapLoadStoreDelete(t *testing.T) {
+	var m nsync.Map
+	if v, ok := m.Load("a"); ok || v != nil {
+		t.Errorf("Load on empty map got (%v, %v), want (nil, false)", v, ok)
+	}
+	m.Store("a", 1)
+	m.Store("b", 2)
+	if v, ok := m.Load("a"); !ok || v != 1 {
+		t.Errorf("Load(a) got (%v, %v), want (1, true)", v, ok)
+	}
+	m.Store("a", 3)
+	if v, ok := m.Load("a"); !ok || v != 3 {
+		t.Errorf("Load(a) got (%v, %v), want (3, true)", v, ok)
+	}
+	if got, want := m.Len(), 2; got != want {
+		t.Errorf("Len got %d, want %d", got, want)
+	}
+	m.Delete("a")
+	m.Delete("c")
+	if v, ok := m.Load("a"); ok || v != nil {
+		t.Errorf("Load(a) after Delete got (%v, %v), want (nil, false)", v, ok)
+	}
+	if got, want := m.Len(), 1; got != want {
+		t.Errorf("Len got %d, want %d", got, want)
+	}
+}
+
+// TestMapLoadOrStoreSingleFlight() checks that concurrent calls to
+// LoadOrStoreWithDeadline() for the same key compute the value only once.
+func TestMapLoadOrStoreSingleFlight(t *testing.T) {
+	var m nsync.Map
+	var calls int32
+	release := make(chan struct{})
+	compute := func() interface{} {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return "value"
+	}
+	const n = 10
+	var wg sync.WaitGroup
+	var loadedCount int32
+	for i := 0; i != n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, loaded, outcome := m.LoadOrStoreWithDeadline("k", compute, nsync.NoDeadline, nil)
+			if v != "value" || outcome != nsync.OK {
+				t.Errorf("LoadOrStoreWithDeadline got (%v, %v), want (value, OK)", v, outcome)
+			}
+			if loaded {
+				atomic.AddInt32(&loadedCount, 1)
+			}
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	// Other keys are not blocked by the computation in progress.
+	if v, loaded, _ := m.LoadOrStoreWithDeadline("other", func() interface{} { return 1 }, nsync.NoDeadline, nil); v != 1 || loaded {
+		t.Errorf("LoadOrStoreWithDeadline(other) got (%v, %v), want (1, false)", v, loaded)
+	}
+	close(release)
+	wg.Wait()
+	if got, want := atomic.LoadInt32(&calls), int32(1); got != want {
+		t.Errorf("compute called %d times, want %d", got, want)
+	}
+	if got, want := atomic.LoadInt32(&loadedCount), int32(n-1); got != want {
+		t.Errorf("got %d loaded results, want %d", got, want)
+	}
+}
+
+// TestMapLoadOrStoreDeadline() checks that waiters for a value being computed
+// give up on expiry and cancellation, and that a Store() wakes them.
+func TestMapLoadOrStoreDeadline(t *testing.T) {
+	var m nsync.Map
+	started := make(chan struct{})
+	release := make(chan struct{})
+	go m.LoadOrStoreWithDeadline("k", func() interface{} {
+		close(started)
+		<-release
+		return "computed"
+	}, nsync.NoDeadline, nil)
+	<-started
+	unused := func() interface{} {
+		t.Errorf("compute called while another computation is in progress")
+		return nil
+	}
+	if v, _, outcome := m.LoadOrStoreWithDeadline("k", unused, time.Now().Add(10*time.Millisecond), nil); v != nil || outcome != nsync.Expired {
+		t.Errorf("LoadOrStoreWithDeadline got (%v, %v), want (nil, Expired)", v, outcome)
+	}
+	cancel := make(chan struct{})
+	close(cancel)
+	if v, _, outcome := m.LoadOrStoreWithDeadline("k", unused, nsync.NoDeadline, cancel); v != nil || outcome != nsync.Cancelled {
+		t.Errorf("LoadOrStoreWithDeadline got (%v, %v), want (nil, Cancelled)", v, outcome)
+	}
+	if _, ok := m.Load("k"); ok {
+		t.Errorf("Load of key being computed got ok, want !ok")
+	}
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		m.Store("k", "stored")
+	}()
+	if v, loaded, outcome := m.LoadOrStoreWithDeadline("k", unused, nsync.NoDeadline, nil); v != "stored" || !loaded || outcome != nsync.OK {
+		t.Errorf("LoadOrStoreWithDeadline got (%v, %v, %v), want (stored, true, OK)", v, loaded, outcome)
+	}
+	// The computation completing after Store() does not overwrite the value.
+	close(release)
+	time.Sleep(10 * time.Millisecond)
+	if v, _ := m.Load("k"); v != "stored" {
+		t.Errorf("Load got %v, want stored", v)
+	}
+}
+
+// TestMapLoadOrStorePanic() checks that a panicking computation leaves the key
+// absent.
+func TestMapLoadOrStorePanic(t *testing.T) {
+	var m nsync.Map
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("expected panic")
+			}
+		}()
+		m.LoadOrStoreWithDeadline("k", func() interface{} { panic("boom") }, nsync.NoDeadline, nil)
+	}()
+	if v, loaded, _ := m.LoadOrStoreWithDeadline("k", func() interface{} { return 1 }, nsync.NoDeadline, nil); v != 1 || loaded {
+		t.Errorf("LoadOrStoreWithDeadline got (%v, %v), want (1, false)", v, loaded)
+	}
+}
@@ -29,6 +29,14 @@ func TestComplex128Bool(t *testing.T) {
 		t.Errorf("got %v, want %v", got, want)
 	}
 
+	// Test that conversion from a slice drops duplicates.
+	{
+		s1 := Complex128Bool.FromSlice([]complex128{slice[0], slice[1], slice[0], slice[1]})
+		if got, want := len(s1), len(slice); got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	}
+
 	// Test conversion to a slice.
 	slice2 := Complex128Bool.ToSlice(s1)
 	for i, got := range []bool{true, true} {
@@ -40,6 +48,30 @@ func TestComplex128Bool(t *testing.T) {
 		t.Errorf("got %v, want %v", got, want)
 	}
 
+	// Test cloning.
+	{
+		if got := Complex128Bool.Clone(nil); got != nil {
+			t.Errorf("got %v, want nil", got)
+		}
+		if got := Complex128Bool.Clone(map[complex128]bool{}); got == nil || len(got) != 0 {
+			t.Errorf("got %v, want an empty set", got)
+		}
+		s1 := Complex128Bool.FromSlice(slice)
+		s2 := Complex128Bool.Clone(s1)
+		if !Complex128Bool.Equal(s1, s2) {
+			t.Errorf("got %v, want %v", s2, s1)
+		}
+		// The clone is independent of the original.
+		delete(s2, slice[0])
+		if got, want := len(s1), 2; got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+		delete(s1, slice[1])
+		if _, ok := s2[slice[1]]; !ok {
+			t.Errorf("index 1: got %v, want %v", ok, true)
+		}
+	}
+
 	// Test set difference.
 	{
 		s1 := Complex128Bool.FromSlice(slice)
@@ -192,4 +224,167 @@ func TestComplex128Bool(t *testing.T) {
 			t.Errorf("got %v, want %v", got, want)
 		}
 	}
+
+	// Test set symmetric difference.
+	{
+		s1 := Complex128Bool.FromSlice(slice)
+		s2 := Complex128Bool.FromSlice(slice[1:])
+		Complex128Bool.SymmetricDifference(s1, s2)
+		for i, want := range []bool{true, false} {
+			if _, got := s1[(slice[i])]; got != want {
+				t.Errorf("index %d: got %v, want %v", i, got, want)
+			}
+		}
+		if got, want := len(s1), 1; got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+
+		s3 := Complex128Bool.FromSlice(slice[:1])
+		s4 := Complex128Bool.FromSlice(slice[1:])
+		Complex128Bool.SymmetricDifference(s3, s4)
+		for i, want := range []bool{true, true} {
+			if _, got := s3[(slice[i])]; got != want {
+				t.Errorf("index %d: got %v, want %v", i, got, want)
+			}
+		}
+		if got, want := len(s3), 2; got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+		if got, want := len(s4), 1; got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+
+		s5 := Complex128Bool.FromSlice(slice)
+		s6 := Complex128Bool.FromSlice(slice)
+		Complex128Bool.SymmetricDifference(s5, s6)
+		if got, want := len(s5), 0; got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+
+		s7 := Complex128Bool.FromSlice(slice)
+		Complex128Bool.SymmetricDifference(s7, s7)
+		if got, want := len(s7), 0; got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	}
+
+	// Test set equality and subsets.
+	{
+		s1 := Complex128Bool.FromSlice(slice)
+		s2 := Complex128Bool.FromSlice(slice[1:])
+		s3 := Complex128Bool.FromSlice([]complex128{slice[1], slice[0]})
+		s4 := Complex128Bool.FromSlice(slice[:1])
+		empty := map[complex128]bool{}
+		for _, test := range []struct {
+			s1, s2          map[complex128]bool
+			equal, isSubset bool
+		}{
+			{s1, s1, true, true},
+			{s1, s3, true, true},
+			{s2, s1, false, true},
+			{s1, s2, false, false},
+			{s2, s4, false, false},
+			{nil, empty, true, true},
+			{nil, nil, true, true},
+			{nil, s1, false, true},
+			{empty, s1, false, true},
+			{s1, nil, false, false},
+		} {
+			if got, want := Complex128Bool.Equal(test.s1, test.s2), test.equal; got != want {
+				t.Errorf("Equal(%v, %v): got %v, want %v", test.s1, test.s2, got, want)
+			}
+			if got, want := Complex128Bool.IsSubset(test.s1, test.s2), test.isSubset; got != want {
+				t.Errorf("IsSubset(%v, %v): got %v, want %v", test.s1, test.s2, got, want)
+			}
+		}
+	}
+
+	// Test the non-destructive set operations.
+	{
+		s1 := Complex128Bool.FromSlice(slice)
+		s2 := Complex128Bool.FromSlice(slice[1:])
+		for _, test := range []struct {
+			name string
+			got  map[complex128]bool
+			want []bool
+		}{
+			{"NewDifference", Complex128Bool.NewDifference(s1, s2), []bool{true, false}},
+			{"NewIntersection", Complex128Bool.NewIntersection(s1, s2), []bool{false, true}},
+			{"NewUnion", Complex128Bool.NewUnion(s1, s2), []bool{true, true}},
+		} {
+			n := 0
+			for i, want := range test.want {
+				if _, got := test.got[(slice[i])]; got != want {
+					t.Errorf("%s: index %d: got %v, want %v", test.name, i, got, want)
+				}
+				if want {
+					n++
+				}
+			}
+			if got, want := len(test.got), n; got != want {
+				t.Errorf("%s: got %v, want %v", test.name, got, want)
+			}
+		}
+		// The inputs are not modified, and the results are independent of them.
+		if got, want := len(s1), 2; got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+		if got, want := len(s2), 1; got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+		s3 := Complex128Bool.NewUnion(s2, nil)
+		delete(s3, slice[1])
+		if got, want := len(s2), 1; got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+		if got, want := len(Complex128Bool.NewDifference(nil, s1)), 0; got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	}
+
+	// Test the union of many sets.
+	{
+		if got := Complex128Bool.UnionAll(); got != nil {
+			t.Errorf("got %v, want nil", got)
+		}
+		if got := Complex128Bool.UnionAll(nil, map[complex128]bool{}); got != nil {
+			t.Errorf("got %v, want nil", got)
+		}
+		s1 := Complex128Bool.FromSlice(slice[:1])
+		s2 := Complex128Bool.FromSlice(slice)
+		s3 := Complex128Bool.FromSlice(slice[1:])
+		for _, test := range []struct {
+			sets []map[complex128]bool
+			want []bool
+		}{
+			{[]map[complex128]bool{s1}, []bool{true, false}},
+			{[]map[complex128]bool{s1, s3}, []bool{true, true}},
+			{[]map[complex128]bool{s1, nil, s2, s3}, []bool{true, true}},
+		} {
+			got := Complex128Bool.UnionAll(test.sets...)
+			n := 0
+			for i, want := range test.want {
+				if _, got := got[(slice[i])]; got != want {
+					t.Errorf("index %d: got %v, want %v", i, got, want)
+				}
+				if want {
+					n++
+				}
+			}
+			if got, want := len(got), n; got != want {
+				t.Errorf("got %v, want %v", got, want)
+			}
+		}
+		// The inputs are not modified, and the result is independent of them.
+		delete(Complex128Bool.UnionAll(s1), slice[0])
+		if got, want := len(s1), 1; got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+		if got, want := len(s2), 2; got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+		if got, want := len(s3), 1; got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	}
 }
@@ -11,11 +11,25 @@
 // variable, the package provides:
 //
 //  1. methods for conversion between sets represented as maps and
-//     slices: FromSlice(slice) and ToSlice(set)
+//     slices: FromSlice(slice) and ToSlice(set); for ordered (i.e.
+//     non-complex) types, ToSortedSlice(set) returns the elements
+//     sorted in ascending order; Clone(set) returns a copy of a set
 //
 //  2. methods for common set operations: Difference(s1, s2),
-//     Intersection(s1, s2), and Union(s1, s2); note that these
-//     functions store their result in the first argument
+//     Intersection(s1, s2), Union(s1, s2), and
+//     SymmetricDifference(s1, s2); note that these functions store
+//     their result in the first argument, whereas NewDifference(s1, s2),
+//     NewIntersection(s1, s2), NewUnion(s1, s2), and UnionAll(sets...)
+//     return a new set, leaving their arguments unmodified
+//
+//  3. predicates for comparing sets: Equal(s1, s2) and
+//     IsSubset(s1, s2), which treat a nil set like an empty set
+//
+// In addition, the generic functions FromMapKeys(m) and
+// FromMapValues(m) build a map[foo]struct{} set from the keys or
+// values of a map of any type, and the generic type Set[T] provides
+// FromSlice, ToSlice, Difference, Intersection, and Union for sets of
+// any comparable type T represented as map[T]struct{}.
 //
 // For instance, one can use these functions as follows:
 //
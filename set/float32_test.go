@@ -29,6 +29,14 @@ func TestFloat32(t *testing.T) {
 		t.Errorf("got %v, want %v", got, want)
 	}
 
+	// Test that conversion from a slice drops duplicates.
+	{
+		s1 := Float32.FromSlice([]float32{slice[0], slice[1], slice[0], slice[1]})
+		if got, want := len(s1), len(slice); got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	}
+
 	// Test conversion to a slice.
 	slice2 := Float32.ToSlice(s1)
 	for i, got := range []bool{true, true} {
@@ -40,6 +48,44 @@ func TestFloat32(t *testing.T) {
 		t.Errorf("got %v, want %v", got, want)
 	}
 
+	// Test conversion to a sorted slice.
+	{
+		s1 := Float32.FromSlice([]float32{slice[1], slice[0], slice[1]})
+		sorted := Float32.ToSortedSlice(s1)
+		if got, want := len(sorted), len(slice); got != want {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+		for i := range sorted {
+			if got, want := sorted[i], slice[i]; got != want {
+				t.Errorf("index %d: got %v, want %v", i, got, want)
+			}
+		}
+	}
+
+	// Test cloning.
+	{
+		if got := Float32.Clone(nil); got != nil {
+			t.Errorf("got %v, want nil", got)
+		}
+		if got := Float32.Clone(map[float32]struct{}{}); got == nil || len(got) != 0 {
+			t.Errorf("got %v, want an empty set", got)
+		}
+		s1 := Float32.FromSlice(slice)
+		s2 := Float32.Clone(s1)
+		if !Float32.Equal(s1, s2) {
+			t.Errorf("got %v, want %v", s2, s1)
+		}
+		// The clone is independent of the original.
+		delete(s2, slice[0])
+		if got, want := len(s1), 2; got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+		delete(s1, slice[1])
+		if _, ok := s2[slice[1]]; !ok {
+			t.Errorf("index 1: got %v, want %v", ok, true)
+		}
+	}
+
 	// Test set difference.
 	{
 		s1 := Float32.FromSlice(slice)
@@ -192,4 +238,167 @@ func TestFloat32(t *testing.T) {
 			t.Errorf("got %v, want %v", got, want)
 		}
 	}
+
+	// Test set symmetric difference.
+	{
+		s1 := Float32.FromSlice(slice)
+		s2 := Float32.FromSlice(slice[1:])
+		Float32.SymmetricDifference(s1, s2)
+		for i, want := range []bool{true, false} {
+			if _, got := s1[(slice[i])]; got != want {
+				t.Errorf("index %d: got %v, want %v", i, got, want)
+			}
+		}
+		if got, want := len(s1), 1; got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+
+		s3 := Float32.FromSlice(slice[:1])
+		s4 := Float32.FromSlice(slice[1:])
+		Float32.SymmetricDifference(s3, s4)
+		for i, want := range []bool{true, true} {
+			if _, got := s3[(slice[i])]; got != want {
+				t.Errorf("index %d: got %v, want %v", i, got, want)
+			}
+		}
+		if got, want := len(s3), 2; got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+		if got, want := len(s4), 1; got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+
+		s5 := Float32.FromSlice(slice)
+		s6 := Float32.FromSlice(slice)
+		Float32.SymmetricDifference(s5, s6)
+		if got, want := len(s5), 0; got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+
+		s7 := Float32.FromSlice(slice)
+		Float32.SymmetricDifference(s7, s7)
+		if got, want := len(s7), 0; got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	}
+
+	// Test set equality and subsets.
+	{
+		s1 := Float32.FromSlice(slice)
+		s2 := Float32.FromSlice(slice[1:])
+		s3 := Float32.FromSlice([]float32{slice[1], slice[0]})
+		s4 := Float32.FromSlice(slice[:1])
+		empty := map[float32]struct{}{}
+		for _, test := range []struct {
+			s1, s2          map[float32]struct{}
+			equal, isSubset bool
+		}{
+			{s1, s1, true, true},
+			{s1, s3, true, true},
+			{s2, s1, false, true},
+			{s1, s2, false, false},
+			{s2, s4, false, false},
+			{nil, empty, true, true},
+			{nil, nil, true, true},
+			{nil, s1, false, true},
+			{empty, s1, false, true},
+			{s1, nil, false, false},
+		} {
+			if got, want := Float32.Equal(test.s1, test.s2), test.equal; got != want {
+				t.Errorf("Equal(%v, %v): got %v, want %v", test.s1, test.s2, got, want)
+			}
+			if got, want := Float32.IsSubset(test.s1, test.s2), test.isSubset; got != want {
+				t.Errorf("IsSubset(%v, %v): got %v, want %v", test.s1, test.s2, got, want)
+			}
+		}
+	}
+
+	// Test the non-destructive set operations.
+	{
+		s1 := Float32.FromSlice(slice)
+		s2 := Float32.FromSlice(slice[1:])
+		for _, test := range []struct {
+			name string
+			got  map[float32]struct{}
+			want []bool
+		}{
+			{"NewDifference", Float32.NewDifference(s1, s2), []bool{true, false}},
+			{"NewIntersection", Float32.NewIntersection(s1, s2), []bool{false, true}},
+			{"NewUnion", Float32.NewUnion(s1, s2), []bool{true, true}},
+		} {
+			n := 0
+			for i, want := range test.want {
+				if _, got := test.got[(slice[i])]; got != want {
+					t.Errorf("%s: index %d: got %v, want %v", test.name, i, got, want)
+				}
+				if want {
+					n++
+				}
+			}
+			if got, want := len(test.got), n; got != want {
+				t.Errorf("%s: got %v, want %v", test.name, got, want)
+			}
+		}
+		// The inputs are not modified, and the results are independent of them.
+		if got, want := len(s1), 2; got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+		if got, want := len(s2), 1; got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+		s3 := Float32.NewUnion(s2, nil)
+		delete(s3, slice[1])
+		if got, want := len(s2), 1; got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+		if got, want := len(Float32.NewDifference(nil, s1)), 0; got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	}
+
+	// Test the union of many sets.
+	{
+		if got := Float32.UnionAll(); got != nil {
+			t.Errorf("got %v, want nil", got)
+		}
+		if got := Float32.UnionAll(nil, map[float32]struct{}{}); got != nil {
+			t.Errorf("got %v, want nil", got)
+		}
+		s1 := Float32.FromSlice(slice[:1])
+		s2 := Float32.FromSlice(slice)
+		s3 := Float32.FromSlice(slice[1:])
+		for _, test := range []struct {
+			sets []map[float32]struct{}
+			want []bool
+		}{
+			{[]map[float32]struct{}{s1}, []bool{true, false}},
+			{[]map[float32]struct{}{s1, s3}, []bool{true, true}},
+			{[]map[float32]struct{}{s1, nil, s2, s3}, []bool{true, true}},
+		} {
+			got := Float32.UnionAll(test.sets...)
+			n := 0
+			for i, want := range test.want {
+				if _, got := got[(slice[i])]; got != want {
+					t.Errorf("index %d: got %v, want %v", i, got, want)
+				}
+				if want {
+					n++
+				}
+			}
+			if got, want := len(got), n; got != want {
+				t.Errorf("got %v, want %v", got, want)
+			}
+		}
+		// The inputs are not modified, and the result is independent of them.
+		delete(Float32.UnionAll(s1), slice[0])
+		if got, want := len(s1), 1; got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+		if got, want := len(s2), 2; got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+		if got, want := len(s3), 1; got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	}
 }
@@ -31,12 +31,17 @@ var implTemplate = template.Must(template.New("impl").Funcs(fns).Parse(`// Copyr
 // DO NOT UPDATE MANUALLY
 
 package set
-
+{{if .Ordered}}
+import (
+	"sort"
+)
+{{end}}
 var {{capitalize .KeyType}}{{capitalize (suffix .ValueType)}} = {{capitalize .KeyType}}{{capitalize (suffix .ValueType)}}T{}
 
 type {{capitalize .KeyType}}{{capitalize (suffix .ValueType)}}T struct{}
 
-// FromSlice transforms the given slice to a set.
+// FromSlice transforms the given slice to a set.  Duplicate elements
+// of the slice appear only once in the result.
 func ({{capitalize .KeyType}}{{capitalize (suffix .ValueType)}}T) FromSlice(els []{{.KeyType}}) map[{{.KeyType}}]{{.ValueType}} {
 	if len(els) == 0 {
 		return nil
@@ -56,6 +61,26 @@ func ({{capitalize .KeyType}}{{capitalize (suffix .ValueType)}}T) ToSlice(s map[
 	}
 	return result
 }
+{{if .Ordered}}
+// ToSortedSlice transforms the given set to a slice, sorted in ascending order.
+func ({{capitalize .KeyType}}{{capitalize (suffix .ValueType)}}T) ToSortedSlice(s map[{{.KeyType}}]{{.ValueType}}) []{{.KeyType}} {
+	result := {{capitalize .KeyType}}{{capitalize (suffix .ValueType)}}.ToSlice(s)
+	sort.Slice(result, func(i, j int) bool { return result[i] < result[j] })
+	return result
+}
+{{end}}
+// Clone returns a new set with the same elements as s, or nil if s is
+// nil.
+func ({{capitalize .KeyType}}{{capitalize (suffix .ValueType)}}T) Clone(s map[{{.KeyType}}]{{.ValueType}}) map[{{.KeyType}}]{{.ValueType}} {
+	if s == nil {
+		return nil
+	}
+	result := make(map[{{.KeyType}}]{{.ValueType}}, len(s))
+	for el := range s {
+		result[el] = {{value .ValueType}}
+	}
+	return result
+}
 
 // Difference subtracts s2 from s1, storing the result in s1.
 func ({{capitalize .KeyType}}{{capitalize (suffix .ValueType)}}T) Difference(s1, s2 map[{{.KeyType}}]{{.ValueType}}) {
@@ -81,6 +106,99 @@ func ({{capitalize .KeyType}}{{capitalize (suffix .ValueType)}}T) Union(s1, s2 m
 		s1[el] = {{value .ValueType}}
 	}
 }
+
+// Equal returns true iff s1 and s2 have the same elements.  A nil set
+// is equal to an empty set.
+func ({{capitalize .KeyType}}{{capitalize (suffix .ValueType)}}T) Equal(s1, s2 map[{{.KeyType}}]{{.ValueType}}) bool {
+	if len(s1) != len(s2) {
+		return false
+	}
+	for el := range s1 {
+		if _, ok := s2[el]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// IsSubset returns true iff every element of s1 is in s2.  A nil set is
+// a subset of every set.
+func ({{capitalize .KeyType}}{{capitalize (suffix .ValueType)}}T) IsSubset(s1, s2 map[{{.KeyType}}]{{.ValueType}}) bool {
+	if len(s1) > len(s2) {
+		return false
+	}
+	for el := range s1 {
+		if _, ok := s2[el]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// NewDifference returns a new set holding the elements of s1 that are not in
+// s2.  Unlike Difference, neither s1 nor s2 is modified.
+func ({{capitalize .KeyType}}{{capitalize (suffix .ValueType)}}T) NewDifference(s1, s2 map[{{.KeyType}}]{{.ValueType}}) map[{{.KeyType}}]{{.ValueType}} {
+	result := map[{{.KeyType}}]{{.ValueType}}{}
+	for el := range s1 {
+		if _, ok := s2[el]; !ok {
+			result[el] = {{value .ValueType}}
+		}
+	}
+	return result
+}
+
+// NewIntersection returns a new set holding the elements that are in both s1
+// and s2.  Unlike Intersection, neither s1 nor s2 is modified.
+func ({{capitalize .KeyType}}{{capitalize (suffix .ValueType)}}T) NewIntersection(s1, s2 map[{{.KeyType}}]{{.ValueType}}) map[{{.KeyType}}]{{.ValueType}} {
+	result := map[{{.KeyType}}]{{.ValueType}}{}
+	for el := range s1 {
+		if _, ok := s2[el]; ok {
+			result[el] = {{value .ValueType}}
+		}
+	}
+	return result
+}
+
+// NewUnion returns a new set holding the elements that are in either s1 or
+// s2.  Unlike Union, neither s1 nor s2 is modified.
+func ({{capitalize .KeyType}}{{capitalize (suffix .ValueType)}}T) NewUnion(s1, s2 map[{{.KeyType}}]{{.ValueType}}) map[{{.KeyType}}]{{.ValueType}} {
+	result := make(map[{{.KeyType}}]{{.ValueType}}, len(s1)+len(s2))
+	for el := range s1 {
+		result[el] = {{value .ValueType}}
+	}
+	for el := range s2 {
+		result[el] = {{value .ValueType}}
+	}
+	return result
+}
+
+// UnionAll returns a new set holding the elements that are in any of the
+// given sets, none of which is modified.  It returns nil if there are no
+// elements, e.g. if no sets are given.
+func ({{capitalize .KeyType}}{{capitalize (suffix .ValueType)}}T) UnionAll(sets ...map[{{.KeyType}}]{{.ValueType}}) map[{{.KeyType}}]{{.ValueType}} {
+	var result map[{{.KeyType}}]{{.ValueType}}
+	for _, s := range sets {
+		for el := range s {
+			if result == nil {
+				result = map[{{.KeyType}}]{{.ValueType}}{}
+			}
+			result[el] = {{value .ValueType}}
+		}
+	}
+	return result
+}
+
+// SymmetricDifference computes the elements that are in exactly one of
+// s1 and s2, storing the result in s1.
+func ({{capitalize .KeyType}}{{capitalize (suffix .ValueType)}}T) SymmetricDifference(s1, s2 map[{{.KeyType}}]{{.ValueType}}) {
+	for el := range s2 {
+		if _, ok := s1[el]; ok {
+			delete(s1, el)
+		} else {
+			s1[el] = {{value .ValueType}}
+		}
+	}
+}
 `))
 
 var implTestTemplate = template.Must(template.New("impl-test").Funcs(fns).Parse(`// Copyright 2015 The Vanadium Authors. All rights reserved.
@@ -113,6 +231,14 @@ func Test{{capitalize .KeyType}}{{capitalize (suffix .ValueType)}}(t *testing.T)
 		t.Errorf("got %v, want %v", got, want)
 	}
 
+	// Test that conversion from a slice drops duplicates.
+	{
+		s1 := {{capitalize .KeyType}}{{capitalize (suffix .ValueType)}}.FromSlice([]{{.KeyType}}{slice[0], slice[1], slice[0], slice[1]})
+		if got, want := len(s1), len(slice); got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	}
+
 	// Test conversion to a slice.
 	slice2 := {{capitalize .KeyType}}{{capitalize (suffix .ValueType)}}.ToSlice(s1)
 	for i, got := range []bool{true, true} {
@@ -123,6 +249,44 @@ func Test{{capitalize .KeyType}}{{capitalize (suffix .ValueType)}}(t *testing.T)
 	if got, want := len(slice2), len(s1); got != want {
 		t.Errorf("got %v, want %v", got, want)
 	}
+{{if .Ordered}}
+	// Test conversion to a sorted slice.
+	{
+		s1 := {{capitalize .KeyType}}{{capitalize (suffix .ValueType)}}.FromSlice([]{{.KeyType}}{slice[1], slice[0], slice[1]})
+		sorted := {{capitalize .KeyType}}{{capitalize (suffix .ValueType)}}.ToSortedSlice(s1)
+		if got, want := len(sorted), len(slice); got != want {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+		for i := range sorted {
+			if got, want := sorted[i], slice[i]; got != want {
+				t.Errorf("index %d: got %v, want %v", i, got, want)
+			}
+		}
+	}
+{{end}}
+	// Test cloning.
+	{
+		if got := {{capitalize .KeyType}}{{capitalize (suffix .ValueType)}}.Clone(nil); got != nil {
+			t.Errorf("got %v, want nil", got)
+		}
+		if got := {{capitalize .KeyType}}{{capitalize (suffix .ValueType)}}.Clone(map[{{.KeyType}}]{{.ValueType}}{}); got == nil || len(got) != 0 {
+			t.Errorf("got %v, want an empty set", got)
+		}
+		s1 := {{capitalize .KeyType}}{{capitalize (suffix .ValueType)}}.FromSlice(slice)
+		s2 := {{capitalize .KeyType}}{{capitalize (suffix .ValueType)}}.Clone(s1)
+		if !{{capitalize .KeyType}}{{capitalize (suffix .ValueType)}}.Equal(s1, s2) {
+			t.Errorf("got %v, want %v", s2, s1)
+		}
+		// The clone is independent of the original.
+		delete(s2, slice[0])
+		if got, want := len(s1), 2; got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+		delete(s1, slice[1])
+		if _, ok := s2[slice[1]]; !ok {
+			t.Errorf("index 1: got %v, want %v", ok, true)
+		}
+	}
 
 	// Test set difference.
 	{
@@ -276,13 +440,177 @@ func Test{{capitalize .KeyType}}{{capitalize (suffix .ValueType)}}(t *testing.T)
 			t.Errorf("got %v, want %v", got, want)
 		}
 	}
+
+	// Test set symmetric difference.
+	{
+		s1 := {{capitalize .KeyType}}{{capitalize (suffix .ValueType)}}.FromSlice(slice)
+		s2 := {{capitalize .KeyType}}{{capitalize (suffix .ValueType)}}.FromSlice(slice[1:])
+		{{capitalize .KeyType}}{{capitalize (suffix .ValueType)}}.SymmetricDifference(s1, s2)
+		for i, want := range []bool{true, false} {
+			if _, got := s1[(slice[i])]; got != want {
+				t.Errorf("index %d: got %v, want %v", i, got, want)
+			}
+		}
+		if got, want := len(s1), 1; got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+
+		s3 := {{capitalize .KeyType}}{{capitalize (suffix .ValueType)}}.FromSlice(slice[:1])
+		s4 := {{capitalize .KeyType}}{{capitalize (suffix .ValueType)}}.FromSlice(slice[1:])
+		{{capitalize .KeyType}}{{capitalize (suffix .ValueType)}}.SymmetricDifference(s3, s4)
+		for i, want := range []bool{true, true} {
+			if _, got := s3[(slice[i])]; got != want {
+				t.Errorf("index %d: got %v, want %v", i, got, want)
+			}
+		}
+		if got, want := len(s3), 2; got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+		if got, want := len(s4), 1; got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+
+		s5 := {{capitalize .KeyType}}{{capitalize (suffix .ValueType)}}.FromSlice(slice)
+		s6 := {{capitalize .KeyType}}{{capitalize (suffix .ValueType)}}.FromSlice(slice)
+		{{capitalize .KeyType}}{{capitalize (suffix .ValueType)}}.SymmetricDifference(s5, s6)
+		if got, want := len(s5), 0; got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+
+		s7 := {{capitalize .KeyType}}{{capitalize (suffix .ValueType)}}.FromSlice(slice)
+		{{capitalize .KeyType}}{{capitalize (suffix .ValueType)}}.SymmetricDifference(s7, s7)
+		if got, want := len(s7), 0; got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	}
+
+	// Test set equality and subsets.
+	{
+		s1 := {{capitalize .KeyType}}{{capitalize (suffix .ValueType)}}.FromSlice(slice)
+		s2 := {{capitalize .KeyType}}{{capitalize (suffix .ValueType)}}.FromSlice(slice[1:])
+		s3 := {{capitalize .KeyType}}{{capitalize (suffix .ValueType)}}.FromSlice([]{{.KeyType}}{slice[1], slice[0]})
+		s4 := {{capitalize .KeyType}}{{capitalize (suffix .ValueType)}}.FromSlice(slice[:1])
+		empty := map[{{.KeyType}}]{{.ValueType}}{}
+		for _, test := range []struct {
+			s1, s2          map[{{.KeyType}}]{{.ValueType}}
+			equal, isSubset bool
+		}{
+			{s1, s1, true, true},
+			{s1, s3, true, true},
+			{s2, s1, false, true},
+			{s1, s2, false, false},
+			{s2, s4, false, false},
+			{nil, empty, true, true},
+			{nil, nil, true, true},
+			{nil, s1, false, true},
+			{empty, s1, false, true},
+			{s1, nil, false, false},
+		} {
+			if got, want := {{capitalize .KeyType}}{{capitalize (suffix .ValueType)}}.Equal(test.s1, test.s2), test.equal; got != want {
+				t.Errorf("Equal(%v, %v): got %v, want %v", test.s1, test.s2, got, want)
+			}
+			if got, want := {{capitalize .KeyType}}{{capitalize (suffix .ValueType)}}.IsSubset(test.s1, test.s2), test.isSubset; got != want {
+				t.Errorf("IsSubset(%v, %v): got %v, want %v", test.s1, test.s2, got, want)
+			}
+		}
+	}
+
+	// Test the non-destructive set operations.
+	{
+		s1 := {{capitalize .KeyType}}{{capitalize (suffix .ValueType)}}.FromSlice(slice)
+		s2 := {{capitalize .KeyType}}{{capitalize (suffix .ValueType)}}.FromSlice(slice[1:])
+		for _, test := range []struct {
+			name string
+			got  map[{{.KeyType}}]{{.ValueType}}
+			want []bool
+		}{
+			{"NewDifference", {{capitalize .KeyType}}{{capitalize (suffix .ValueType)}}.NewDifference(s1, s2), []bool{true, false}},
+			{"NewIntersection", {{capitalize .KeyType}}{{capitalize (suffix .ValueType)}}.NewIntersection(s1, s2), []bool{false, true}},
+			{"NewUnion", {{capitalize .KeyType}}{{capitalize (suffix .ValueType)}}.NewUnion(s1, s2), []bool{true, true}},
+		} {
+			n := 0
+			for i, want := range test.want {
+				if _, got := test.got[(slice[i])]; got != want {
+					t.Errorf("%s: index %d: got %v, want %v", test.name, i, got, want)
+				}
+				if want {
+					n++
+				}
+			}
+			if got, want := len(test.got), n; got != want {
+				t.Errorf("%s: got %v, want %v", test.name, got, want)
+			}
+		}
+		// The inputs are not modified, and the results are independent of them.
+		if got, want := len(s1), 2; got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+		if got, want := len(s2), 1; got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+		s3 := {{capitalize .KeyType}}{{capitalize (suffix .ValueType)}}.NewUnion(s2, nil)
+		delete(s3, slice[1])
+		if got, want := len(s2), 1; got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+		if got, want := len({{capitalize .KeyType}}{{capitalize (suffix .ValueType)}}.NewDifference(nil, s1)), 0; got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	}
+
+	// Test the union of many sets.
+	{
+		if got := {{capitalize .KeyType}}{{capitalize (suffix .ValueType)}}.UnionAll(); got != nil {
+			t.Errorf("got %v, want nil", got)
+		}
+		if got := {{capitalize .KeyType}}{{capitalize (suffix .ValueType)}}.UnionAll(nil, map[{{.KeyType}}]{{.ValueType}}{}); got != nil {
+			t.Errorf("got %v, want nil", got)
+		}
+		s1 := {{capitalize .KeyType}}{{capitalize (suffix .ValueType)}}.FromSlice(slice[:1])
+		s2 := {{capitalize .KeyType}}{{capitalize (suffix .ValueType)}}.FromSlice(slice)
+		s3 := {{capitalize .KeyType}}{{capitalize (suffix .ValueType)}}.FromSlice(slice[1:])
+		for _, test := range []struct {
+			sets []map[{{.KeyType}}]{{.ValueType}}
+			want []bool
+		}{
+			{[]map[{{.KeyType}}]{{.ValueType}}{s1}, []bool{true, false}},
+			{[]map[{{.KeyType}}]{{.ValueType}}{s1, s3}, []bool{true, true}},
+			{[]map[{{.KeyType}}]{{.ValueType}}{s1, nil, s2, s3}, []bool{true, true}},
+		} {
+			got := {{capitalize .KeyType}}{{capitalize (suffix .ValueType)}}.UnionAll(test.sets...)
+			n := 0
+			for i, want := range test.want {
+				if _, got := got[(slice[i])]; got != want {
+					t.Errorf("index %d: got %v, want %v", i, got, want)
+				}
+				if want {
+					n++
+				}
+			}
+			if got, want := len(got), n; got != want {
+				t.Errorf("got %v, want %v", got, want)
+			}
+		}
+		// The inputs are not modified, and the result is independent of them.
+		delete({{capitalize .KeyType}}{{capitalize (suffix .ValueType)}}.UnionAll(s1), slice[0])
+		if got, want := len(s1), 1; got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+		if got, want := len(s2), 2; got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+		if got, want := len(s3), 1; got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	}
 }
 `))
 
 type builtin struct {
 	KeyType   string
 	ValueType string
-	Elements  []string
+	Elements  []string // in ascending order, if Ordered
+	Ordered   bool     // whether KeyType supports the < operator
 }
 
 type generator struct {
@@ -333,58 +661,72 @@ func main() {
 		{
 			KeyType:  "float32",
 			Elements: []string{"-1.0", "1.0"},
+			Ordered:  true,
 		},
 		{
 			KeyType:  "float64",
 			Elements: []string{"-1.0", "1.0"},
+			Ordered:  true,
 		},
 		{
 			KeyType:  "int",
 			Elements: []string{"-1", "1"},
+			Ordered:  true,
 		},
 		{
 			KeyType:  "int8",
 			Elements: []string{"-1", "1"},
+			Ordered:  true,
 		},
 		{
 			KeyType:  "int16",
 			Elements: []string{"-1", "1"},
+			Ordered:  true,
 		},
 		{
 			KeyType:  "int32",
 			Elements: []string{"-1", "1"},
+			Ordered:  true,
 		},
 		{
 			KeyType:  "int64",
 			Elements: []string{"-1", "1"},
+			Ordered:  true,
 		},
 		{
 			KeyType:  "string",
 			Elements: []string{`"a"`, `"b"`},
+			Ordered:  true,
 		},
 		{
 			KeyType:  "uint",
 			Elements: []string{"0", "1"},
+			Ordered:  true,
 		},
 		{
 			KeyType:  "uint8",
 			Elements: []string{"0", "1"},
+			Ordered:  true,
 		},
 		{
 			KeyType:  "uint16",
 			Elements: []string{"0", "1"},
+			Ordered:  true,
 		},
 		{
 			KeyType:  "uint32",
 			Elements: []string{"0", "1"},
+			Ordered:  true,
 		},
 		{
 			KeyType:  "uint64",
 			Elements: []string{"0", "1"},
+			Ordered:  true,
 		},
 		{
 			KeyType:  "uintptr",
 			Elements: []string{"0", "1"},
+			Ordered:  true,
 		},
 	}
 	generators := []generator{
@@ -0,0 +1,68 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.18
+// +build go1.18
+
+package set
+
+// Set implements the same utility functions as the generated
+// per-type variables (e.g. String), but for sets of any comparable
+// element type, including user-defined structs.  Sets are
+// represented as map[T]struct{}, so the result of FromSlice can be
+// used interchangeably with the generated variables and with
+// FromMapKeys/FromMapValues.  The zero value is ready to use:
+//
+//	type point struct{ x, y int }
+//	s1 := set.Set[point]{}.FromSlice([]point{{0, 0}, {1, 1}})
+//	s2 := map[point]struct{}{{1, 1}: {}}
+//	set.Set[point]{}.Difference(s1, s2) // s1 == {{0, 0}}
+type Set[T comparable] struct{}
+
+// FromSlice transforms the given slice to a set.  Duplicate elements
+// of the slice appear only once in the result.
+func (Set[T]) FromSlice(els []T) map[T]struct{} {
+	if len(els) == 0 {
+		return nil
+	}
+	result := map[T]struct{}{}
+	for _, el := range els {
+		result[el] = struct{}{}
+	}
+	return result
+}
+
+// ToSlice transforms the given set to a slice.
+func (Set[T]) ToSlice(s map[T]struct{}) []T {
+	var result []T
+	for el := range s {
+		result = append(result, el)
+	}
+	return result
+}
+
+// Difference subtracts s2 from s1, storing the result in s1.
+func (Set[T]) Difference(s1, s2 map[T]struct{}) {
+	for el := range s1 {
+		if _, ok := s2[el]; ok {
+			delete(s1, el)
+		}
+	}
+}
+
+// Intersection intersects s1 and s2, storing the result in s1.
+func (Set[T]) Intersection(s1, s2 map[T]struct{}) {
+	for el := range s1 {
+		if _, ok := s2[el]; !ok {
+			delete(s1, el)
+		}
+	}
+}
+
+// Union merges s1 and s2, storing the result in s1.
+func (Set[T]) Union(s1, s2 map[T]struct{}) {
+	for el := range s2 {
+		s1[el] = struct{}{}
+	}
+}
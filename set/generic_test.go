@@ -0,0 +1,74 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.18
+// +build go1.18
+
+package set
+
+import (
+	"reflect"
+	"testing"
+)
+
+type point struct {
+	x, y int
+}
+
+// testSet exercises Set[T] using a, b and c, which must be distinct.
+func testSet[T comparable](t *testing.T, a, b, c T) {
+	t.Helper()
+	var s Set[T]
+
+	if got := s.FromSlice(nil); got != nil {
+		t.Errorf("got %v, want nil", got)
+	}
+	s1 := s.FromSlice([]T{a, b, a})
+	if got, want := s1, (map[T]struct{}{a: {}, b: {}}); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := s.FromSlice(s.ToSlice(s1)), s1; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// Plain maps may be passed directly.
+	bc := map[T]struct{}{b: {}, c: {}}
+
+	s1 = s.FromSlice([]T{a, b})
+	s.Difference(s1, bc)
+	if got, want := s1, (map[T]struct{}{a: {}}); !reflect.DeepEqual(got, want) {
+		t.Errorf("Difference: got %v, want %v", got, want)
+	}
+
+	s1 = s.FromSlice([]T{a, b})
+	s.Intersection(s1, bc)
+	if got, want := s1, (map[T]struct{}{b: {}}); !reflect.DeepEqual(got, want) {
+		t.Errorf("Intersection: got %v, want %v", got, want)
+	}
+
+	s1 = s.FromSlice([]T{a, b})
+	s.Union(s1, bc)
+	if got, want := s1, (map[T]struct{}{a: {}, b: {}, c: {}}); !reflect.DeepEqual(got, want) {
+		t.Errorf("Union: got %v, want %v", got, want)
+	}
+	// The second argument is never modified.
+	if got, want := len(bc), 2; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestSet(t *testing.T) {
+	testSet(t, "a", "b", "c")
+	testSet(t, 1, 2, 3)
+	testSet(t, point{0, 0}, point{0, 1}, point{1, 0})
+}
+
+func TestSetInterop(t *testing.T) {
+	s1 := Set[string]{}.FromSlice([]string{"a", "b"})
+	String.Difference(s1, FromMapKeys(map[string]int{"b": 1}))
+	var s Set[string]
+	if got, want := s.ToSlice(s1), []string{"a"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
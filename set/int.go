@@ -7,11 +7,16 @@
 
 package set
 
+import (
+	"sort"
+)
+
 var Int = IntT{}
 
 type IntT struct{}
 
-// FromSlice transforms the given slice to a set.
+// FromSlice transforms the given slice to a set.  Duplicate elements
+// of the slice appear only once in the result.
 func (IntT) FromSlice(els []int) map[int]struct{} {
 	if len(els) == 0 {
 		return nil
@@ -32,6 +37,26 @@ func (IntT) ToSlice(s map[int]struct{}) []int {
 	return result
 }
 
+// ToSortedSlice transforms the given set to a slice, sorted in ascending order.
+func (IntT) ToSortedSlice(s map[int]struct{}) []int {
+	result := Int.ToSlice(s)
+	sort.Slice(result, func(i, j int) bool { return result[i] < result[j] })
+	return result
+}
+
+// Clone returns a new set with the same elements as s, or nil if s is
+// nil.
+func (IntT) Clone(s map[int]struct{}) map[int]struct{} {
+	if s == nil {
+		return nil
+	}
+	result := make(map[int]struct{}, len(s))
+	for el := range s {
+		result[el] = struct{}{}
+	}
+	return result
+}
+
 // Difference subtracts s2 from s1, storing the result in s1.
 func (IntT) Difference(s1, s2 map[int]struct{}) {
 	for el := range s1 {
@@ -56,3 +81,96 @@ func (IntT) Union(s1, s2 map[int]struct{}) {
 		s1[el] = struct{}{}
 	}
 }
+
+// Equal returns true iff s1 and s2 have the same elements.  A nil set
+// is equal to an empty set.
+func (IntT) Equal(s1, s2 map[int]struct{}) bool {
+	if len(s1) != len(s2) {
+		return false
+	}
+	for el := range s1 {
+		if _, ok := s2[el]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// IsSubset returns true iff every element of s1 is in s2.  A nil set is
+// a subset of every set.
+func (IntT) IsSubset(s1, s2 map[int]struct{}) bool {
+	if len(s1) > len(s2) {
+		return false
+	}
+	for el := range s1 {
+		if _, ok := s2[el]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// NewDifference returns a new set holding the elements of s1 that are not in
+// s2.  Unlike Difference, neither s1 nor s2 is modified.
+func (IntT) NewDifference(s1, s2 map[int]struct{}) map[int]struct{} {
+	result := map[int]struct{}{}
+	for el := range s1 {
+		if _, ok := s2[el]; !ok {
+			result[el] = struct{}{}
+		}
+	}
+	return result
+}
+
+// NewIntersection returns a new set holding the elements that are in both s1
+// and s2.  Unlike Intersection, neither s1 nor s2 is modified.
+func (IntT) NewIntersection(s1, s2 map[int]struct{}) map[int]struct{} {
+	result := map[int]struct{}{}
+	for el := range s1 {
+		if _, ok := s2[el]; ok {
+			result[el] = struct{}{}
+		}
+	}
+	return result
+}
+
+// NewUnion returns a new set holding the elements that are in either s1 or
+// s2.  Unlike Union, neither s1 nor s2 is modified.
+func (IntT) NewUnion(s1, s2 map[int]struct{}) map[int]struct{} {
+	result := make(map[int]struct{}, len(s1)+len(s2))
+	for el := range s1 {
+		result[el] = struct{}{}
+	}
+	for el := range s2 {
+		result[el] = struct{}{}
+	}
+	return result
+}
+
+// UnionAll returns a new set holding the elements that are in any of the
+// given sets, none of which is modified.  It returns nil if there are no
+// elements, e.g. if no sets are given.
+func (IntT) UnionAll(sets ...map[int]struct{}) map[int]struct{} {
+	var result map[int]struct{}
+	for _, s := range sets {
+		for el := range s {
+			if result == nil {
+				result = map[int]struct{}{}
+			}
+			result[el] = struct{}{}
+		}
+	}
+	return result
+}
+
+// SymmetricDifference computes the elements that are in exactly one of
+// s1 and s2, storing the result in s1.
+func (IntT) SymmetricDifference(s1, s2 map[int]struct{}) {
+	for el := range s2 {
+		if _, ok := s1[el]; ok {
+			delete(s1, el)
+		} else {
+			s1[el] = struct{}{}
+		}
+	}
+}
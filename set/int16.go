@@ -7,11 +7,16 @@
 
 package set
 
+import (
+	"sort"
+)
+
 var Int16 = Int16T{}
 
 type Int16T struct{}
 
-// FromSlice transforms the given slice to a set.
+// FromSlice transforms the given slice to a set.  Duplicate elements
+// of the slice appear only once in the result.
 func (Int16T) FromSlice(els []int16) map[int16]struct{} {
 	if len(els) == 0 {
 		return nil
@@ -32,6 +37,26 @@ func (Int16T) ToSlice(s map[int16]struct{}) []int16 {
 	return result
 }
 
+// ToSortedSlice transforms the given set to a slice, sorted in ascending order.
+func (Int16T) ToSortedSlice(s map[int16]struct{}) []int16 {
+	result := Int16.ToSlice(s)
+	sort.Slice(result, func(i, j int) bool { return result[i] < result[j] })
+	return result
+}
+
+// Clone returns a new set with the same elements as s, or nil if s is
+// nil.
+func (Int16T) Clone(s map[int16]struct{}) map[int16]struct{} {
+	if s == nil {
+		return nil
+	}
+	result := make(map[int16]struct{}, len(s))
+	for el := range s {
+		result[el] = struct{}{}
+	}
+	return result
+}
+
 // Difference subtracts s2 from s1, storing the result in s1.
 func (Int16T) Difference(s1, s2 map[int16]struct{}) {
 	for el := range s1 {
@@ -56,3 +81,96 @@ func (Int16T) Union(s1, s2 map[int16]struct{}) {
 		s1[el] = struct{}{}
 	}
 }
+
+// Equal returns true iff s1 and s2 have the same elements.  A nil set
+// is equal to an empty set.
+func (Int16T) Equal(s1, s2 map[int16]struct{}) bool {
+	if len(s1) != len(s2) {
+		return false
+	}
+	for el := range s1 {
+		if _, ok := s2[el]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// IsSubset returns true iff every element of s1 is in s2.  A nil set is
+// a subset of every set.
+func (Int16T) IsSubset(s1, s2 map[int16]struct{}) bool {
+	if len(s1) > len(s2) {
+		return false
+	}
+	for el := range s1 {
+		if _, ok := s2[el]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// NewDifference returns a new set holding the elements of s1 that are not in
+// s2.  Unlike Difference, neither s1 nor s2 is modified.
+func (Int16T) NewDifference(s1, s2 map[int16]struct{}) map[int16]struct{} {
+	result := map[int16]struct{}{}
+	for el := range s1 {
+		if _, ok := s2[el]; !ok {
+			result[el] = struct{}{}
+		}
+	}
+	return result
+}
+
+// NewIntersection returns a new set holding the elements that are in both s1
+// and s2.  Unlike Intersection, neither s1 nor s2 is modified.
+func (Int16T) NewIntersection(s1, s2 map[int16]struct{}) map[int16]struct{} {
+	result := map[int16]struct{}{}
+	for el := range s1 {
+		if _, ok := s2[el]; ok {
+			result[el] = struct{}{}
+		}
+	}
+	return result
+}
+
+// NewUnion returns a new set holding the elements that are in either s1 or
+// s2.  Unlike Union, neither s1 nor s2 is modified.
+func (Int16T) NewUnion(s1, s2 map[int16]struct{}) map[int16]struct{} {
+	result := make(map[int16]struct{}, len(s1)+len(s2))
+	for el := range s1 {
+		result[el] = struct{}{}
+	}
+	for el := range s2 {
+		result[el] = struct{}{}
+	}
+	return result
+}
+
+// UnionAll returns a new set holding the elements that are in any of the
+// given sets, none of which is modified.  It returns nil if there are no
+// elements, e.g. if no sets are given.
+func (Int16T) UnionAll(sets ...map[int16]struct{}) map[int16]struct{} {
+	var result map[int16]struct{}
+	for _, s := range sets {
+		for el := range s {
+			if result == nil {
+				result = map[int16]struct{}{}
+			}
+			result[el] = struct{}{}
+		}
+	}
+	return result
+}
+
+// SymmetricDifference computes the elements that are in exactly one of
+// s1 and s2, storing the result in s1.
+func (Int16T) SymmetricDifference(s1, s2 map[int16]struct{}) {
+	for el := range s2 {
+		if _, ok := s1[el]; ok {
+			delete(s1, el)
+		} else {
+			s1[el] = struct{}{}
+		}
+	}
+}
@@ -7,11 +7,16 @@
 
 package set
 
+import (
+	"sort"
+)
+
 var Int16Bool = Int16BoolT{}
 
 type Int16BoolT struct{}
 
-// FromSlice transforms the given slice to a set.
+// FromSlice transforms the given slice to a set.  Duplicate elements
+// of the slice appear only once in the result.
 func (Int16BoolT) FromSlice(els []int16) map[int16]bool {
 	if len(els) == 0 {
 		return nil
@@ -32,6 +37,26 @@ func (Int16BoolT) ToSlice(s map[int16]bool) []int16 {
 	return result
 }
 
+// ToSortedSlice transforms the given set to a slice, sorted in ascending order.
+func (Int16BoolT) ToSortedSlice(s map[int16]bool) []int16 {
+	result := Int16Bool.ToSlice(s)
+	sort.Slice(result, func(i, j int) bool { return result[i] < result[j] })
+	return result
+}
+
+// Clone returns a new set with the same elements as s, or nil if s is
+// nil.
+func (Int16BoolT) Clone(s map[int16]bool) map[int16]bool {
+	if s == nil {
+		return nil
+	}
+	result := make(map[int16]bool, len(s))
+	for el := range s {
+		result[el] = true
+	}
+	return result
+}
+
 // Difference subtracts s2 from s1, storing the result in s1.
 func (Int16BoolT) Difference(s1, s2 map[int16]bool) {
 	for el := range s1 {
@@ -56,3 +81,96 @@ func (Int16BoolT) Union(s1, s2 map[int16]bool) {
 		s1[el] = true
 	}
 }
+
+// Equal returns true iff s1 and s2 have the same elements.  A nil set
+// is equal to an empty set.
+func (Int16BoolT) Equal(s1, s2 map[int16]bool) bool {
+	if len(s1) != len(s2) {
+		return false
+	}
+	for el := range s1 {
+		if _, ok := s2[el]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// IsSubset returns true iff every element of s1 is in s2.  A nil set is
+// a subset of every set.
+func (Int16BoolT) IsSubset(s1, s2 map[int16]bool) bool {
+	if len(s1) > len(s2) {
+		return false
+	}
+	for el := range s1 {
+		if _, ok := s2[el]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// NewDifference returns a new set holding the elements of s1 that are not in
+// s2.  Unlike Difference, neither s1 nor s2 is modified.
+func (Int16BoolT) NewDifference(s1, s2 map[int16]bool) map[int16]bool {
+	result := map[int16]bool{}
+	for el := range s1 {
+		if _, ok := s2[el]; !ok {
+			result[el] = true
+		}
+	}
+	return result
+}
+
+// NewIntersection returns a new set holding the elements that are in both s1
+// and s2.  Unlike Intersection, neither s1 nor s2 is modified.
+func (Int16BoolT) NewIntersection(s1, s2 map[int16]bool) map[int16]bool {
+	result := map[int16]bool{}
+	for el := range s1 {
+		if _, ok := s2[el]; ok {
+			result[el] = true
+		}
+	}
+	return result
+}
+
+// NewUnion returns a new set holding the elements that are in either s1 or
+// s2.  Unlike Union, neither s1 nor s2 is modified.
+func (Int16BoolT) NewUnion(s1, s2 map[int16]bool) map[int16]bool {
+	result := make(map[int16]bool, len(s1)+len(s2))
+	for el := range s1 {
+		result[el] = true
+	}
+	for el := range s2 {
+		result[el] = true
+	}
+	return result
+}
+
+// UnionAll returns a new set holding the elements that are in any of the
+// given sets, none of which is modified.  It returns nil if there are no
+// elements, e.g. if no sets are given.
+func (Int16BoolT) UnionAll(sets ...map[int16]bool) map[int16]bool {
+	var result map[int16]bool
+	for _, s := range sets {
+		for el := range s {
+			if result == nil {
+				result = map[int16]bool{}
+			}
+			result[el] = true
+		}
+	}
+	return result
+}
+
+// SymmetricDifference computes the elements that are in exactly one of
+// s1 and s2, storing the result in s1.
+func (Int16BoolT) SymmetricDifference(s1, s2 map[int16]bool) {
+	for el := range s2 {
+		if _, ok := s1[el]; ok {
+			delete(s1, el)
+		} else {
+			s1[el] = true
+		}
+	}
+}
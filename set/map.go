@@ -0,0 +1,32 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package set
+
+// FromMapKeys returns the set of keys of the given map.  It returns
+// nil if the map is empty, matching the behavior of FromSlice.
+func FromMapKeys[K comparable, V any](m map[K]V) map[K]struct{} {
+	if len(m) == 0 {
+		return nil
+	}
+	result := make(map[K]struct{}, len(m))
+	for k := range m {
+		result[k] = struct{}{}
+	}
+	return result
+}
+
+// FromMapValues returns the set of values of the given map.  Values
+// that appear under several keys appear only once in the result.  It
+// returns nil if the map is empty, matching the behavior of FromSlice.
+func FromMapValues[K, V comparable](m map[K]V) map[V]struct{} {
+	if len(m) == 0 {
+		return nil
+	}
+	result := map[V]struct{}{}
+	for _, v := range m {
+		result[v] = struct{}{}
+	}
+	return result
+}
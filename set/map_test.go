@@ -0,0 +1,30 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package set
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFromMapKeys(t *testing.T) {
+	if got := FromMapKeys(map[string]int{}); got != nil {
+		t.Errorf("got %v, want nil", got)
+	}
+	m := map[string][]int{"a": {1}, "b": nil}
+	if got, want := FromMapKeys(m), String.FromSlice([]string{"a", "b"}); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestFromMapValues(t *testing.T) {
+	if got := FromMapValues(map[string]int{}); got != nil {
+		t.Errorf("got %v, want nil", got)
+	}
+	m := map[string]int{"a": 1, "b": 2, "c": 1}
+	if got, want := FromMapValues(m), Int.FromSlice([]int{1, 2}); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -7,11 +7,16 @@
 
 package set
 
+import (
+	"sort"
+)
+
 var String = StringT{}
 
 type StringT struct{}
 
-// FromSlice transforms the given slice to a set.
+// FromSlice transforms the given slice to a set.  Duplicate elements
+// of the slice appear only once in the result.
 func (StringT) FromSlice(els []string) map[string]struct{} {
 	if len(els) == 0 {
 		return nil
@@ -32,6 +37,26 @@ func (StringT) ToSlice(s map[string]struct{}) []string {
 	return result
 }
 
+// ToSortedSlice transforms the given set to a slice, sorted in ascending order.
+func (StringT) ToSortedSlice(s map[string]struct{}) []string {
+	result := String.ToSlice(s)
+	sort.Slice(result, func(i, j int) bool { return result[i] < result[j] })
+	return result
+}
+
+// Clone returns a new set with the same elements as s, or nil if s is
+// nil.
+func (StringT) Clone(s map[string]struct{}) map[string]struct{} {
+	if s == nil {
+		return nil
+	}
+	result := make(map[string]struct{}, len(s))
+	for el := range s {
+		result[el] = struct{}{}
+	}
+	return result
+}
+
 // Difference subtracts s2 from s1, storing the result in s1.
 func (StringT) Difference(s1, s2 map[string]struct{}) {
 	for el := range s1 {
@@ -56,3 +81,96 @@ func (StringT) Union(s1, s2 map[string]struct{}) {
 		s1[el] = struct{}{}
 	}
 }
+
+// Equal returns true iff s1 and s2 have the same elements.  A nil set
+// is equal to an empty set.
+func (StringT) Equal(s1, s2 map[string]struct{}) bool {
+	if len(s1) != len(s2) {
+		return false
+	}
+	for el := range s1 {
+		if _, ok := s2[el]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// IsSubset returns true iff every element of s1 is in s2.  A nil set is
+// a subset of every set.
+func (StringT) IsSubset(s1, s2 map[string]struct{}) bool {
+	if len(s1) > len(s2) {
+		return false
+	}
+	for el := range s1 {
+		if _, ok := s2[el]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// NewDifference returns a new set holding the elements of s1 that are not in
+// s2.  Unlike Difference, neither s1 nor s2 is modified.
+func (StringT) NewDifference(s1, s2 map[string]struct{}) map[string]struct{} {
+	result := map[string]struct{}{}
+	for el := range s1 {
+		if _, ok := s2[el]; !ok {
+			result[el] = struct{}{}
+		}
+	}
+	return result
+}
+
+// NewIntersection returns a new set holding the elements that are in both s1
+// and s2.  Unlike Intersection, neither s1 nor s2 is modified.
+func (StringT) NewIntersection(s1, s2 map[string]struct{}) map[string]struct{} {
+	result := map[string]struct{}{}
+	for el := range s1 {
+		if _, ok := s2[el]; ok {
+			result[el] = struct{}{}
+		}
+	}
+	return result
+}
+
+// NewUnion returns a new set holding the elements that are in either s1 or
+// s2.  Unlike Union, neither s1 nor s2 is modified.
+func (StringT) NewUnion(s1, s2 map[string]struct{}) map[string]struct{} {
+	result := make(map[string]struct{}, len(s1)+len(s2))
+	for el := range s1 {
+		result[el] = struct{}{}
+	}
+	for el := range s2 {
+		result[el] = struct{}{}
+	}
+	return result
+}
+
+// UnionAll returns a new set holding the elements that are in any of the
+// given sets, none of which is modified.  It returns nil if there are no
+// elements, e.g. if no sets are given.
+func (StringT) UnionAll(sets ...map[string]struct{}) map[string]struct{} {
+	var result map[string]struct{}
+	for _, s := range sets {
+		for el := range s {
+			if result == nil {
+				result = map[string]struct{}{}
+			}
+			result[el] = struct{}{}
+		}
+	}
+	return result
+}
+
+// SymmetricDifference computes the elements that are in exactly one of
+// s1 and s2, storing the result in s1.
+func (StringT) SymmetricDifference(s1, s2 map[string]struct{}) {
+	for el := range s2 {
+		if _, ok := s1[el]; ok {
+			delete(s1, el)
+		} else {
+			s1[el] = struct{}{}
+		}
+	}
+}
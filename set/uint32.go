@@ -7,11 +7,16 @@
 
 package set
 
+import (
+	"sort"
+)
+
 var Uint32 = Uint32T{}
 
 type Uint32T struct{}
 
-// FromSlice transforms the given slice to a set.
+// FromSlice transforms the given slice to a set.  Duplicate elements
+// of the slice appear only once in the result.
 func (Uint32T) FromSlice(els []uint32) map[uint32]struct{} {
 	if len(els) == 0 {
 		return nil
@@ -32,6 +37,26 @@ func (Uint32T) ToSlice(s map[uint32]struct{}) []uint32 {
 	return result
 }
 
+// ToSortedSlice transforms the given set to a slice, sorted in ascending order.
+func (Uint32T) ToSortedSlice(s map[uint32]struct{}) []uint32 {
+	result := Uint32.ToSlice(s)
+	sort.Slice(result, func(i, j int) bool { return result[i] < result[j] })
+	return result
+}
+
+// Clone returns a new set with the same elements as s, or nil if s is
+// nil.
+func (Uint32T) Clone(s map[uint32]struct{}) map[uint32]struct{} {
+	if s == nil {
+		return nil
+	}
+	result := make(map[uint32]struct{}, len(s))
+	for el := range s {
+		result[el] = struct{}{}
+	}
+	return result
+}
+
 // Difference subtracts s2 from s1, storing the result in s1.
 func (Uint32T) Difference(s1, s2 map[uint32]struct{}) {
 	for el := range s1 {
@@ -56,3 +81,96 @@ func (Uint32T) Union(s1, s2 map[uint32]struct{}) {
 		s1[el] = struct{}{}
 	}
 }
+
+// Equal returns true iff s1 and s2 have the same elements.  A nil set
+// is equal to an empty set.
+func (Uint32T) Equal(s1, s2 map[uint32]struct{}) bool {
+	if len(s1) != len(s2) {
+		return false
+	}
+	for el := range s1 {
+		if _, ok := s2[el]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// IsSubset returns true iff every element of s1 is in s2.  A nil set is
+// a subset of every set.
+func (Uint32T) IsSubset(s1, s2 map[uint32]struct{}) bool {
+	if len(s1) > len(s2) {
+		return false
+	}
+	for el := range s1 {
+		if _, ok := s2[el]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// NewDifference returns a new set holding the elements of s1 that are not in
+// s2.  Unlike Difference, neither s1 nor s2 is modified.
+func (Uint32T) NewDifference(s1, s2 map[uint32]struct{}) map[uint32]struct{} {
+	result := map[uint32]struct{}{}
+	for el := range s1 {
+		if _, ok := s2[el]; !ok {
+			result[el] = struct{}{}
+		}
+	}
+	return result
+}
+
+// NewIntersection returns a new set holding the elements that are in both s1
+// and s2.  Unlike Intersection, neither s1 nor s2 is modified.
+func (Uint32T) NewIntersection(s1, s2 map[uint32]struct{}) map[uint32]struct{} {
+	result := map[uint32]struct{}{}
+	for el := range s1 {
+		if _, ok := s2[el]; ok {
+			result[el] = struct{}{}
+		}
+	}
+	return result
+}
+
+// NewUnion returns a new set holding the elements that are in either s1 or
+// s2.  Unlike Union, neither s1 nor s2 is modified.
+func (Uint32T) NewUnion(s1, s2 map[uint32]struct{}) map[uint32]struct{} {
+	result := make(map[uint32]struct{}, len(s1)+len(s2))
+	for el := range s1 {
+		result[el] = struct{}{}
+	}
+	for el := range s2 {
+		result[el] = struct{}{}
+	}
+	return result
+}
+
+// UnionAll returns a new set holding the elements that are in any of the
+// given sets, none of which is modified.  It returns nil if there are no
+// elements, e.g. if no sets are given.
+func (Uint32T) UnionAll(sets ...map[uint32]struct{}) map[uint32]struct{} {
+	var result map[uint32]struct{}
+	for _, s := range sets {
+		for el := range s {
+			if result == nil {
+				result = map[uint32]struct{}{}
+			}
+			result[el] = struct{}{}
+		}
+	}
+	return result
+}
+
+// SymmetricDifference computes the elements that are in exactly one of
+// s1 and s2, storing the result in s1.
+func (Uint32T) SymmetricDifference(s1, s2 map[uint32]struct{}) {
+	for el := range s2 {
+		if _, ok := s1[el]; ok {
+			delete(s1, el)
+		} else {
+			s1[el] = struct{}{}
+		}
+	}
+}
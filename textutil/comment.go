@@ -0,0 +1,42 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package textutil
+
+import (
+	"bytes"
+	"strings"
+	"unicode/utf8"
+)
+
+// CommentWrap returns text word-wrapped and with each line prefixed by prefix,
+// e.g. "// " to produce a Go comment for generated code.  The width in runes
+// includes the prefix; if width < 0 the width is unlimited, and each paragraph
+// is output as a single line.  Formatting follows the rules of WrapWriter;
+// e.g. paragraphs are separated by blank lines, and lines with leading spaces
+// are output verbatim.  Trailing spaces are removed from each output line, so
+// that blank lines consist of the prefix without trailing spaces, e.g. "//".
+// The returned string ends with a newline, unless it is empty.
+func CommentWrap(text, prefix string, width int) string {
+	if width >= 0 {
+		width -= utf8.RuneCountInString(prefix)
+		if width < 1 {
+			width = 1
+		}
+	}
+	var buf bytes.Buffer
+	pw := PrefixLineWriter(&buf, prefix)
+	ww := NewUTF8WrapWriter(pw, width)
+	// Writes to the underlying bytes.Buffer never fail.
+	ww.Write([]byte(text))
+	ww.Flush()
+	pw.Flush()
+	lines := strings.SplitAfter(buf.String(), "\n")
+	for i, line := range lines {
+		if strings.HasSuffix(line, "\n") {
+			lines[i] = strings.TrimRight(line[:len(line)-1], " \t") + "\n"
+		}
+	}
+	return strings.Join(lines, "")
+}
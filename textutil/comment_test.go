@@ -0,0 +1,35 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package textutil
+
+import (
+	"testing"
+)
+
+func TestCommentWrap(t *testing.T) {
+	tests := []struct {
+		Text, Prefix string
+		Width        int
+		Want         string
+	}{
+		{"", "// ", 80, ""},
+		{"abc", "// ", 80, "// abc\n"},
+		{"aaa bbb ccc ddd", "// ", 10, "// aaa bbb\n// ccc ddd\n"},
+		{"aaa bbb\nccc ddd", "// ", -1, "// aaa bbb ccc ddd\n"},
+		// Blank lines between paragraphs have no trailing space.
+		{"aaa\n\nbbb", "// ", 80, "// aaa\n//\n// bbb\n"},
+		// Indented lines are output verbatim.
+		{"aaa bbb\n  x := 1\n", "// ", 8, "// aaa\n// bbb\n//   x := 1\n"},
+		{"aaa bbb", "# ", 5, "# aaa\n# bbb\n"},
+		// The prefix may be wider than the width.
+		{"aaa bbb", "// ", 2, "// aaa\n// bbb\n"},
+		{"ü ö", "// ", 6, "// ü ö\n"},
+	}
+	for _, test := range tests {
+		if got, want := CommentWrap(test.Text, test.Prefix, test.Width), test.Want; got != want {
+			t.Errorf("CommentWrap(%q, %q, %d) got %q, want %q", test.Text, test.Prefix, test.Width, got, want)
+		}
+	}
+}
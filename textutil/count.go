@@ -0,0 +1,50 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package textutil
+
+import (
+	"io"
+)
+
+// CountWords reads UTF-8 text from r until EOF, and returns the number of
+// lines, words and runes that were read.  Lines are counted as the number of
+// '\n' runes, as with the wc utility.  Words are sequences of letters, where
+// letters are defined exactly as in WrapWriter; i.e. words are separated by
+// spaces as defined by unicode.IsSpace and end-of-line runes.  Invalid UTF-8 is
+// counted as a U+FFFD replacement character per invalid byte sequence.
+//
+// If reading from r fails, the counts up to the point of failure are returned
+// along with the error.
+func CountWords(r io.Reader) (lines, words, runes int, err error) {
+	var dec UTF8ChunkDecoder
+	inWord := false
+	count := func(r rune) error {
+		runes++
+		if r == '\n' {
+			lines++
+		}
+		isLetter := runeKind(r) == kindLetter
+		if isLetter && !inWord {
+			words++
+		}
+		inWord = isLetter
+		return nil
+	}
+	chunk := make([]byte, 4096)
+	for {
+		n, rerr := r.Read(chunk)
+		// count never fails, so neither does WriteRuneChunk.
+		WriteRuneChunk(&dec, count, chunk[:n])
+		if rerr == io.EOF {
+			break
+		}
+		if rerr != nil {
+			err = rerr
+			break
+		}
+	}
+	FlushRuneChunk(&dec, count)
+	return
+}
@@ -0,0 +1,61 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package textutil
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestCountWords(t *testing.T) {
+	tests := []struct {
+		In                         string
+		Lines, Words, Runes, Bytes int
+	}{
+		{"", 0, 0, 0, 0},
+		{"a", 0, 1, 1, 1},
+		{"a\n", 1, 1, 2, 2},
+		{"  abc  def\t\n\nghi", 2, 3, 16, 16},
+		{"a b c", 0, 3, 5, 9},
+		{"a\r\nb\fc\vd", 1, 4, 8, 8},
+		// Multi-byte runes.
+		{"世界 ☺\n", 1, 2, 5, 11},
+		{"üñí\u00a0cödé", 0, 2, 8, 14}, // U+00A0 is a space
+		// Invalid UTF-8 becomes U+FFFD, which is a letter.
+		{"a\xff b", 0, 2, 4, 4},
+	}
+	for _, test := range tests {
+		if got, want := len(test.In), test.Bytes; got != want {
+			t.Fatalf("%q: got %d bytes, want %d", test.In, got, want)
+		}
+		for _, r := range []io.Reader{
+			strings.NewReader(test.In),
+			iotest.OneByteReader(strings.NewReader(test.In)),
+		} {
+			lines, words, runes, err := CountWords(r)
+			if err != nil {
+				t.Errorf("%q: unexpected error: %v", test.In, err)
+			}
+			if lines != test.Lines || words != test.Words || runes != test.Runes {
+				t.Errorf("%q: got (%d, %d, %d), want (%d, %d, %d)", test.In, lines, words, runes, test.Lines, test.Words, test.Runes)
+			}
+		}
+	}
+}
+
+func TestCountWordsError(t *testing.T) {
+	errFoo := errors.New("foo")
+	r := io.MultiReader(strings.NewReader("aaa bbb\nccc"), iotest.ErrReader(errFoo))
+	lines, words, runes, err := CountWords(r)
+	if got, want := err, errFoo; got != want {
+		t.Errorf("got error %v, want %v", got, want)
+	}
+	if lines != 1 || words != 3 || runes != 11 {
+		t.Errorf("got (%d, %d, %d), want (1, 3, 11)", lines, words, runes)
+	}
+}
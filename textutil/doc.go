@@ -11,4 +11,8 @@
 //	PrefixWriter:      Add prefix to output.
 //	PrefixLineWriter:  Add prefix to each line in output.
 //	ByteReplaceWriter: Replace single byte with bytes in output.
+//	NewReflowReader:   Re-wrap already-wrapped text to a new width.
+//	CountWords:        Count lines, words and runes in text.
+//	CommentWrap:       Wrap text as prefixed comment lines.
+//	Indent:            Add prefix to each non-empty line of text.
 package textutil
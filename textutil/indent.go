@@ -0,0 +1,25 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package textutil
+
+import (
+	"strings"
+)
+
+// Indent returns s with prefix prepended to each non-empty line.  Empty lines,
+// including the empty "line" following a trailing newline, are left empty, so
+// that the result has no trailing whitespace that wasn't in s.
+//
+// For example, Indent("a\n\nb\n", "  ") returns "  a\n\n  b\n".
+func Indent(s, prefix string) string {
+	var b strings.Builder
+	for _, line := range strings.SplitAfter(s, "\n") {
+		if line != "" && line != "\n" {
+			b.WriteString(prefix)
+		}
+		b.WriteString(line)
+	}
+	return b.String()
+}
@@ -0,0 +1,32 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package textutil
+
+import (
+	"testing"
+)
+
+func TestIndent(t *testing.T) {
+	tests := []struct {
+		In, Prefix, Want string
+	}{
+		{"", "  ", ""},
+		{"\n", "  ", "\n"},
+		{"a", "  ", "  a"},
+		{"a\n", "  ", "  a\n"},
+		{"a\nb", "// ", "// a\n// b"},
+		// Empty lines are left empty.
+		{"a\n\nb\n", "  ", "  a\n\n  b\n"},
+		{"\n\na\n\n", "\t", "\n\n\ta\n\n"},
+		// Lines containing only whitespace aren't empty.
+		{"a\n \n", "  ", "  a\n   \n"},
+		{"a\nb\n", "", "a\nb\n"},
+	}
+	for _, test := range tests {
+		if got, want := Indent(test.In, test.Prefix), test.Want; got != want {
+			t.Errorf("Indent(%q, %q) got %q, want %q", test.In, test.Prefix, got, want)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package textutil
+
+import (
+	"bytes"
+	"io"
+)
+
+// NewReflowReader returns an io.Reader that reads already-wrapped UTF-8 text
+// from r, and re-wraps it to the given target width in runes.  If width < 0 the
+// width is unlimited; each paragraph is output as a single line.
+//
+// Single line breaks within a paragraph are treated as soft breaks, and are
+// replaced by word-wrapping at the new width.  Paragraphs separated by blank
+// lines remain separated by a single blank line, and input lines with leading
+// spaces are output verbatim.  See WrapWriter for details of the formatting
+// rules.
+func NewReflowReader(r io.Reader, width int) io.Reader {
+	ret := &reflowReader{r: r, chunk: make([]byte, 4096)}
+	ret.w = NewUTF8WrapWriter(&ret.buf, width)
+	return ret
+}
+
+type reflowReader struct {
+	r     io.Reader
+	w     *WrapWriter
+	buf   bytes.Buffer // reflowed output that hasn't been read yet
+	chunk []byte
+	err   error // sticky error from r, or io.EOF
+}
+
+func (rr *reflowReader) Read(p []byte) (int, error) {
+	for rr.buf.Len() == 0 && rr.err == nil {
+		n, err := rr.r.Read(rr.chunk)
+		if n > 0 {
+			// Writes to the underlying bytes.Buffer never fail.
+			rr.w.Write(rr.chunk[:n])
+		}
+		if err == io.EOF {
+			rr.w.Flush()
+		}
+		rr.err = err
+	}
+	if rr.buf.Len() > 0 {
+		return rr.buf.Read(p)
+	}
+	return 0, rr.err
+}
@@ -0,0 +1,62 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package textutil
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestReflowReader(t *testing.T) {
+	tests := []struct {
+		Width int
+		In    string
+		Want  string
+	}{
+		{10, "", ""},
+		{10, "a b c", "a b c\n"},
+		// Soft line breaks within a paragraph are removed.
+		{10, "a\nb\nc\n", "a b c\n"},
+		{-1, "aaa bbb\nccc ddd\neee\n", "aaa bbb ccc ddd eee\n"},
+		// Lines are re-wrapped to the target width.
+		{7, "aaa bbb ccc\nddd\n", "aaa bbb\nccc ddd\n"},
+		{20, "aaa bbb\nccc ddd\n", "aaa bbb ccc ddd\n"},
+		// Paragraph boundaries are preserved.
+		{20, "aaa\nbbb\n\nccc\nddd\n", "aaa bbb\n\nccc ddd\n"},
+		{20, "aaa\nbbb\n\n\n\nccc\nddd\n", "aaa bbb\n\nccc ddd\n"},
+		// Indented lines are output verbatim.
+		{7, "aaa\nbbb\n  ccc ddd eee\n  fff\nggg\n", "aaa bbb\n  ccc ddd eee\n  fff\nggg\n"},
+	}
+	for _, test := range tests {
+		for _, r := range []io.Reader{
+			strings.NewReader(test.In),
+			iotest.OneByteReader(strings.NewReader(test.In)),
+		} {
+			b, err := io.ReadAll(NewReflowReader(r, test.Width))
+			if err != nil {
+				t.Errorf("%q: ReadAll failed: %v", test.In, err)
+			}
+			if got, want := string(b), test.Want; got != want {
+				t.Errorf("(%d, %q) got %q, want %q", test.Width, test.In, got, want)
+			}
+		}
+	}
+}
+
+func TestReflowReaderError(t *testing.T) {
+	errTest := errors.New("test error")
+	r := io.MultiReader(strings.NewReader("aaa\nbbb\n\nccc\n"), iotest.ErrReader(errTest))
+	b, err := io.ReadAll(NewReflowReader(r, 20))
+	if got, want := err, errTest; got != want {
+		t.Errorf("got error %v, want %v", got, want)
+	}
+	// Completed paragraphs are returned before the error.
+	if got, want := string(b), "aaa bbb\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
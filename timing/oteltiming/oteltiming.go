@@ -0,0 +1,56 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package oteltiming exports the intervals collected by a timing.Timer as
+// OpenTelemetry spans.  It is a separate package so that the timing package
+// doesn't depend on OpenTelemetry.
+package oteltiming
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+	"v.io/x/lib/timing"
+)
+
+// ExportTimer exports the intervals collected by t as spans; see ExportSpans.
+func ExportTimer(ctx context.Context, tracer trace.Tracer, t *timing.Timer) {
+	ExportSpans(ctx, tracer, t.Zero, t.Intervals, t.Now())
+}
+
+// ExportSpans creates a span via tracer for each of the given intervals, named
+// after the interval.  The intervals must be in depth-first order; i.e. any
+// slice or subslice of intervals produced by Timer are valid.  Each span is a
+// child of the span for the closest preceding interval with a smaller depth, or
+// of the span in ctx (if any) for the intervals with the smallest depth.
+//
+// The start and end times of each span are computed by adding the interval's
+// start and end to the given zero time, typically Timer.Zero.  The time now is
+// used as the end time for any open intervals, and is represented as a duration
+// from the zero time; e.g. use Timer.Now() for intervals collected by the
+// Timer.
+func ExportSpans(ctx context.Context, tracer trace.Tracer, zero time.Time, intervals []timing.Interval, now time.Duration) {
+	type parent struct {
+		depth int
+		ctx   context.Context
+	}
+	var stack []parent
+	for _, i := range intervals {
+		for len(stack) > 0 && stack[len(stack)-1].depth >= i.Depth {
+			stack = stack[:len(stack)-1]
+		}
+		parentCtx := ctx
+		if len(stack) > 0 {
+			parentCtx = stack[len(stack)-1].ctx
+		}
+		end := i.End
+		if end == timing.InvalidDuration {
+			end = now
+		}
+		spanCtx, span := tracer.Start(parentCtx, i.Name, trace.WithTimestamp(zero.Add(i.Start)))
+		span.End(trace.WithTimestamp(zero.Add(end)))
+		stack = append(stack, parent{i.Depth, spanCtx})
+	}
+}
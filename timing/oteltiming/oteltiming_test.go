@@ -0,0 +1,96 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oteltiming_test
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+	"v.io/x/lib/timing"
+	"v.io/x/lib/timing/oteltiming"
+)
+
+// fakeSpan records the span name, parent and timestamps.  Embedding
+// trace.Span provides the methods that aren't used.
+type fakeSpan struct {
+	trace.Span
+	name, parent string
+	start, end   time.Time
+}
+
+func (s *fakeSpan) End(opts ...trace.SpanEndOption) {
+	config := trace.NewSpanEndConfig(opts...)
+	s.end = config.Timestamp()
+}
+
+type fakeTracer struct {
+	spans []*fakeSpan
+}
+
+func (t *fakeTracer) Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	config := trace.NewSpanStartConfig(opts...)
+	span := &fakeSpan{name: name, start: config.Timestamp()}
+	if parent, ok := trace.SpanFromContext(ctx).(*fakeSpan); ok {
+		span.parent = parent.name
+	}
+	t.spans = append(t.spans, span)
+	return trace.ContextWithSpan(ctx, span), span
+}
+
+func TestExportSpans(t *testing.T) {
+	zero := time.Date(2015, 1, 2, 3, 4, 5, 0, time.UTC)
+	sec := func(d int) time.Duration { return time.Duration(d) * time.Second }
+	intervals := []timing.Interval{
+		{Name: "root", Depth: 0, Start: 0, End: timing.InvalidDuration},
+		{Name: "a", Depth: 1, Start: sec(1), End: sec(5)},
+		{Name: "a1", Depth: 2, Start: sec(2), End: sec(3)},
+		{Name: "a2", Depth: 2, Start: sec(3), End: sec(4)},
+		{Name: "a2x", Depth: 3, Start: sec(3), End: sec(4)},
+		{Name: "b", Depth: 1, Start: sec(6), End: timing.InvalidDuration},
+	}
+	ctx, outer := (&fakeTracer{}).Start(context.Background(), "outer")
+	var tracer fakeTracer
+	oteltiming.ExportSpans(ctx, &tracer, zero, intervals, sec(10))
+	outer.End()
+
+	var got []string
+	for _, s := range tracer.spans {
+		got = append(got, fmt.Sprintf("%s<-%s %v-%v", s.name, s.parent, s.start.Sub(zero), s.end.Sub(zero)))
+	}
+	want := []string{
+		"root<-outer 0s-10s",
+		"a<-root 1s-5s",
+		"a1<-a 2s-3s",
+		"a2<-a 3s-4s",
+		"a2x<-a2 3s-4s",
+		"b<-root 6s-10s",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestExportTimer(t *testing.T) {
+	timer := timing.NewTimer("root")
+	timer.Push("child")
+	timer.Pop()
+	timer.Finish()
+	var tracer fakeTracer
+	oteltiming.ExportTimer(context.Background(), &tracer, timer)
+	if got, want := len(tracer.spans), 2; got != want {
+		t.Fatalf("got %d spans, want %d", got, want)
+	}
+	if got, want := tracer.spans[1].parent, "root"; got != want {
+		t.Errorf("got parent %q, want %q", got, want)
+	}
+	if got, want := tracer.spans[0].start, timer.Zero; !got.Equal(want) {
+		t.Errorf("got start %v, want %v", got, want)
+	}
+}
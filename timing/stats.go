@@ -0,0 +1,67 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package timing
+
+import (
+	"sort"
+	"time"
+)
+
+// IntervalStats describes the distribution of durations of all intervals with
+// the same name.
+type IntervalStats struct {
+	Name          string
+	Count         int
+	Min, Max      time.Duration
+	Mean          time.Duration
+	P50, P90, P99 time.Duration
+}
+
+// Aggregate groups the given intervals by name, and returns statistics
+// describing the distribution of durations for each name, sorted by name.  This
+// is useful for intervals that recur, e.g. an interval pushed for each request
+// handled by a server.
+//
+// The time now is used as the end time for any open intervals, and is
+// represented as a duration from the zero time for the intervals;
+// e.g. use Timer.Now() for intervals collected by the Timer.
+func Aggregate(intervals []Interval, now time.Duration) []IntervalStats {
+	durs := make(map[string][]time.Duration)
+	for _, i := range intervals {
+		end := i.End
+		if end == InvalidDuration {
+			end = now
+		}
+		durs[i.Name] = append(durs[i.Name], end-i.Start)
+	}
+	stats := make([]IntervalStats, 0, len(durs))
+	for name, d := range durs {
+		sort.Slice(d, func(a, b int) bool { return d[a] < d[b] })
+		var sum time.Duration
+		for _, x := range d {
+			sum += x
+		}
+		stats = append(stats, IntervalStats{
+			Name:  name,
+			Count: len(d),
+			Min:   d[0],
+			Max:   d[len(d)-1],
+			Mean:  sum / time.Duration(len(d)),
+			P50:   percentile(d, 50),
+			P90:   percentile(d, 90),
+			P99:   percentile(d, 99),
+		})
+	}
+	sort.Slice(stats, func(a, b int) bool { return stats[a].Name < stats[b].Name })
+	return stats
+}
+
+// percentile returns the p-th percentile of the sorted durations d, using the
+// nearest-rank method.  Requires len(d) > 0 and 0 < p <= 100.
+func percentile(d []time.Duration, p int) time.Duration {
+	// The rank is ceil(p/100 * len(d)), and is 1-based.
+	rank := (p*len(d) + 99) / 100
+	return d[rank-1]
+}
@@ -0,0 +1,38 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package timing
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAggregate(t *testing.T) {
+	ms := func(d int) time.Duration { return time.Duration(d) * time.Millisecond }
+	intervals := []Interval{{Name: "root", Start: 0, End: InvalidDuration}}
+	// Push 100 "req" intervals with durations 1ms..100ms, in reverse order.
+	start := ms(0)
+	for i := 100; i > 0; i-- {
+		intervals = append(intervals, Interval{Name: "req", Depth: 1, Start: start, End: start + ms(i)})
+		start += ms(i)
+	}
+	intervals = append(intervals,
+		Interval{Name: "db", Depth: 2, Start: ms(1), End: ms(4)},
+		Interval{Name: "db", Depth: 2, Start: ms(5), End: InvalidDuration},
+	)
+	got := Aggregate(intervals, ms(10000))
+	want := []IntervalStats{
+		{Name: "db", Count: 2, Min: ms(3), Max: ms(9995), Mean: ms(4999), P50: ms(3), P90: ms(9995), P99: ms(9995)},
+		{Name: "req", Count: 100, Min: ms(1), Max: ms(100), Mean: ms(50) + ms(1)/2, P50: ms(50), P90: ms(90), P99: ms(99)},
+		{Name: "root", Count: 1, Min: ms(10000), Max: ms(10000), Mean: ms(10000), P50: ms(10000), P90: ms(10000), P99: ms(10000)},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	if got := Aggregate(nil, 0); len(got) != 0 {
+		t.Errorf("got %+v, want empty", got)
+	}
+}
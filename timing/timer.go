@@ -9,6 +9,7 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -59,9 +60,26 @@ func NewTimer(name string) *Timer {
 	}
 }
 
+// NopTimer returns a Timer that does nothing; Push, Pop and Finish have no
+// effect, Now always returns 0, String returns the empty string, and Intervals
+// is always empty.  It may be used in place of a Timer returned by NewTimer to
+// disable timing without guarding each call.
+func NopTimer() *Timer {
+	return &Timer{}
+}
+
+// isNop returns true iff t was created by NopTimer; all other timers have a
+// root interval.
+func (t *Timer) isNop() bool {
+	return len(t.Intervals) == 0
+}
+
 // Push appends a child with the given name and an open interval to current, and
 // updates the current interval to refer to the newly created child.
 func (t *Timer) Push(name string) {
+	if t.isNop() {
+		return
+	}
 	depth := len(t.stack)
 	if depth == 0 {
 		// Unset the root end time, to handle Push after Finish.
@@ -87,6 +105,9 @@ func (t *Timer) Pop() {
 
 // Finish finishes all timing, closing all intervals including the root.
 func (t *Timer) Finish() {
+	if t.isNop() {
+		return
+	}
 	end := t.Now()
 	t.Intervals[0].End = end
 	for _, index := range t.stack {
@@ -97,6 +118,9 @@ func (t *Timer) Finish() {
 
 // Now returns the time now relative to timer.Zero.
 func (t *Timer) Now() time.Duration {
+	if t.isNop() {
+		return 0
+	}
 	return nowFunc().Sub(t.Zero)
 }
 
@@ -107,6 +131,56 @@ func (t *Timer) String() string {
 	return buf.String()
 }
 
+// Summary returns a single-line string describing the tree of time intervals,
+// e.g. for use in a log statement.  See Summarize for the format.
+func (t *Timer) Summary() string {
+	return Summarize(t.Intervals, t.Now())
+}
+
+// Summarize returns a single-line string describing the given intervals, with
+// the children of each interval in brackets following it.  Example output:
+//
+//	root=98s[foo=45s[foo1=22s,foo2=18s],bar=25s,baz=19s]
+//
+// Unlike IntervalPrinter, gaps between intervals aren't shown, and durations
+// are rounded to the millisecond.  The intervals must be in depth-first order,
+// and the time now is used as the end time for any open intervals, as described
+// for IntervalPrinter.Print.
+func Summarize(intervals []Interval, now time.Duration) string {
+	var buf bytes.Buffer
+	open := 0 // number of unclosed brackets
+	for index, i := range intervals {
+		if index > 0 {
+			prev := intervals[index-1].Depth
+			switch {
+			case i.Depth > prev:
+				buf.WriteString(strings.Repeat("[", i.Depth-prev))
+				open += i.Depth - prev
+			case i.Depth < prev:
+				// A subslice of intervals may end up shallower than it started, in
+				// which case there are fewer brackets to close.
+				n := prev - i.Depth
+				if n > open {
+					n = open
+				}
+				buf.WriteString(strings.Repeat("]", n))
+				open -= n
+				buf.WriteByte(',')
+			default:
+				buf.WriteByte(',')
+			}
+		}
+		dur := now - i.Start
+		if i.End != InvalidDuration {
+			dur = i.End - i.Start
+		}
+		secs := float64(dur.Round(time.Millisecond)) / float64(time.Second)
+		fmt.Fprintf(&buf, "%s=%ss", i.Name, strconv.FormatFloat(secs, 'f', -1, 64))
+	}
+	buf.WriteString(strings.Repeat("]", open))
+	return buf.String()
+}
+
 // IntervalPrinter is a pretty-printer for Intervals.  Example output:
 //
 //	00:00:01.000 root       98.000s       00:01:39.000
@@ -714,3 +714,57 @@ func BenchmarkTimerString(b *testing.B) {
 	}
 	nowFunc = time.Now
 }
+
+func TestNopTimer(t *testing.T) {
+	timer := NopTimer()
+	timer.Push("A")
+	timer.Push("B")
+	timer.Pop()
+	timer.Finish()
+	timer.Pop()
+	if got, want := len(timer.Intervals), 0; got != want {
+		t.Errorf("got %v intervals, want %v", got, want)
+	}
+	if got, want := timer.Now(), time.Duration(0); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := timer.String(), ""; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestSummary(t *testing.T) {
+	fake := &fakeNow{0}
+	nowFunc = fake.Now
+	defer func() { nowFunc = time.Now }()
+	timer := NewTimer("root")
+	for _, op := range []op{
+		push{10, "foo"}, push{15, "foo1"}, pop{37}, push{37, "foo2"}, pop{55}, pop{55},
+		push{55, "bar"}, pop{80}, push{80, "baz"},
+	} {
+		op.run(fake, timer)
+	}
+	fake.now = 100
+	if got, want := timer.Summary(), "root=100s[foo=45s[foo1=22s,foo2=18s],bar=25s,baz=20s]"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	timer.Finish()
+	tests := []struct {
+		intervals []Interval
+		want      string
+	}{
+		{nil, ""},
+		{timer.Intervals[:1], "root=100s"},
+		{timer.Intervals[1:4], "foo=45s[foo1=22s,foo2=18s]"},
+		{timer.Intervals[3:], "foo2=18s,bar=25s,baz=20s"},
+		{[]Interval{{"a", 0, 0, 1500 * time.Millisecond}, {"b", 1, 0, 1234567 * time.Microsecond}}, "a=1.5s[b=1.235s]"},
+	}
+	for _, test := range tests {
+		if got := Summarize(test.intervals, timer.Now()); got != test.want {
+			t.Errorf("%v: got %q, want %q", test.intervals, got, test.want)
+		}
+	}
+	if got, want := NopTimer().Summary(), ""; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}